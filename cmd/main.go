@@ -3,6 +3,7 @@ package main
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/joho/godotenv"
+	"ucrs.com/inventory-manager/backend/internal/jobs"
 	"ucrs.com/inventory-manager/backend/internal/routes"
 	"ucrs.com/inventory-manager/backend/middleware"
 )
@@ -19,5 +20,7 @@ func main() {
 
 	routes.SetupRoutes(app)
 
+	jobs.Start()
+
 	app.Listen(":3000")
 }
@@ -1,6 +1,8 @@
 package database
 
 import (
+	"encoding/json"
+	"errors"
 	"os"
 	"strings"
 
@@ -32,6 +34,17 @@ func CreateClient(jwt string) *supabase.Client {
 	return client
 }
 
+// Creates a client authenticated with the service role key, for background jobs that run
+// outside of any user's request and need to see every company's data
+func CreateServiceClient() (*supabase.Client, error) {
+	API_URL := os.Getenv("API_URL")
+	SERVICE_KEY := os.Getenv("SERVICE_KEY")
+	if SERVICE_KEY == "" {
+		return nil, errors.New("SERVICE_KEY is not set")
+	}
+	return supabase.NewClient(API_URL, SERVICE_KEY, &supabase.ClientOptions{})
+}
+
 func FetchUserID(client *supabase.Client) (uuid.UUID, error) {
 	clientdetails, err := client.Auth.GetUser()
 	if err != nil {
@@ -39,3 +52,26 @@ func FetchUserID(client *supabase.Client) (uuid.UUID, error) {
 	}
 	return clientdetails.ID, nil
 }
+
+// Fetches the company the logged in user belongs to, from their users row
+func FetchCompanyID(client *supabase.Client) (uuid.UUID, error) {
+	userID, err := FetchUserID(client)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	user, _, err := client.From("users").Select("company_id", "", false).Eq("id", userID.String()).Execute()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	respStruct := []struct {
+		CompanyID uuid.UUID `json:"company_id"`
+	}{}
+	err = json.Unmarshal(user, &respStruct)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if len(respStruct) == 0 || respStruct[0].CompanyID == uuid.Nil {
+		return uuid.Nil, errors.New("user is not assigned to a company")
+	}
+	return respStruct[0].CompanyID, nil
+}
@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/supabase-community/postgrest-go"
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/models"
+)
+
+const (
+	classAShare = 80.0 //Cumulative share of consumption value up to which skus are A
+	classBShare = 95.0
+	classXLimit = 0.5 //Coefficient of variation of weekly demand up to which skus are X
+	classYLimit = 1.0
+)
+
+// Issues that count as stock moving out of a warehouse - adjustments, counts and damage don't
+var issueReasons = []string{models.MovementReasonShipment, models.MovementReasonTransferOut, models.MovementReasonAssembly}
+
+// Reasons stock arrives at a warehouse for - the newest arrival dates the stock on hand
+var receiptReasons = []string{models.MovementReasonReceipt, models.MovementReasonTransferIn, models.MovementReasonReturn, models.MovementReasonAssembly, models.MovementReasonDisassembly}
+
+// Value of a unit of a sku for analysis - its standard cost, or its price where it has none
+func analysisUnitValue(sku models.SKU) float64 {
+	if sku.StandardCost > 0 {
+		return sku.StandardCost
+	}
+	return sku.Price
+}
+
+// Fetches the skus an analysis covers, by ID - those of products in categoryID or any category below
+// it, as their primary or a secondary category, or every sku when it is empty - along with each
+// product's primary category
+func fetchAnalysisSKUs(supabaseClient *supabase.Client, categoryID string) (map[uuid.UUID]models.SKU, map[uuid.UUID]*uuid.UUID, error) {
+	skus := []models.SKU{}
+	products := []models.Product{}
+	err := selectAll(supabaseClient, "skus", "*", &skus)
+	if err == nil {
+		err = selectAll(supabaseClient, "products", "*", &products)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var inCategory map[uuid.UUID]bool
+	if categoryID != "" {
+		id, err := uuid.Parse(categoryID)
+		if err != nil {
+			return nil, nil, fiber.NewError(fiber.StatusBadRequest, "Invalid category ID")
+		}
+		scope, err := fetchCategoryScope(supabaseClient, id, true)
+		if err != nil {
+			return nil, nil, err
+		}
+		productIDs, err := fetchCategoryProductIDs(supabaseClient, scope)
+		if err != nil {
+			return nil, nil, err
+		}
+		inCategory = map[uuid.UUID]bool{}
+		for _, productID := range productIDs {
+			inCategory[uuid.MustParse(productID)] = true
+		}
+	}
+
+	productCategories := map[uuid.UUID]*uuid.UUID{}
+	for _, product := range products {
+		productCategories[product.ID] = product.CategoryID
+	}
+	skuByID := map[uuid.UUID]models.SKU{}
+	for _, sku := range skus {
+		if inCategory != nil && !inCategory[sku.ProductID] {
+			continue
+		}
+		skuByID[sku.ID] = sku
+	}
+	return skuByID, productCategories, nil
+}
+
+// Fetches the movements with one of the given reasons recorded since a time, optionally at one
+// warehouse - issues when the quantity filter is "lt" 0, receipts when it is "gt" 0
+func fetchMovementsSince(supabaseClient *supabase.Client, reasons []string, quantityOperator string, since time.Time, warehouseID string) ([]models.StockMovement, error) {
+	query := supabaseClient.From("stock_movements").Select("id, sku_id, location_id, quantity, reason, created_at", "", false).In("reason", reasons).Filter("quantity", quantityOperator, "0").Gte("created_at", since.UTC().Format(time.RFC3339Nano))
+	if warehouseID != "" {
+		query = query.Eq("location_id", warehouseID)
+	}
+	return fetchAllPages[models.StockMovement](query.Order("id", &postgrest.OrderOpts{Ascending: true}))
+}
+
+// Fetches the issues recorded since a time, optionally at one warehouse
+func fetchIssuesSince(supabaseClient *supabase.Client, since time.Time, warehouseID string) ([]models.StockMovement, error) {
+	return fetchMovementsSince(supabaseClient, issueReasons, "lt", since, warehouseID)
+}
+
+// Reads a positive ?days= parameter, falling back to a default when it isn't given
+func analysisDays(c *fiber.Ctx, fallback int) (int, error) {
+	if c.Query("days") == "" {
+		return fallback, nil
+	}
+	days, err := strconv.Atoi(c.Query("days"))
+	if err != nil || days <= 0 {
+		return 0, fiber.NewError(fiber.StatusBadRequest, "Days must be a whole number greater than 0")
+	}
+	return days, nil
+}
+
+// Classifies skus by consumption value (ABC) and by how much their weekly demand varies (XYZ), from
+// the stock issued over the last ?days= (default 91, rounded up to whole weeks). ?category_id= limits
+// the analysis to one product line and ?warehouse_id= to one warehouse's issues.
+func GetClassificationReport(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	days, err := analysisDays(c, 91)
+	if err != nil {
+		return validationErrorResponse(c, err, "Invalid days")
+	}
+	weeks := (days + 6) / 7
+	to := time.Now()
+	from := to.AddDate(0, 0, -weeks*7)
+
+	skuByID, productCategories, err := fetchAnalysisSKUs(supabaseClient, c.Query("category_id"))
+	if err != nil {
+		return validationErrorResponse(c, err, "Cannot fetch SKUs from database")
+	}
+	issues, err := fetchIssuesSince(supabaseClient, from, c.Query("warehouse_id"))
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch stock movements from database",
+		})
+	}
+
+	weekly := map[uuid.UUID][]float64{}
+	for skuID := range skuByID {
+		weekly[skuID] = make([]float64, weeks)
+	}
+	for _, issue := range issues {
+		if _, ok := skuByID[issue.SkuID]; !ok {
+			continue
+		}
+		week := min(int(issue.CreatedAt.Sub(from)/(7*24*time.Hour)), weeks-1)
+		weekly[issue.SkuID][max(0, week)] += float64(-issue.Quantity)
+	}
+
+	report := models.ClassificationReport{
+		PeriodDays:  weeks * 7,
+		From:        from,
+		To:          to,
+		Classes:     map[string]int{},
+		SKUs:        []models.SKUClassification{},
+		GeneratedAt: to,
+	}
+	total := 0.0
+	for skuID, sku := range skuByID {
+		classification := models.SKUClassification{
+			SkuID:      skuID,
+			SKU:        sku.SKU,
+			ProductID:  sku.ProductID,
+			CategoryID: productCategories[sku.ProductID],
+			XYZ:        models.ClassZ,
+		}
+
+		sum := 0.0
+		for _, quantity := range weekly[skuID] {
+			sum += quantity
+		}
+		if sum > 0 {
+			mean := sum / float64(weeks)
+			variance := 0.0
+			for _, quantity := range weekly[skuID] {
+				variance += (quantity - mean) * (quantity - mean)
+			}
+			cv := math.Round(math.Sqrt(variance/float64(weeks))/mean*100) / 100
+			classification.CoefficientOfVariation = &cv
+			switch {
+			case cv <= classXLimit:
+				classification.XYZ = models.ClassX
+			case cv <= classYLimit:
+				classification.XYZ = models.ClassY
+			}
+		}
+		classification.QuantityConsumed = int(sum)
+		classification.ConsumptionValue = sum * analysisUnitValue(sku)
+		total += classification.ConsumptionValue
+		report.SKUs = append(report.SKUs, classification)
+	}
+
+	//Highest consumption value first, each sku's class set by the share accumulated up to it
+	slices.SortFunc(report.SKUs, func(a, b models.SKUClassification) int {
+		return cmp.Or(cmp.Compare(b.ConsumptionValue, a.ConsumptionValue), cmp.Compare(a.SKU, b.SKU))
+	})
+	cumulative := 0.0
+	for i := range report.SKUs {
+		line := &report.SKUs[i]
+		cumulative += line.ConsumptionValue
+		line.ABC = models.ClassC
+		if total > 0 && line.ConsumptionValue > 0 {
+			line.CumulativeShare = math.Round(cumulative/total*10000) / 100
+			switch {
+			case line.CumulativeShare <= classAShare || i == 0:
+				line.ABC = models.ClassA
+			case line.CumulativeShare <= classBShare:
+				line.ABC = models.ClassB
+			}
+		}
+		line.ConsumptionValue = roundMoney(line.ConsumptionValue)
+		line.Class = line.ABC + line.XYZ
+		report.Classes[line.Class]++
+	}
+
+	return c.Status(fiber.StatusOK).JSON(report)
+}
+
+// Flags stock on hand that hasn't been issued from its warehouse recently - slow-moving when nothing
+// has gone out in ?days= (default 90), and dead when nothing has in twice that. Stock is dated from
+// its last issue or its latest receipt, whichever is newer, so stock that arrived within ?days= isn't
+// flagged however long ago the sku last went out. ?category_id= and
+// ?warehouse_id= narrow the report. Dead stock comes first, most valuable first, then slow-moving
+// stock, longest unmoved first.
+func GetDeadStockReport(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	days, err := analysisDays(c, 90)
+	if err != nil {
+		return validationErrorResponse(c, err, "Invalid days")
+	}
+	now := time.Now()
+
+	skuByID, _, err := fetchAnalysisSKUs(supabaseClient, c.Query("category_id"))
+	if err != nil {
+		return validationErrorResponse(c, err, "Cannot fetch SKUs from database")
+	}
+	query := supabaseClient.From("inventory").Select("*", "", false).Gt("quantity", "0")
+	if warehouseID := c.Query("warehouse_id"); warehouseID != "" {
+		query = query.Eq("location_id", warehouseID)
+	}
+	inventory, _, err := query.Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch inventory from database",
+		})
+	}
+	respInventory := []models.Inventory{}
+	err = json.Unmarshal(inventory, &respInventory)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal inventory from database",
+		})
+	}
+	warehouses := []models.WarehouseDatabase{}
+	err = selectAll(supabaseClient, "warehouses", "id, name", &warehouses)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch warehouses from database",
+		})
+	}
+	issues, err := fetchIssuesSince(supabaseClient, now.AddDate(0, 0, -2*days), c.Query("warehouse_id"))
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch stock movements from database",
+		})
+	}
+	receipts, err := fetchMovementsSince(supabaseClient, receiptReasons, "gt", now.AddDate(0, 0, -2*days), c.Query("warehouse_id"))
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch stock movements from database",
+		})
+	}
+
+	warehouseNames := map[uuid.UUID]string{}
+	for _, warehouse := range warehouses {
+		warehouseNames[warehouse.ID] = warehouse.Name
+	}
+	//Stock last moved when it last went out or last came in, whichever is newer
+	lastMoved := map[stockKey]time.Time{}
+	for _, movement := range append(issues, receipts...) {
+		key := stockKey{movement.SkuID, movement.LocationID}
+		if movement.CreatedAt.After(lastMoved[key]) {
+			lastMoved[key] = movement.CreatedAt
+		}
+	}
+
+	slowCutoff := now.AddDate(0, 0, -days)
+	report := []models.DeadStockLine{}
+	for _, inv := range respInventory {
+		sku, ok := skuByID[inv.SkuID]
+		if !ok {
+			continue
+		}
+		line := models.DeadStockLine{
+			SkuID:         inv.SkuID,
+			SKU:           sku.SKU,
+			LocationID:    inv.LocationID,
+			WarehouseName: warehouseNames[inv.LocationID],
+			Quantity:      inv.Quantity,
+			Value:         roundMoney(float64(inv.Quantity) * analysisUnitValue(sku)),
+			Status:        models.StockStatusDead,
+		}
+		if last, ok := lastMoved[stockKey{inv.SkuID, inv.LocationID}]; ok {
+			if last.After(slowCutoff) {
+				continue
+			}
+			daysSince := int(now.Sub(last).Hours() / 24)
+			line.LastMovedAt = &last
+			line.DaysSinceMovement = &daysSince
+			line.Status = models.StockStatusSlowMoving
+		}
+		report = append(report, line)
+	}
+
+	slices.SortFunc(report, func(a, b models.DeadStockLine) int {
+		if a.Status != b.Status {
+			if a.Status == models.StockStatusDead {
+				return -1
+			}
+			return 1
+		}
+		if a.LastMovedAt == nil || b.LastMovedAt == nil {
+			return cmp.Compare(b.Value, a.Value)
+		}
+		return a.LastMovedAt.Compare(*b.LastMovedAt)
+	})
+
+	return c.Status(fiber.StatusOK).JSON(report)
+}
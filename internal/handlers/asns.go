@@ -0,0 +1,820 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/database"
+	"ucrs.com/inventory-manager/backend/internal/models"
+)
+
+// A quantity received against an ASN line, in base units once converted
+type asnReceipt struct {
+	SkuID          uuid.UUID  `json:"sku_id"`
+	Quantity       int        `json:"quantity"`
+	Unit           string     `json:"unit"`
+	LotNumber      string     `json:"lot_number"`
+	ManufacturedAt *time.Time `json:"manufactured_at"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+}
+
+func convertASNForDB(asn *models.ASN) *models.ASNDatabase {
+	return &models.ASNDatabase{
+		ID:                    asn.ID,
+		UserID:                asn.UserID,
+		WarehouseID:           asn.WarehouseID,
+		SupplierID:            asn.SupplierID,
+		PurchaseOrderID:       asn.PurchaseOrderID,
+		Status:                asn.Status,
+		Reference:             asn.Reference,
+		OverTolerancePercent:  asn.OverTolerancePercent,
+		UnderTolerancePercent: asn.UnderTolerancePercent,
+		Notes:                 asn.Notes,
+		ExpectedAt:            asn.ExpectedAt,
+		ClosedAt:              asn.ClosedAt,
+		CreatedAt:             asn.CreatedAt,
+		UpdatedAt:             asn.UpdatedAt,
+	}
+}
+
+func convertASNForJSON(asn *models.ASNDatabase, lines []models.ASNLine) *models.ASN {
+	return &models.ASN{
+		ID:                    asn.ID,
+		UserID:                asn.UserID,
+		WarehouseID:           asn.WarehouseID,
+		SupplierID:            asn.SupplierID,
+		PurchaseOrderID:       asn.PurchaseOrderID,
+		Status:                asn.Status,
+		Reference:             asn.Reference,
+		OverTolerancePercent:  asn.OverTolerancePercent,
+		UnderTolerancePercent: asn.UnderTolerancePercent,
+		Notes:                 asn.Notes,
+		Lines:                 lines,
+		ExpectedAt:            asn.ExpectedAt,
+		ClosedAt:              asn.ClosedAt,
+		CreatedAt:             asn.CreatedAt,
+		UpdatedAt:             asn.UpdatedAt,
+	}
+}
+
+// Fetches an ASN with its lines - returns nil if the ASN does not exist
+func fetchASN(supabaseClient *supabase.Client, asnID string) (*models.ASN, error) {
+	asn, _, err := supabaseClient.From("asns").Select("*", "", false).Eq("id", asnID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.ASNDatabase{}
+	err = json.Unmarshal(asn, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	if len(respStruct) == 0 {
+		return nil, nil
+	}
+
+	lines, _, err := supabaseClient.From("asn_lines").Select("*", "", false).Eq("asn_id", asnID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respLines := []models.ASNLine{}
+	err = json.Unmarshal(lines, &respLines)
+	if err != nil {
+		return nil, err
+	}
+
+	return convertASNForJSON(&respStruct[0], respLines), nil
+}
+
+// The most that can be received against a line before it is over tolerance
+func asnReceiptLimit(asn *models.ASN, line models.ASNLine) int {
+	return int(math.Floor(float64(line.QuantityExpected) * (100 + asn.OverTolerancePercent) / 100))
+}
+
+// Lists every line where the quantity received differs from the quantity expected, flagging those
+// outside the ASN's over/under tolerances
+func asnDiscrepancies(asn *models.ASN) []models.ASNDiscrepancy {
+	discrepancies := []models.ASNDiscrepancy{}
+	for _, line := range asn.Lines {
+		if line.QuantityReceived == line.QuantityExpected {
+			continue
+		}
+		minimum := int(math.Ceil(float64(line.QuantityExpected) * (100 - asn.UnderTolerancePercent) / 100))
+		discrepancies = append(discrepancies, models.ASNDiscrepancy{
+			SkuID:            line.SkuID,
+			QuantityExpected: line.QuantityExpected,
+			QuantityReceived: line.QuantityReceived,
+			Difference:       line.QuantityReceived - line.QuantityExpected,
+			WithinTolerance:  line.QuantityReceived >= minimum && line.QuantityReceived <= asnReceiptLimit(asn, line),
+		})
+	}
+	return discrepancies
+}
+
+// Checks receipts in base units against an ASN - skus must be on the ASN, and no line can be
+// received beyond its over tolerance
+func validateASNReceipts(supabaseClient *supabase.Client, asn *models.ASN, receipts []asnReceipt) error {
+	if asn.Status != models.ASNStatusExpected && asn.Status != models.ASNStatusReceiving {
+		return fiber.NewError(fiber.StatusConflict, "Only open ASNs can be received against")
+	}
+
+	lineIndex := map[uuid.UUID]int{}
+	for i, line := range asn.Lines {
+		lineIndex[line.SkuID] = i
+	}
+	received := map[uuid.UUID]int{}
+	for _, receipt := range receipts {
+		i, ok := lineIndex[receipt.SkuID]
+		if !ok {
+			return fiber.NewError(fiber.StatusBadRequest, "SKU "+receipt.SkuID.String()+" is not on this ASN")
+		}
+		received[receipt.SkuID] += receipt.Quantity
+		if asn.Lines[i].QuantityReceived+received[receipt.SkuID] > asnReceiptLimit(asn, asn.Lines[i]) {
+			return fiber.NewError(fiber.StatusBadRequest, "Received quantity of SKU "+receipt.SkuID.String()+" exceeds the over-receipt tolerance")
+		}
+	}
+	for skuID := range received {
+		sku, err := fetchSKU(supabaseClient, skuID.String())
+		if err != nil {
+			return err
+		}
+		if sku != nil && sku.Serialized {
+			return fiber.NewError(fiber.StatusBadRequest, "Serialized SKU "+skuID.String()+" must be received by registering its serial numbers")
+		}
+	}
+	return nil
+}
+
+// Books validated receipts into the ASN's warehouse and adds them to its lines. The stock and the
+// lines are saved together - if either fails the other is undone.
+func receiveASNStock(supabaseClient *supabase.Client, asn *models.ASN, userID uuid.UUID, receipts []asnReceipt) error {
+	lineIndex := map[uuid.UUID]int{}
+	for i, line := range asn.Lines {
+		lineIndex[line.SkuID] = i
+	}
+
+	movements := []*models.StockMovement{}
+	received := map[int]int{}
+	for _, receipt := range receipts {
+		i := lineIndex[receipt.SkuID]
+		if receipt.LotNumber != "" {
+			err := saveLot(supabaseClient, receipt.SkuID, asn.WarehouseID, userID, receipt.LotNumber, receipt.ManufacturedAt, receipt.ExpiresAt)
+			if err != nil {
+				return err
+			}
+		}
+		movements = append(movements, &models.StockMovement{
+			SkuID:      receipt.SkuID,
+			LocationID: asn.WarehouseID,
+			UserID:     userID,
+			Quantity:   receipt.Quantity,
+			Reason:     models.MovementReasonReceipt,
+			Reference:  "asn:" + asn.ID.String(),
+			LotNumber:  receipt.LotNumber,
+			UnitCost:   asn.Lines[i].UnitCost,
+		})
+		received[i] += receipt.Quantity
+	}
+	err := recordStockMovements(supabaseClient, movements)
+	if err != nil {
+		return err
+	}
+
+	updated := []int{}
+	undo := func() error {
+		for _, i := range updated {
+			asn.Lines[i].QuantityReceived -= received[i]
+			_, _, err := supabaseClient.From("asn_lines").Update(asn.Lines[i], "", "").Eq("id", asn.Lines[i].ID.String()).Execute()
+			if err != nil {
+				fmt.Println(err)
+			}
+		}
+		return reverseStockMovements(supabaseClient, movements)
+	}
+	for i, quantity := range received {
+		asn.Lines[i].QuantityReceived += quantity
+		_, _, err = supabaseClient.From("asn_lines").Update(asn.Lines[i], "", "").Eq("id", asn.Lines[i].ID.String()).Execute()
+		if err != nil {
+			asn.Lines[i].QuantityReceived -= quantity
+			return errors.Join(err, undo())
+		}
+		updated = append(updated, i)
+	}
+
+	status, updatedAt := asn.Status, asn.UpdatedAt
+	asn.Status = models.ASNStatusReceiving
+	asn.UpdatedAt = time.Now()
+	_, _, err = supabaseClient.From("asns").Update(convertASNForDB(asn), "", "").Eq("id", asn.ID.String()).Execute()
+	if err != nil {
+		asn.Status, asn.UpdatedAt = status, updatedAt
+		return errors.Join(err, undo())
+	}
+	offerToBackorders(supabaseClient, movements)
+	return nil
+}
+
+// The quantity of each sku that a purchase order's open ASNs still account for - what they expect,
+// or what has already been received against them if that is more. Receipts against an ASN are only
+// booked on the order when it closes, so these goods must not be received or expected again.
+func openASNQuantities(supabaseClient *supabase.Client, orderID string) (map[uuid.UUID]int, error) {
+	asns, _, err := supabaseClient.From("asns").Select("id", "", false).Eq("purchase_order_id", orderID).In("status", []string{models.ASNStatusExpected, models.ASNStatusReceiving}).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []struct {
+		ID uuid.UUID `json:"id"`
+	}{}
+	err = json.Unmarshal(asns, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+
+	covered := map[uuid.UUID]int{}
+	if len(respStruct) == 0 {
+		return covered, nil
+	}
+	ids := []string{}
+	for _, asn := range respStruct {
+		ids = append(ids, asn.ID.String())
+	}
+	lines, _, err := supabaseClient.From("asn_lines").Select("*", "", false).In("asn_id", ids).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respLines := []models.ASNLine{}
+	err = json.Unmarshal(lines, &respLines)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range respLines {
+		covered[line.SkuID] += max(line.QuantityExpected, line.QuantityReceived)
+	}
+	return covered, nil
+}
+
+// The quantity of a purchase order line still outstanding that no open ASN accounts for
+func uncoveredQuantity(line models.PurchaseOrderLine, covered map[uuid.UUID]int) int {
+	return max(line.Quantity-line.QuantityReceived-covered[line.SkuID], 0)
+}
+
+// Registers a delivery expected at a warehouse. ASNs raised against a purchase order take their
+// warehouse, supplier and costs from it, and expect everything still outstanding unless lines are given.
+func CreateASN(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	asn := new(models.ASN)
+
+	if err := c.BodyParser(asn); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	// Basic validation
+	if asn.OverTolerancePercent < 0 || asn.UnderTolerancePercent < 0 || asn.UnderTolerancePercent > 100 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Tolerances must be percentages of at least 0, and the under tolerance cannot exceed 100",
+		})
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	asn.ID = uuid.New()
+	asn.UserID = userID
+	asn.Status = models.ASNStatusExpected
+	asn.ClosedAt = nil
+
+	var order *models.PurchaseOrder
+	var covered map[uuid.UUID]int
+	if asn.PurchaseOrderID != nil {
+		order, err = fetchPurchaseOrder(supabaseClient, asn.PurchaseOrderID.String())
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch purchase order from database",
+			})
+		}
+		if order == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Purchase order not found",
+			})
+		}
+		if order.Status != models.PurchaseOrderStatusSent && order.Status != models.PurchaseOrderStatusPartiallyReceived {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Only sent purchase orders can be delivered against",
+			})
+		}
+		covered, err = openASNQuantities(supabaseClient, order.ID.String())
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch ASNs from database",
+			})
+		}
+		if asn.WarehouseID != uuid.Nil && asn.WarehouseID != order.WarehouseID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Warehouse must match the purchase order's",
+			})
+		}
+		asn.WarehouseID = order.WarehouseID
+		asn.SupplierID = &order.SupplierID
+		if asn.ExpectedAt == nil {
+			asn.ExpectedAt = order.ExpectedAt
+		}
+
+		//Expect everything still outstanding on the order that other open ASNs don't already
+		if len(asn.Lines) == 0 {
+			for _, line := range order.Lines {
+				if quantity := uncoveredQuantity(line, covered); quantity > 0 {
+					asn.Lines = append(asn.Lines, models.ASNLine{
+						SkuID:            line.SkuID,
+						QuantityExpected: quantity,
+					})
+				}
+			}
+			if len(asn.Lines) == 0 {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error": "Everything outstanding on the purchase order is already expected on open ASNs",
+				})
+			}
+		}
+	} else if asn.SupplierID != nil {
+		supplier, err := fetchSupplier(supabaseClient, asn.SupplierID.String())
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch supplier from database",
+			})
+		}
+		if supplier == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Supplier not found",
+			})
+		}
+	}
+
+	if asn.WarehouseID == uuid.Nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Warehouse is required",
+		})
+	}
+
+	if len(asn.Lines) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "ASN must have at least one line",
+		})
+	}
+
+	//Lines for the same sku are merged so each sku appears once on the ASN
+	lines := []models.ASNLine{}
+	lineIndex := map[uuid.UUID]int{}
+	for _, line := range asn.Lines {
+		if line.SkuID == uuid.Nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "SKU ID is required on every line",
+			})
+		}
+		if line.QuantityExpected <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Expected quantity must be greater than 0",
+			})
+		}
+		line.QuantityExpected, err = toBaseQuantity(supabaseClient, line.SkuID, line.Unit, line.QuantityExpected)
+		if err != nil {
+			return unitErrorResponse(c, err)
+		}
+		if i, ok := lineIndex[line.SkuID]; ok {
+			lines[i].QuantityExpected += line.QuantityExpected
+			continue
+		}
+
+		//Stock delivered against an order is valued at the ordered cost
+		var unitCost *float64
+		if order != nil {
+			for _, orderLine := range order.Lines {
+				if orderLine.SkuID == line.SkuID {
+					cost := orderLine.UnitCost
+					unitCost = &cost
+				}
+			}
+			if unitCost == nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error":  "SKU is not on the purchase order",
+					"sku_id": line.SkuID,
+				})
+			}
+		}
+
+		lineIndex[line.SkuID] = len(lines)
+		lines = append(lines, models.ASNLine{
+			ID:               uuid.New(),
+			ASNID:            asn.ID,
+			SkuID:            line.SkuID,
+			UserID:           userID,
+			QuantityExpected: line.QuantityExpected,
+			UnitCost:         unitCost,
+		})
+	}
+	asn.Lines = lines
+
+	//Split deliveries are fine, but between them the open ASNs can't expect more than is outstanding
+	if order != nil {
+		for _, line := range asn.Lines {
+			for _, orderLine := range order.Lines {
+				if orderLine.SkuID == line.SkuID && line.QuantityExpected > uncoveredQuantity(orderLine, covered) {
+					return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+						"error":  "Expected quantity exceeds what is outstanding on the purchase order and not already expected on open ASNs",
+						"sku_id": line.SkuID,
+					})
+				}
+			}
+		}
+	}
+
+	// Set timestamps
+	now := time.Now()
+	asn.CreatedAt = now
+	asn.UpdatedAt = now
+
+	//Save to database
+	_, _, err = supabaseClient.From("asns").Insert(convertASNForDB(asn), false, "", "", "").Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save ASN to database",
+		})
+	}
+
+	_, _, err = supabaseClient.From("asn_lines").Insert(asn.Lines, false, "", "", "").Execute()
+	if err != nil {
+		fmt.Println(err)
+		//Don't leave an ASN without lines behind
+		supabaseClient.From("asns").Delete("", "").Eq("id", asn.ID.String()).Execute()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save ASN lines to database",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(asn)
+}
+
+func GetASNs(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	query := supabaseClient.From("asns").Select("*", "", false)
+	if status := c.Query("status"); status != "" {
+		query = query.Eq("status", status)
+	}
+	if warehouseID := c.Query("warehouse_id"); warehouseID != "" {
+		query = query.Eq("warehouse_id", warehouseID)
+	}
+	if orderID := c.Query("purchase_order_id"); orderID != "" {
+		query = query.Eq("purchase_order_id", orderID)
+	}
+	asns, _, err := query.Order("created_at", nil).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch ASNs from database",
+		})
+	}
+	respStruct := []models.ASNDatabase{}
+	err = json.Unmarshal(asns, &respStruct)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal ASNs from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(respStruct)
+}
+
+// Gets an ASN with its lines, and the discrepancies so far once receiving has started
+func GetASN(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	asnID := c.Params("id")
+
+	asn, err := fetchASN(supabaseClient, asnID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch ASN from database",
+		})
+	}
+	if asn == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "ASN not found",
+		})
+	}
+
+	resp := fiber.Map{
+		"asn": asn,
+	}
+	if asn.Status == models.ASNStatusReceiving || asn.Status == models.ASNStatusClosed {
+		resp["discrepancies"] = asnDiscrepancies(asn)
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+// Receives quantities of skus against an ASN straight into its warehouse
+func ReceiveASN(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	asnID := c.Params("id")
+	request := new(struct {
+		Lines []asnReceipt `json:"lines"`
+	})
+	if err := c.BodyParser(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	if len(request.Lines) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Receipt must have at least one line",
+		})
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	asn, err := fetchASN(supabaseClient, asnID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch ASN from database",
+		})
+	}
+	if asn == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "ASN not found",
+		})
+	}
+
+	for i, line := range request.Lines {
+		if line.Quantity <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Received quantity must be greater than 0",
+			})
+		}
+		request.Lines[i].Quantity, err = toBaseQuantity(supabaseClient, line.SkuID, line.Unit, line.Quantity)
+		if err != nil {
+			return unitErrorResponse(c, err)
+		}
+	}
+
+	//Validate the whole receipt first - receipts beyond the over tolerance are rejected
+	err = validateASNReceipts(supabaseClient, asn, request.Lines)
+	if err == nil {
+		err = receiveASNStock(supabaseClient, asn, userID, request.Lines)
+	}
+	if err != nil {
+		return validationErrorResponse(c, err, "Cannot update inventory in database")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"asn":           asn,
+		"discrepancies": asnDiscrepancies(asn),
+	})
+}
+
+// Receives against an ASN by scanning a barcode. Each scan is one of the barcode's pack level, and
+// lot numbers and expiry dates are taken from GS1 barcodes, so nothing needs to be typed in.
+func ScanASN(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	asnID := c.Params("id")
+	request := new(struct {
+		Value string `json:"value"`
+		Count int    `json:"count"` //Number of identical packs scanned - defaults to 1
+	})
+	if err := c.BodyParser(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	if request.Value == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Barcode value is required",
+		})
+	}
+	if request.Count < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Count cannot be negative",
+		})
+	}
+	if request.Count == 0 {
+		request.Count = 1
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	asn, err := fetchASN(supabaseClient, asnID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch ASN from database",
+		})
+	}
+	if asn == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "ASN not found",
+		})
+	}
+
+	barcode, gs1, err := resolveBarcode(supabaseClient, request.Value)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch barcode from database",
+		})
+	}
+	if barcode == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Barcode not found",
+		})
+	}
+	unitName, quantity, err := barcodeQuantity(supabaseClient, barcode)
+	if err != nil {
+		return unitErrorResponse(c, err)
+	}
+
+	receipt := asnReceipt{
+		SkuID:    barcode.SkuID,
+		Quantity: quantity * request.Count,
+	}
+	if gs1 != nil {
+		receipt.LotNumber = gs1.LotNumber
+		receipt.ExpiresAt = gs1.ExpiryDate
+	}
+
+	receipts := []asnReceipt{receipt}
+	err = validateASNReceipts(supabaseClient, asn, receipts)
+	if err == nil {
+		err = receiveASNStock(supabaseClient, asn, userID, receipts)
+	}
+	if err != nil {
+		return validationErrorResponse(c, err, "Cannot update inventory in database")
+	}
+
+	var line models.ASNLine
+	for _, l := range asn.Lines {
+		if l.SkuID == barcode.SkuID {
+			line = l
+		}
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"line":      line,
+		"unit":      unitName,
+		"quantity":  receipt.Quantity, //In base units
+		"lot":       receipt.LotNumber,
+		"remaining": max(line.QuantityExpected-line.QuantityReceived, 0),
+	})
+}
+
+// Closes an ASN and reports its discrepancies. Closing with lines outside tolerance must be
+// confirmed with "accept". Receipts are then booked against the purchase order, if there is one.
+func CloseASN(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	asnID := c.Params("id")
+	request := new(struct {
+		Accept bool `json:"accept"`
+	})
+	if err := c.BodyParser(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	asn, err := fetchASN(supabaseClient, asnID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch ASN from database",
+		})
+	}
+	if asn == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "ASN not found",
+		})
+	}
+	if asn.Status != models.ASNStatusExpected && asn.Status != models.ASNStatusReceiving {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "ASN is already closed or cancelled",
+		})
+	}
+
+	discrepancies := asnDiscrepancies(asn)
+	if !request.Accept {
+		for _, discrepancy := range discrepancies {
+			if !discrepancy.WithinTolerance {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error":         "Received quantities are outside tolerance - set accept to close anyway",
+					"discrepancies": discrepancies,
+				})
+			}
+		}
+	}
+
+	now := time.Now()
+	status, updatedAt := asn.Status, asn.UpdatedAt
+	asn.Status = models.ASNStatusClosed
+	asn.ClosedAt = &now
+	asn.UpdatedAt = now
+	_, _, err = supabaseClient.From("asns").Update(convertASNForDB(asn), "", "").Eq("id", asnID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save ASN to database",
+		})
+	}
+
+	if asn.PurchaseOrderID != nil {
+		order, err := fetchPurchaseOrder(supabaseClient, asn.PurchaseOrderID.String())
+		if err == nil && order != nil && (order.Status == models.PurchaseOrderStatusSent || order.Status == models.PurchaseOrderStatusPartiallyReceived) {
+			//Over-receipts within tolerance are kept as stock but the order can't be received beyond what was ordered
+			received := map[uuid.UUID]int{}
+			for _, line := range order.Lines {
+				for _, asnLine := range asn.Lines {
+					if asnLine.SkuID == line.SkuID {
+						received[line.SkuID] = min(asnLine.QuantityReceived, line.Quantity-line.QuantityReceived)
+					}
+				}
+			}
+			err = applyPurchaseOrderReceipt(supabaseClient, order, received, false)
+		}
+		if err != nil {
+			fmt.Println(err)
+			//Reopen the ASN so closing it can be retried
+			asn.Status, asn.ClosedAt, asn.UpdatedAt = status, nil, updatedAt
+			if _, _, err := supabaseClient.From("asns").Update(convertASNForDB(asn), "", "").Eq("id", asnID).Execute(); err != nil {
+				fmt.Println(err)
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot update purchase order in database",
+			})
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"asn":           asn,
+		"discrepancies": discrepancies,
+	})
+}
+
+// Cancels an ASN that nothing has been received against yet
+func CancelASN(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	asnID := c.Params("id")
+
+	asn, err := fetchASN(supabaseClient, asnID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch ASN from database",
+		})
+	}
+	if asn == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "ASN not found",
+		})
+	}
+	if asn.Status != models.ASNStatusExpected {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Only ASNs with nothing received can be cancelled",
+		})
+	}
+
+	now := time.Now()
+	asn.Status = models.ASNStatusCancelled
+	asn.ClosedAt = &now
+	asn.UpdatedAt = now
+	_, _, err = supabaseClient.From("asns").Update(convertASNForDB(asn), "", "").Eq("id", asnID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save ASN to database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "ASN cancelled successfully",
+	})
+}
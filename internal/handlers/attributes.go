@@ -23,10 +23,11 @@ func CreateAttribute(c *fiber.Ctx) error {
 		})
 	}
 
-	//Attribute validation - attribute should have a name and user_id
-	if attribute.Name == "" {
+	//Attribute validation - a name, and a type its allowed values and rules fit
+	if errors := attribute.Validate(); len(errors) > 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Attribute name is required",
+			"error":  "Invalid attribute",
+			"errors": errors,
 		})
 	}
 
@@ -138,10 +139,11 @@ func UpdateAttribute(c *fiber.Ctx) error {
 		})
 	}
 
-	//Attribute validation - attribute should have a name and user_id
-	if attribute.Name == "" {
+	//Attribute validation - a name, and a type its allowed values and rules fit
+	if errors := attribute.Validate(); len(errors) > 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Attribute name is required",
+			"error":  "Invalid attribute",
+			"errors": errors,
 		})
 	}
 
@@ -179,3 +181,46 @@ func DeleteAttribute(c *fiber.Ctx) error {
 		"message": "Attribute deleted successfully",
 	})
 }
+
+// Fetches an attribute - returns nil if it does not exist
+func fetchAttribute(supabaseClient *supabase.Client, attributeID string) (*models.Attribute, error) {
+	attribute, _, err := supabaseClient.From("attributes").Select("*", "", false).Eq("id", attributeID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.Attribute{}
+	err = json.Unmarshal(attribute, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	if len(respStruct) == 0 {
+		return nil, nil
+	}
+	return &respStruct[0], nil
+}
+
+// Fetches attributes by ID. Returns fiber errors for attributes that don't exist.
+func fetchAttributesByID(supabaseClient *supabase.Client, attributeIDs []string) (map[uuid.UUID]models.Attribute, error) {
+	byID := map[uuid.UUID]models.Attribute{}
+	if len(attributeIDs) == 0 {
+		return byID, nil
+	}
+	attributes, _, err := supabaseClient.From("attributes").Select("*", "", false).In("id", attributeIDs).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.Attribute{}
+	err = json.Unmarshal(attributes, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	for _, attribute := range respStruct {
+		byID[attribute.ID] = attribute
+	}
+	for _, attributeID := range attributeIDs {
+		if id, err := uuid.Parse(attributeID); err != nil || byID[id].ID == uuid.Nil {
+			return nil, fiber.NewError(fiber.StatusNotFound, "Attribute not found")
+		}
+	}
+	return byID, nil
+}
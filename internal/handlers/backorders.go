@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/supabase-community/postgrest-go"
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/database"
+	"ucrs.com/inventory-manager/backend/internal/models"
+)
+
+// Fetches a backorder - returns nil if it does not exist
+func fetchBackorder(supabaseClient *supabase.Client, backorderID string) (*models.Backorder, error) {
+	backorder, _, err := supabaseClient.From("backorders").Select("*", "", false).Eq("id", backorderID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.Backorder{}
+	err = json.Unmarshal(backorder, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	if len(respStruct) == 0 {
+		return nil, nil
+	}
+	return &respStruct[0], nil
+}
+
+// Fetches the open backorders for a sku at a location, oldest first
+func fetchOpenBackorders(supabaseClient *supabase.Client, skuID, locationID uuid.UUID) ([]models.Backorder, error) {
+	backorders, _, err := supabaseClient.From("backorders").Select("*", "", false).Eq("sku_id", skuID.String()).Eq("location_id", locationID.String()).Eq("status", models.BackorderStatusOpen).Order("created_at", &postgrest.OrderOpts{Ascending: true}).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.Backorder{}
+	err = json.Unmarshal(backorders, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	return respStruct, nil
+}
+
+// The reference stock reserved for a backorder is held under
+func backorderReference(backorder *models.Backorder) string {
+	if backorder.Reference != "" {
+		return backorder.Reference
+	}
+	return "backorder:" + backorder.ID.String()
+}
+
+// Fills open backorders for a sku at a location from available stock, oldest first. Each fill
+// reserves the stock for the backorder until it is fulfilled or released - the oldest is filled as
+// far as it can be before the next gets anything.
+func fillBackorders(supabaseClient *supabase.Client, skuID, locationID uuid.UUID) error {
+	backorders, err := fetchOpenBackorders(supabaseClient, skuID, locationID)
+	if err != nil || len(backorders) == 0 {
+		return err
+	}
+	available, err := fetchAvailableQuantity(supabaseClient, skuID, locationID)
+	if err != nil {
+		return err
+	}
+
+	for i := range backorders {
+		backorder := &backorders[i]
+		fill := min(backorder.Quantity-backorder.QuantityFilled, available)
+		if fill <= 0 {
+			break
+		}
+
+		//The fill is held until it is fulfilled or released, not left to lapse - the backorder is
+		//already marked filled, so nothing would put it back in the queue
+		now := time.Now()
+		reservation := &models.Reservation{
+			ID:         uuid.New(),
+			SkuID:      skuID,
+			LocationID: locationID,
+			UserID:     backorder.UserID,
+			Quantity:   fill,
+			Reference:  backorderReference(backorder),
+			Status:     models.ReservationStatusActive,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+		_, err := reserveStock(supabaseClient, reservation)
+		//Stock taken by a concurrent request leaves the rest of the queue for the next arrival
+		if errors.Is(err, ErrInsufficientStock) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		available -= fill
+
+		backorder.QuantityFilled += fill
+		backorder.UpdatedAt = now
+		if backorder.QuantityFilled >= backorder.Quantity {
+			backorder.Status = models.BackorderStatusFilled
+			backorder.FilledAt = &now
+		}
+		_, _, err = supabaseClient.From("backorders").Update(backorder, "", "").Eq("id", backorder.ID.String()).Execute()
+		if err != nil {
+			//Don't hold stock for a fill the backorder doesn't know about
+			if _, _, deleteErr := supabaseClient.From("reservations").Delete("", "").Eq("id", reservation.ID.String()).Execute(); deleteErr != nil {
+				fmt.Println(deleteErr)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Requests a quantity of a sku from a location. Whatever available stock can cover is reserved
+// straight away and the rest is backordered, to be filled as stock arrives. Older backorders are
+// filled before new demand is served.
+func RequestDemand(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	request := new(struct {
+		SkuID      uuid.UUID `json:"sku_id"`
+		LocationID uuid.UUID `json:"location_id"`
+		Quantity   int       `json:"quantity"`
+		Unit       string    `json:"unit"`
+		Reference  string    `json:"reference"`
+	})
+	if err := c.BodyParser(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	// Basic validation
+	if request.SkuID == uuid.Nil || request.LocationID == uuid.Nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "SKU ID and location ID are required",
+		})
+	}
+
+	if request.Quantity <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Quantity must be greater than 0",
+		})
+	}
+
+	quantity, err := toBaseQuantity(supabaseClient, request.SkuID, request.Unit, request.Quantity)
+	if err != nil {
+		return unitErrorResponse(c, err)
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	//Stock freed up since the last arrival (e.g. lapsed reservations) goes to the queue first
+	err = fillBackorders(supabaseClient, request.SkuID, request.LocationID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fill backorders in database",
+		})
+	}
+	queued, err := fetchOpenBackorders(supabaseClient, request.SkuID, request.LocationID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch backorders from database",
+		})
+	}
+
+	now := time.Now()
+	resp := fiber.Map{}
+	reserved := 0
+	if len(queued) == 0 {
+		available, err := fetchAvailableQuantity(supabaseClient, request.SkuID, request.LocationID)
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch inventory from database",
+			})
+		}
+		if available > 0 {
+			expiresAt := now.Add(defaultReservationTTL)
+			reservation := &models.Reservation{
+				ID:         uuid.New(),
+				SkuID:      request.SkuID,
+				LocationID: request.LocationID,
+				UserID:     userID,
+				Quantity:   min(quantity, available),
+				Reference:  request.Reference,
+				Status:     models.ReservationStatusActive,
+				ExpiresAt:  &expiresAt,
+				CreatedAt:  now,
+				UpdatedAt:  now,
+			}
+			_, err = reserveStock(supabaseClient, reservation)
+			if err != nil && !errors.Is(err, ErrInsufficientStock) {
+				fmt.Println(err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Cannot save reservation to database",
+				})
+			}
+			if err == nil {
+				reserved = reservation.Quantity
+				resp["reservation"] = reservation
+			}
+		}
+	}
+
+	if reserved < quantity {
+		backorder := &models.Backorder{
+			ID:         uuid.New(),
+			SkuID:      request.SkuID,
+			LocationID: request.LocationID,
+			UserID:     userID,
+			Reference:  request.Reference,
+			Quantity:   quantity - reserved,
+			Status:     models.BackorderStatusOpen,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+		_, _, err = supabaseClient.From("backorders").Insert(backorder, false, "", "", "").Execute()
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot save backorder to database",
+			})
+		}
+		resp["backorder"] = backorder
+	}
+
+	resp["reserved"] = reserved
+	resp["backordered"] = quantity - reserved
+	return c.Status(fiber.StatusCreated).JSON(resp)
+}
+
+// Lists backorders, optionally filtered by ?status=, ?sku_id= and ?location_id=
+func GetBackorders(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	query := supabaseClient.From("backorders").Select("*", "", false)
+	if status := c.Query("status"); status != "" {
+		query = query.Eq("status", status)
+	}
+	if skuID := c.Query("sku_id"); skuID != "" {
+		query = query.Eq("sku_id", skuID)
+	}
+	if locationID := c.Query("location_id"); locationID != "" {
+		query = query.Eq("location_id", locationID)
+	}
+	backorders, _, err := query.Order("created_at", &postgrest.OrderOpts{Ascending: true}).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch backorders from database",
+		})
+	}
+	respStruct := []models.Backorder{}
+	err = json.Unmarshal(backorders, &respStruct)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal backorders from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(respStruct)
+}
+
+// Cancels an open backorder and releases any stock already reserved to fill it
+func CancelBackorder(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	backorderID := c.Params("id")
+
+	backorder, err := fetchBackorder(supabaseClient, backorderID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch backorder from database",
+		})
+	}
+	if backorder == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Backorder not found",
+		})
+	}
+	if backorder.Status != models.BackorderStatusOpen {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Only open backorders can be cancelled",
+		})
+	}
+
+	now := time.Now()
+	updatedAt := backorder.UpdatedAt
+	backorder.Status = models.BackorderStatusCancelled
+	backorder.UpdatedAt = now
+	_, _, err = supabaseClient.From("backorders").Update(backorder, "", "").Eq("id", backorderID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save backorder to database",
+		})
+	}
+
+	//Release whatever was filled so far - fills are the reservations under the backorder's reference that never expire
+	if backorder.QuantityFilled > 0 {
+		_, _, err = supabaseClient.From("reservations").Update(map[string]interface{}{
+			"status":     models.ReservationStatusReleased,
+			"updated_at": now,
+		}, "", "").Eq("sku_id", backorder.SkuID.String()).Eq("location_id", backorder.LocationID.String()).Eq("reference", backorderReference(backorder)).Eq("status", models.ReservationStatusActive).Is("expires_at", "null").Execute()
+		if err != nil {
+			fmt.Println(err)
+			backorder.Status = models.BackorderStatusOpen
+			backorder.UpdatedAt = updatedAt
+			if _, _, err := supabaseClient.From("backorders").Update(backorder, "", "").Eq("id", backorderID).Execute(); err != nil {
+				fmt.Println(err)
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot release backorder's reservations in database",
+			})
+		}
+		//The released stock goes to the rest of the queue
+		if err := fillBackorders(supabaseClient, backorder.SkuID, backorder.LocationID); err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Backorder cancelled successfully",
+	})
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -10,6 +11,7 @@ import (
 	"github.com/supabase-community/supabase-go"
 	"ucrs.com/inventory-manager/backend/internal/database"
 	"ucrs.com/inventory-manager/backend/internal/models"
+	"ucrs.com/inventory-manager/backend/pkg"
 )
 
 func CreateBarcode(c *fiber.Ctx) error {
@@ -39,6 +41,22 @@ func CreateBarcode(c *fiber.Ctx) error {
 		})
 	}
 
+	//Pack level barcodes must be for a unit of the same sku
+	if barcode.UnitID != nil {
+		unit, err := fetchUnit(supabaseClient, barcode.UnitID.String())
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch unit from database",
+			})
+		}
+		if unit == nil || unit.SkuID != barcode.SkuID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Unit not found for this SKU",
+			})
+		}
+	}
+
 	//Fetcch userID and apply to barcode
 	userID, err := database.FetchUserID(supabaseClient)
 	if err != nil {
@@ -108,6 +126,22 @@ func UpdateBarcode(c *fiber.Ctx) error {
 		})
 	}
 
+	//Pack level barcodes must be for a unit of the same sku
+	if barcode.UnitID != nil {
+		unit, err := fetchUnit(supabaseClient, barcode.UnitID.String())
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch unit from database",
+			})
+		}
+		if unit == nil || unit.SkuID != barcode.SkuID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Unit not found for this SKU",
+			})
+		}
+	}
+
 	userID, err := database.FetchUserID(supabaseClient)
 	if err != nil {
 		fmt.Println(err)
@@ -224,3 +258,103 @@ func DeleteBarcode(c *fiber.Ctx) error {
 		"message": "Barcode deleted successfully",
 	})
 }
+
+// Resolves a scanned value to its barcode - returns nil if no barcode matches. Plain barcodes are
+// stored as scanned, GS1 ones are stored by GTIN (or as the 13 digit EAN it contains), and the GS1
+// data is returned alongside when the value parses as GS1 with a GTIN. Without one, lot and serial
+// numbers could just be the start of a plain barcode, so they aren't trusted.
+func resolveBarcode(supabaseClient *supabase.Client, value string) (*models.Barcode, *pkg.GS1Data, error) {
+	candidates := []string{value}
+	gs1, err := pkg.ParseGS1(value)
+	if err != nil || gs1.GTIN == "" {
+		gs1 = nil
+	} else {
+		candidates = append(candidates, gs1.GTIN, strings.TrimPrefix(gs1.GTIN, "0"))
+	}
+
+	barcodes, _, err := supabaseClient.From("barcodes").Select("*", "", false).In("barcode_value", candidates).Execute()
+	if err != nil {
+		return nil, nil, err
+	}
+	respStruct := []models.Barcode{}
+	err = json.Unmarshal(barcodes, &respStruct)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(respStruct) == 0 {
+		return nil, gs1, nil
+	}
+	return &respStruct[0], gs1, nil
+}
+
+// Returns the unit a barcode is printed on and how many base units one scan of it is - e.g. a case
+// barcode is 24 eaches
+func barcodeQuantity(supabaseClient *supabase.Client, barcode *models.Barcode) (string, int, error) {
+	sku, err := fetchSKU(supabaseClient, barcode.SkuID.String())
+	if err != nil {
+		return "", 0, err
+	}
+	unitName := baseUnit(sku)
+	if barcode.UnitID == nil {
+		return unitName, 1, nil
+	}
+	unit, err := fetchUnit(supabaseClient, barcode.UnitID.String())
+	if err != nil || unit == nil {
+		return unitName, 1, err
+	}
+	quantity, err := toBaseQuantity(supabaseClient, unit.SkuID, unit.Name, 1)
+	if err != nil {
+		return "", 0, err
+	}
+	return unit.Name, quantity, nil
+}
+
+// ScanBarcode resolves a scanned value to its barcode and SKU. GS1 barcodes are matched on their
+// GTIN (AI 01) and any lot number, expiry date or serial number they carry is returned with them.
+func ScanBarcode(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	request := new(struct {
+		Value string `json:"value"`
+	})
+	if err := c.BodyParser(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	if request.Value == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Barcode value is required",
+		})
+	}
+
+	barcode, gs1, err := resolveBarcode(supabaseClient, request.Value)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch barcode from database",
+		})
+	}
+	if barcode == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Barcode not found",
+		})
+	}
+
+	//A scan counts as one of the barcode's pack level
+	unitName, quantity, err := barcodeQuantity(supabaseClient, barcode)
+	if err != nil {
+		return unitErrorResponse(c, err)
+	}
+
+	resp := fiber.Map{
+		"barcode":  barcode,
+		"sku_id":   barcode.SkuID,
+		"unit":     unitName,
+		"quantity": quantity, //In base units
+	}
+	if gs1 != nil {
+		resp["gs1"] = gs1
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
@@ -0,0 +1,671 @@
+package handlers
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/database"
+	"ucrs.com/inventory-manager/backend/internal/models"
+)
+
+// Fetches a bin by ID - returns nil if it does not exist
+func fetchBin(supabaseClient *supabase.Client, binID string) (*models.Bin, error) {
+	bin, _, err := supabaseClient.From("bins").Select("*", "", false).Eq("id", binID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.Bin{}
+	err = json.Unmarshal(bin, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	if len(respStruct) == 0 {
+		return nil, nil
+	}
+	return &respStruct[0], nil
+}
+
+func fetchWarehouseBins(supabaseClient *supabase.Client, warehouseID string) ([]models.Bin, error) {
+	bins, _, err := supabaseClient.From("bins").Select("*", "", false).Eq("warehouse_id", warehouseID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.Bin{}
+	err = json.Unmarshal(bins, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	return respStruct, nil
+}
+
+// Fetches bin stock, filtered by column (e.g. "warehouse_id" or "bin_id")
+func fetchBinInventory(supabaseClient *supabase.Client, column, value string) ([]models.BinInventory, error) {
+	stock, _, err := supabaseClient.From("bin_inventory").Select("*", "", false).Eq(column, value).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.BinInventory{}
+	err = json.Unmarshal(stock, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	return respStruct, nil
+}
+
+func fetchBinQuantity(supabaseClient *supabase.Client, binID, skuID uuid.UUID) (int, error) {
+	stock, _, err := supabaseClient.From("bin_inventory").Select("quantity", "", false).Eq("bin_id", binID.String()).Eq("sku_id", skuID.String()).Execute()
+	if err != nil {
+		return 0, err
+	}
+	respStruct := []struct {
+		Quantity int `json:"quantity"`
+	}{}
+	err = json.Unmarshal(stock, &respStruct)
+	if err != nil {
+		return 0, err
+	}
+	if len(respStruct) == 0 {
+		return 0, nil
+	}
+	return respStruct[0].Quantity, nil
+}
+
+// Stock of a sku in the warehouse that hasn't been put away into a bin yet
+func fetchUnbinnedQuantity(supabaseClient *supabase.Client, warehouseID, skuID uuid.UUID) (int, error) {
+	onHand, err := fetchOnHandQuantity(supabaseClient, skuID, warehouseID)
+	if err != nil {
+		return 0, err
+	}
+	stock, _, err := supabaseClient.From("bin_inventory").Select("quantity", "", false).Eq("warehouse_id", warehouseID.String()).Eq("sku_id", skuID.String()).Execute()
+	if err != nil {
+		return 0, err
+	}
+	respStruct := []struct {
+		Quantity int `json:"quantity"`
+	}{}
+	err = json.Unmarshal(stock, &respStruct)
+	if err != nil {
+		return 0, err
+	}
+	for _, s := range respStruct {
+		onHand -= s.Quantity
+	}
+	return onHand, nil
+}
+
+// Adds delta to a sku's quantity in a bin
+func adjustBinQuantity(supabaseClient *supabase.Client, bin *models.Bin, skuID, userID uuid.UUID, delta int) error {
+	current, err := fetchBinQuantity(supabaseClient, bin.ID, skuID)
+	if err != nil {
+		return err
+	}
+	if current+delta < 0 {
+		return ErrInsufficientStock
+	}
+	_, _, err = supabaseClient.From("bin_inventory").Upsert(&models.BinInventory{
+		BinID:       bin.ID,
+		SkuID:       skuID,
+		WarehouseID: bin.WarehouseID,
+		UserID:      userID,
+		Quantity:    current + delta,
+		UpdatedAt:   time.Now(),
+	}, "bin_id, sku_id", "", "").Execute()
+	return err
+}
+
+// Takes stock issued from a warehouse out of its bins once its unbinned stock has run out, so the
+// bins never hold more than the warehouse has on hand. Bins holding the least are emptied first.
+func releaseBinStock(supabaseClient *supabase.Client, movement *models.StockMovement, onHand int) error {
+	stock, _, err := supabaseClient.From("bin_inventory").Select("*", "", false).Eq("warehouse_id", movement.LocationID.String()).Eq("sku_id", movement.SkuID.String()).Gt("quantity", "0").Execute()
+	if err != nil {
+		return err
+	}
+	respStruct := []models.BinInventory{}
+	err = json.Unmarshal(stock, &respStruct)
+	if err != nil {
+		return err
+	}
+	excess := -onHand
+	for _, s := range respStruct {
+		excess += s.Quantity
+	}
+	if excess <= 0 {
+		return nil
+	}
+
+	slices.SortFunc(respStruct, func(a, b models.BinInventory) int {
+		return cmp.Compare(a.Quantity, b.Quantity)
+	})
+	for _, s := range respStruct {
+		take := min(excess, s.Quantity)
+		bin := &models.Bin{ID: s.BinID, WarehouseID: s.WarehouseID}
+		err = adjustBinQuantity(supabaseClient, bin, s.SkuID, movement.UserID, -take)
+		if err == nil {
+			err = recordBinMovement(supabaseClient, &models.BinMovement{
+				SkuID:       s.SkuID,
+				WarehouseID: s.WarehouseID,
+				FromBinID:   &bin.ID,
+				Quantity:    take,
+				UserID:      movement.UserID,
+			})
+		}
+		if err != nil {
+			return err
+		}
+		excess -= take
+		if excess == 0 {
+			break
+		}
+	}
+	return nil
+}
+
+func recordBinMovement(supabaseClient *supabase.Client, movement *models.BinMovement) error {
+	movement.ID = uuid.New()
+	movement.CreatedAt = time.Now()
+	_, _, err := supabaseClient.From("bin_movements").Insert(movement, false, "", "", "").Execute()
+	return err
+}
+
+// Builds the bin hierarchy of a warehouse, with stock totals rolled up to every node
+func buildBinTree(bins []models.Bin, stock []models.BinInventory) []*models.BinNode {
+	nodes := map[uuid.UUID]*models.BinNode{}
+	for _, bin := range bins {
+		nodes[bin.ID] = &models.BinNode{Bin: bin, Children: []*models.BinNode{}}
+	}
+	for _, s := range stock {
+		if node, ok := nodes[s.BinID]; ok {
+			node.Quantity += s.Quantity
+		}
+	}
+
+	roots := []*models.BinNode{}
+	for _, bin := range bins {
+		node := nodes[bin.ID]
+		var parent *models.BinNode
+		if bin.ParentID != nil {
+			parent = nodes[*bin.ParentID]
+		}
+		if parent != nil {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	var total func(node *models.BinNode) int
+	total = func(node *models.BinNode) int {
+		node.TotalQuantity = node.Quantity
+		for _, child := range node.Children {
+			node.TotalQuantity += total(child)
+		}
+		return node.TotalQuantity
+	}
+	for _, root := range roots {
+		total(root)
+	}
+	return roots
+}
+
+func CreateBin(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	warehouseID := c.Params("id")
+	bin := new(models.Bin)
+
+	if err := c.BodyParser(bin); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	wid, err := uuid.Parse(warehouseID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid warehouse ID",
+		})
+	}
+	bin.WarehouseID = wid
+
+	// Basic validation
+	if bin.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Bin name is required",
+		})
+	}
+
+	if bin.Type == "" {
+		bin.Type = models.BinTypeBin
+	}
+	if !models.IsValidBinType(bin.Type) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Bin type must be one of aisle, rack, shelf or bin",
+		})
+	}
+
+	if bin.ParentID != nil {
+		parent, err := fetchBin(supabaseClient, bin.ParentID.String())
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch bin from database",
+			})
+		}
+		if parent == nil || parent.WarehouseID != wid {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Parent bin not found in this warehouse",
+			})
+		}
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+	bin.UserID = userID
+	bin.ID = uuid.New()
+	bin.CreatedAt = time.Now()
+
+	//Save to database
+	_, _, err = supabaseClient.From("bins").Insert(bin, false, "", "", "").Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save bin to database",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(bin)
+}
+
+func GetBins(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	warehouseID := c.Params("id")
+
+	bins, err := fetchWarehouseBins(supabaseClient, warehouseID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch bins from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(bins)
+}
+
+// Deletes a bin - only empty bins with nothing below them can be deleted
+func DeleteBin(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	binID := c.Params("id")
+
+	children, _, err := supabaseClient.From("bins").Select("id", "", false).Eq("parent_id", binID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch bins from database",
+		})
+	}
+	respChildren := []struct {
+		ID uuid.UUID `json:"id"`
+	}{}
+	err = json.Unmarshal(children, &respChildren)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal bins from database",
+		})
+	}
+	if len(respChildren) > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Bin has child locations",
+		})
+	}
+
+	stock, err := fetchBinInventory(supabaseClient, "bin_id", binID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch bin inventory from database",
+		})
+	}
+	for _, s := range stock {
+		if s.Quantity > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Bin still holds stock",
+			})
+		}
+	}
+
+	_, _, err = supabaseClient.From("bin_inventory").Delete("", "").Eq("bin_id", binID).Execute()
+	if err == nil {
+		_, _, err = supabaseClient.From("bins").Delete("", "").Eq("id", binID).Execute()
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot delete bin from database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Bin deleted successfully",
+	})
+}
+
+func GetBinInventory(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	binID := c.Params("id")
+
+	stock, err := fetchBinInventory(supabaseClient, "bin_id", binID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch bin inventory from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(stock)
+}
+
+// Puts away warehouse stock that isn't in a bin yet into a bin
+func PutawayToBin(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	binID := c.Params("id")
+	request := new(struct {
+		SkuID    uuid.UUID `json:"sku_id"`
+		Quantity int       `json:"quantity"`
+		Unit     string    `json:"unit"`
+	})
+	if err := c.BodyParser(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	if request.SkuID == uuid.Nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "SKU ID is required",
+		})
+	}
+
+	if request.Quantity <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Quantity must be greater than 0",
+		})
+	}
+
+	quantity, err := toBaseQuantity(supabaseClient, request.SkuID, request.Unit, request.Quantity)
+	if err != nil {
+		return unitErrorResponse(c, err)
+	}
+	request.Quantity = quantity
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	bin, err := fetchBin(supabaseClient, binID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch bin from database",
+		})
+	}
+	if bin == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Bin not found",
+		})
+	}
+
+	unbinned, err := fetchUnbinnedQuantity(supabaseClient, bin.WarehouseID, request.SkuID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch inventory from database",
+		})
+	}
+	if unbinned < request.Quantity {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":    "Not enough stock waiting for putaway in this warehouse",
+			"unbinned": unbinned,
+		})
+	}
+
+	err = adjustBinQuantity(supabaseClient, bin, request.SkuID, userID, request.Quantity)
+	if err == nil {
+		err = recordBinMovement(supabaseClient, &models.BinMovement{
+			SkuID:       request.SkuID,
+			WarehouseID: bin.WarehouseID,
+			ToBinID:     &bin.ID,
+			Quantity:    request.Quantity,
+			UserID:      userID,
+		})
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot update bin inventory in database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Stock put away successfully",
+	})
+}
+
+// Moves stock from one bin to another in the same warehouse
+func MoveBinStock(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	request := new(struct {
+		SkuID     uuid.UUID `json:"sku_id"`
+		FromBinID uuid.UUID `json:"from_bin_id"`
+		ToBinID   uuid.UUID `json:"to_bin_id"`
+		Quantity  int       `json:"quantity"`
+		Unit      string    `json:"unit"`
+	})
+	if err := c.BodyParser(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	if request.SkuID == uuid.Nil || request.FromBinID == uuid.Nil || request.ToBinID == uuid.Nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "SKU ID, from bin ID and to bin ID are required",
+		})
+	}
+
+	if request.FromBinID == request.ToBinID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "From and to bins must be different",
+		})
+	}
+
+	if request.Quantity <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Quantity must be greater than 0",
+		})
+	}
+
+	quantity, err := toBaseQuantity(supabaseClient, request.SkuID, request.Unit, request.Quantity)
+	if err != nil {
+		return unitErrorResponse(c, err)
+	}
+	request.Quantity = quantity
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	from, err := fetchBin(supabaseClient, request.FromBinID.String())
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch bin from database",
+		})
+	}
+	to, err := fetchBin(supabaseClient, request.ToBinID.String())
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch bin from database",
+		})
+	}
+	if from == nil || to == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Bin not found",
+		})
+	}
+	if from.WarehouseID != to.WarehouseID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Bins must be in the same warehouse - use a transfer to move stock between warehouses",
+		})
+	}
+
+	err = adjustBinQuantity(supabaseClient, from, request.SkuID, userID, -request.Quantity)
+	if errors.Is(err, ErrInsufficientStock) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Insufficient stock in bin",
+		})
+	}
+	if err == nil {
+		err = adjustBinQuantity(supabaseClient, to, request.SkuID, userID, request.Quantity)
+	}
+	if err == nil {
+		err = recordBinMovement(supabaseClient, &models.BinMovement{
+			SkuID:       request.SkuID,
+			WarehouseID: from.WarehouseID,
+			FromBinID:   &from.ID,
+			ToBinID:     &to.ID,
+			Quantity:    request.Quantity,
+			UserID:      userID,
+		})
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot update bin inventory in database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Stock moved successfully",
+	})
+}
+
+// Picks stock out of a bin, shipping it out of the warehouse
+func PickFromBin(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	binID := c.Params("id")
+	request := new(struct {
+		SkuID     uuid.UUID `json:"sku_id"`
+		Quantity  int       `json:"quantity"`
+		Unit      string    `json:"unit"`
+		Reference string    `json:"reference"`
+	})
+	if err := c.BodyParser(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	if request.SkuID == uuid.Nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "SKU ID is required",
+		})
+	}
+
+	if request.Quantity <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Quantity must be greater than 0",
+		})
+	}
+
+	quantity, err := toBaseQuantity(supabaseClient, request.SkuID, request.Unit, request.Quantity)
+	if err != nil {
+		return unitErrorResponse(c, err)
+	}
+	request.Quantity = quantity
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	bin, err := fetchBin(supabaseClient, binID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch bin from database",
+		})
+	}
+	if bin == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Bin not found",
+		})
+	}
+
+	inBin, err := fetchBinQuantity(supabaseClient, bin.ID, request.SkuID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch bin inventory from database",
+		})
+	}
+	if inBin < request.Quantity {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Insufficient stock in bin",
+		})
+	}
+
+	inventory, err := recordStockMovement(supabaseClient, &models.StockMovement{
+		SkuID:      request.SkuID,
+		LocationID: bin.WarehouseID,
+		UserID:     userID,
+		Quantity:   -request.Quantity,
+		Reason:     models.MovementReasonShipment,
+		Reference:  request.Reference,
+		BinID:      &bin.ID,
+	})
+	if errors.Is(err, ErrInsufficientStock) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Insufficient available stock - it may be reserved",
+		})
+	}
+	if errors.Is(err, ErrSerialRequired) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Serialized SKUs must be shipped by serial number",
+		})
+	}
+	if err == nil {
+		err = recordBinMovement(supabaseClient, &models.BinMovement{
+			SkuID:       request.SkuID,
+			WarehouseID: bin.WarehouseID,
+			FromBinID:   &bin.ID,
+			Quantity:    request.Quantity,
+			UserID:      userID,
+		})
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot update inventory in database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(inventory)
+}
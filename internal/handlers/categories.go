@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"cmp"
 	"encoding/json"
 	"fmt"
+	"slices"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
@@ -29,6 +32,25 @@ func CreateCategory(c *fiber.Ctx) error {
 
 	category.ID = uuid.New()
 
+	//Top level categories have no parent, however the request puts it
+	if category.ParentID != nil && *category.ParentID == uuid.Nil {
+		category.ParentID = nil
+	}
+	if category.ParentID != nil {
+		parent, err := fetchCategory(supabaseClient, category.ParentID.String())
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch category from database",
+			})
+		}
+		if parent == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Parent category not found",
+			})
+		}
+	}
+
 	//Fetch userID and apply to category
 	userID, err := database.FetchUserID(supabaseClient)
 	if err != nil {
@@ -77,6 +99,24 @@ func UpdateCategory(c *fiber.Ctx) error {
 		})
 	}
 
+	if category.ParentID != nil && *category.ParentID == uuid.Nil {
+		category.ParentID = nil
+	}
+
+	//A new parent mustn't put the category below itself
+	if category.ParentID != nil {
+		categories, err := fetchAllCategories(supabaseClient)
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch categories from database",
+			})
+		}
+		if err := validateCategoryParent(categories, cid, *category.ParentID); err != nil {
+			return validationErrorResponse(c, err, "Cannot validate parent category")
+		}
+	}
+
 	userID, err := database.FetchUserID(supabaseClient)
 	if err != nil {
 		fmt.Println(err)
@@ -167,12 +207,102 @@ func GetCategory(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusOK).JSON(respStruct[0])
 }
 
+// Deletes a category. ?policy= decides what happens to what is in it: restrict (the default) refuses
+// while it has child categories or products, reparent moves them up to its parent - or to the top
+// level and uncategorised when it has none - and cascade deletes everything below it too, leaving
+// its products without those categories.
 func DeleteCategory(c *fiber.Ctx) error {
 	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
 	categoryID := c.Params("id")
 
+	policy := c.Query("policy", models.CategoryDeleteRestrict)
+	if !models.IsValidCategoryDeletePolicy(policy) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Policy must be one of restrict, reparent or cascade",
+		})
+	}
+
+	categories, err := fetchAllCategories(supabaseClient)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch categories from database",
+		})
+	}
+	var category *models.Category
+	children := []string{}
+	for i := range categories {
+		if categories[i].ID.String() == categoryID {
+			category = &categories[i]
+		}
+		if categories[i].ParentID != nil && categories[i].ParentID.String() == categoryID {
+			children = append(children, categories[i].ID.String())
+		}
+	}
+	if category == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Category not found",
+		})
+	}
+
+	//Everything the delete takes with it - the category, and with cascade the categories below it
+	deleted := []string{categoryID}
+	if policy == models.CategoryDeleteCascade {
+		deleted = []string{}
+		for _, id := range categorySubtree(categories, category.ID) {
+			deleted = append(deleted, id.String())
+		}
+	}
+	productIDs, err := fetchCategoryProductIDs(supabaseClient, deleted)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch category products from database",
+		})
+	}
+
+	resp := fiber.Map{
+		"message": "Category deleted successfully",
+		"policy":  policy,
+	}
+	switch policy {
+	case models.CategoryDeleteRestrict:
+		if len(children) > 0 || len(productIDs) > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":      "Category has child categories or products - delete with ?policy=reparent or ?policy=cascade",
+				"categories": len(children),
+				"products":   len(productIDs),
+			})
+		}
+	case models.CategoryDeleteReparent:
+		err = reparentCategoryContents(supabaseClient, category, children)
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot move category contents in database",
+			})
+		}
+		resp["categories_moved"] = len(children)
+		resp["products_moved"] = len(productIDs)
+	case models.CategoryDeleteCascade:
+		_, _, err = supabaseClient.From("products").Update(map[string]interface{}{
+			"category_id": nil,
+		}, "", "").In("category_id", deleted).Execute()
+		if err == nil {
+			_, _, err = supabaseClient.From("product_categories").Delete("", "").In("category_id", deleted).Execute()
+		}
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot unassign category products in database",
+			})
+		}
+		resp["categories_deleted"] = len(deleted)
+		resp["products_unassigned"] = len(productIDs)
+	}
+
 	//Save to database
-	_, _, err := supabaseClient.From("categories").Delete("", "").Eq("id", categoryID).Execute()
+	_, _, err = supabaseClient.From("categories").Delete("", "").In("id", deleted).Execute()
 	if err != nil {
 		fmt.Println(err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -181,7 +311,391 @@ func DeleteCategory(c *fiber.Ctx) error {
 	}
 
 	//Positive result shows even if RLS policy blocks it
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"message": "Category deleted successfully",
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+// Moves a category's children and products up to its parent, ahead of it being deleted. Secondary
+// assignments move to the parent too, unless the product is already in it. Without a parent the
+// children become top level and the products lose the category.
+func reparentCategoryContents(supabaseClient *supabase.Client, category *models.Category, children []string) error {
+	parentID := category.ParentID
+
+	if len(children) > 0 {
+		_, _, err := supabaseClient.From("categories").Update(map[string]interface{}{
+			"parent_id": parentID,
+		}, "", "").In("id", children).Execute()
+		if err != nil {
+			return err
+		}
+	}
+	_, _, err := supabaseClient.From("products").Update(map[string]interface{}{
+		"category_id": parentID,
+		"updated_at":  time.Now(),
+	}, "", "").Eq("category_id", category.ID.String()).Execute()
+	if err != nil {
+		return err
+	}
+
+	assignments, _, err := supabaseClient.From("product_categories").Select("*", "", false).Eq("category_id", category.ID.String()).Execute()
+	if err != nil {
+		return err
+	}
+	respAssignments := []models.ProductCategory{}
+	err = json.Unmarshal(assignments, &respAssignments)
+	if err != nil {
+		return err
+	}
+	if parentID != nil && len(respAssignments) > 0 {
+		inParent, err := fetchCategoryProductIDs(supabaseClient, []string{parentID.String()})
+		if err != nil {
+			return err
+		}
+		moved := []models.ProductCategory{}
+		for _, assignment := range respAssignments {
+			if !slices.Contains(inParent, assignment.ProductID.String()) {
+				assignment.CategoryID = *parentID
+				moved = append(moved, assignment)
+			}
+		}
+		if len(moved) > 0 {
+			_, _, err = supabaseClient.From("product_categories").Insert(moved, false, "", "", "").Execute()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	_, _, err = supabaseClient.From("product_categories").Delete("", "").Eq("category_id", category.ID.String()).Execute()
+	return err
+}
+
+// Fetches a category - returns nil if it does not exist
+func fetchCategory(supabaseClient *supabase.Client, categoryID string) (*models.Category, error) {
+	category, _, err := supabaseClient.From("categories").Select("*", "", false).Eq("id", categoryID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.Category{}
+	err = json.Unmarshal(category, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	if len(respStruct) == 0 {
+		return nil, nil
+	}
+	return &respStruct[0], nil
+}
+
+// Collects a category and every category below it, top down
+func categorySubtree(categories []models.Category, categoryID uuid.UUID) []uuid.UUID {
+	children := map[uuid.UUID][]uuid.UUID{}
+	for _, category := range categories {
+		if category.ParentID != nil {
+			children[*category.ParentID] = append(children[*category.ParentID], category.ID)
+		}
+	}
+	subtree := []uuid.UUID{categoryID}
+	seen := map[uuid.UUID]bool{categoryID: true}
+	for i := 0; i < len(subtree); i++ {
+		for _, child := range children[subtree[i]] {
+			if !seen[child] {
+				seen[child] = true
+				subtree = append(subtree, child)
+			}
+		}
+	}
+	return subtree
+}
+
+// Fetches the IDs of the categories a category filter covers - the category itself, and every category
+// below it when includeDescendants is set
+func fetchCategoryScope(supabaseClient *supabase.Client, categoryID uuid.UUID, includeDescendants bool) ([]string, error) {
+	if !includeDescendants {
+		return []string{categoryID.String()}, nil
+	}
+	categories := []models.Category{}
+	err := selectAll(supabaseClient, "categories", "id, parent_id", &categories)
+	if err != nil {
+		return nil, err
+	}
+	scope := []string{}
+	for _, id := range categorySubtree(categories, categoryID) {
+		scope = append(scope, id.String())
+	}
+	return scope, nil
+}
+
+// Fetches the IDs of the products in any of the categories, as their primary or a secondary category
+func fetchCategoryProductIDs(supabaseClient *supabase.Client, categoryIDs []string) ([]string, error) {
+	primary, _, err := supabaseClient.From("products").Select("id", "", false).In("category_id", categoryIDs).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respPrimary := []models.Product{}
+	err = json.Unmarshal(primary, &respPrimary)
+	if err != nil {
+		return nil, err
+	}
+	secondary, _, err := supabaseClient.From("product_categories").Select("product_id", "", false).In("category_id", categoryIDs).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respSecondary := []models.ProductCategory{}
+	err = json.Unmarshal(secondary, &respSecondary)
+	if err != nil {
+		return nil, err
+	}
+
+	productIDs := []string{}
+	seen := map[uuid.UUID]bool{}
+	for _, product := range respPrimary {
+		if !seen[product.ID] {
+			seen[product.ID] = true
+			productIDs = append(productIDs, product.ID.String())
+		}
+	}
+	for _, assignment := range respSecondary {
+		if !seen[assignment.ProductID] {
+			seen[assignment.ProductID] = true
+			productIDs = append(productIDs, assignment.ProductID.String())
+		}
+	}
+	return productIDs, nil
+}
+
+// Lists the products in a category, as their primary or a secondary category. ?include_descendants=true
+// includes the products of every category below it.
+func GetCategoryProducts(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	categoryID := c.Params("id")
+
+	category, err := fetchCategory(supabaseClient, categoryID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch category from database",
+		})
+	}
+	if category == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Category not found",
+		})
+	}
+
+	scope, err := fetchCategoryScope(supabaseClient, category.ID, c.Query("include_descendants") == "true")
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch categories from database",
+		})
+	}
+	productIDs, err := fetchCategoryProductIDs(supabaseClient, scope)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch category products from database",
+		})
+	}
+	respStruct := []models.Product{}
+	if len(productIDs) == 0 {
+		return c.Status(fiber.StatusOK).JSON(respStruct)
+	}
+
+	products, _, err := supabaseClient.From("products").Select("*", "", false).In("id", productIDs).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch products from database",
+		})
+	}
+	err = json.Unmarshal(products, &respStruct)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal products from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(respStruct)
+}
+
+// Fetches every category, to walk the tree
+func fetchAllCategories(supabaseClient *supabase.Client) ([]models.Category, error) {
+	categories := []models.Category{}
+	err := selectAll(supabaseClient, "categories", "*", &categories)
+	if err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+// Checks a category can be placed under parentID - the parent must exist, and mustn't be the category
+// itself or any category below it, which would make a cycle. Returns fiber errors.
+func validateCategoryParent(categories []models.Category, categoryID, parentID uuid.UUID) error {
+	if parentID == uuid.Nil {
+		return nil
+	}
+	if !slices.ContainsFunc(categories, func(category models.Category) bool { return category.ID == parentID }) {
+		return fiber.NewError(fiber.StatusBadRequest, "Parent category not found")
+	}
+	if slices.Contains(categorySubtree(categories, categoryID), parentID) {
+		return fiber.NewError(fiber.StatusBadRequest, "A category cannot be moved below itself or one of its descendants")
+	}
+	return nil
+}
+
+// Builds the category hierarchy - categories whose parent is missing are treated as top level.
+// Siblings are sorted by name.
+func buildCategoryTree(categories []models.Category) []*models.CategoryNode {
+	nodes := map[uuid.UUID]*models.CategoryNode{}
+	for _, category := range categories {
+		nodes[category.ID] = &models.CategoryNode{Category: category, Children: []*models.CategoryNode{}}
+	}
+
+	roots := []*models.CategoryNode{}
+	for _, category := range categories {
+		node := nodes[category.ID]
+		var parent *models.CategoryNode
+		if category.ParentID != nil && *category.ParentID != category.ID {
+			parent = nodes[*category.ParentID]
+		}
+		if parent != nil {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	byName := func(a, b *models.CategoryNode) int {
+		return cmp.Compare(a.Name, b.Name)
+	}
+	for _, node := range nodes {
+		slices.SortFunc(node.Children, byName)
+	}
+	slices.SortFunc(roots, byName)
+	return roots
+}
+
+// The categories from the top of the tree down to a category, ending with it - nil if it doesn't exist
+func categoryPath(categories []models.Category, categoryID uuid.UUID) []models.Category {
+	byID := map[uuid.UUID]models.Category{}
+	for _, category := range categories {
+		byID[category.ID] = category
+	}
+	path := []models.Category{}
+	seen := map[uuid.UUID]bool{}
+	for id := categoryID; id != uuid.Nil && !seen[id]; {
+		category, ok := byID[id]
+		if !ok {
+			break
+		}
+		seen[id] = true
+		path = append(path, category)
+		id = uuid.Nil
+		if category.ParentID != nil {
+			id = *category.ParentID
+		}
+	}
+	if len(path) == 0 {
+		return nil
+	}
+	slices.Reverse(path)
+	return path
+}
+
+// Gets the whole category hierarchy as nested categories
+func GetCategoryTree(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	categories, err := fetchAllCategories(supabaseClient)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch categories from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(buildCategoryTree(categories))
+}
+
+// Gets the breadcrumbs of a category - every category from the top of the tree down to it
+func GetCategoryPath(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	categoryID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid category ID",
+		})
+	}
+
+	categories, err := fetchAllCategories(supabaseClient)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch categories from database",
+		})
+	}
+	path := categoryPath(categories, categoryID)
+	if path == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Category not found",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(path)
+}
+
+// Moves a category, with everything below it, under a new parent - or to the top level when
+// parent_id is null. Moves that would put a category below itself are rejected.
+func MoveCategory(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	categoryID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid category ID",
+		})
+	}
+	request := new(struct {
+		ParentID *uuid.UUID `json:"parent_id"`
 	})
+	if err := c.BodyParser(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+	if request.ParentID != nil && *request.ParentID == uuid.Nil {
+		request.ParentID = nil
+	}
+
+	categories, err := fetchAllCategories(supabaseClient)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch categories from database",
+		})
+	}
+	index := slices.IndexFunc(categories, func(category models.Category) bool { return category.ID == categoryID })
+	if index == -1 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Category not found",
+		})
+	}
+	category := categories[index]
+
+	parentID := uuid.Nil
+	if request.ParentID != nil {
+		parentID = *request.ParentID
+	}
+	if err := validateCategoryParent(categories, categoryID, parentID); err != nil {
+		return validationErrorResponse(c, err, "Cannot validate parent category")
+	}
+
+	//Only the category itself changes - its subtree comes with it
+	_, _, err = supabaseClient.From("categories").Update(map[string]interface{}{
+		"parent_id": request.ParentID,
+	}, "", "").Eq("id", categoryID.String()).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save category to database",
+		})
+	}
+
+	category.ParentID = request.ParentID
+	return c.Status(fiber.StatusOK).JSON(category)
 }
@@ -10,6 +10,7 @@ import (
 	"github.com/supabase-community/supabase-go"
 	"ucrs.com/inventory-manager/backend/internal/database"
 	"ucrs.com/inventory-manager/backend/internal/models"
+	"ucrs.com/inventory-manager/backend/pkg"
 )
 
 func CreateCompany(c *fiber.Ctx) error {
@@ -29,6 +30,22 @@ func CreateCompany(c *fiber.Ctx) error {
 		})
 	}
 
+	if company.CostingMethod == "" {
+		company.CostingMethod = models.CostingMethodFIFO
+	}
+	if !models.IsValidCostingMethod(company.CostingMethod) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid costing method",
+		})
+	}
+	if company.SKUTemplate != "" {
+		if err := pkg.ValidateSKUTemplate(company.SKUTemplate); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid SKU template: " + err.Error(),
+			})
+		}
+	}
+
 	company.ID = uuid.New()
 	uid, err := database.FetchUserID(supabaseClient)
 	if err != nil {
@@ -110,7 +127,48 @@ func UpdateCompany(c *fiber.Ctx) error {
 			"error": "Cannot unmarshal company from request body",
 		})
 	}
+	//The SKU template is kept when left out of the body - an empty one clears it
+	given := new(struct {
+		SKUTemplate *string `json:"sku_template"`
+	})
+	if err := c.BodyParser(given); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+	if company.CostingMethod != "" && !models.IsValidCostingMethod(company.CostingMethod) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid costing method",
+		})
+	}
+	if company.SKUTemplate != "" {
+		if err := pkg.ValidateSKUTemplate(company.SKUTemplate); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid SKU template: " + err.Error(),
+			})
+		}
+	}
 	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	if given.SKUTemplate == nil {
+		stored, _, err := supabaseClient.From("companies").Select("sku_template", "", false).Eq("id", companyid).Execute()
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch company from database",
+			})
+		}
+		respStored := []models.Company{}
+		err = json.Unmarshal(stored, &respStored)
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot unmarshal company from database",
+			})
+		}
+		if len(respStored) > 0 {
+			company.SKUTemplate = respStored[0].SKUTemplate
+		}
+	}
 	cid, err := uuid.Parse(companyid)
 	if err != nil {
 		fmt.Println(err)
@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supabase-community/postgrest-go"
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/models"
+)
+
+// Fetches the cost layers of a sku at a location that still hold stock, oldest first
+func fetchCostLayers(supabaseClient *supabase.Client, skuID, locationID uuid.UUID) ([]models.CostLayer, error) {
+	layers, _, err := supabaseClient.From("cost_layers").Select("*", "", false).Eq("sku_id", skuID.String()).Eq("location_id", locationID.String()).Gt("remaining", "0").Order("created_at", &postgrest.OrderOpts{Ascending: true}).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.CostLayer{}
+	err = json.Unmarshal(layers, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	return respStruct, nil
+}
+
+// Fetches the moving average cost of a sku at every location holding it
+func fetchAverageCosts(supabaseClient *supabase.Client, skuID uuid.UUID) ([]models.AverageCost, error) {
+	costs, _, err := supabaseClient.From("average_costs").Select("*", "", false).Eq("sku_id", skuID.String()).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.AverageCost{}
+	err = json.Unmarshal(costs, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	return respStruct, nil
+}
+
+// Works out the unit cost of stock coming in without one - e.g. returns and count gains. Transfers
+// in carry the cost the stock left its source at. Uses the average cost at the location, then the average across all locations, then the
+// sku's standard cost.
+func fallbackUnitCost(supabaseClient *supabase.Client, skuID, locationID uuid.UUID, costs []models.AverageCost) (float64, error) {
+	quantity := 0
+	value := 0.0
+	for _, cost := range costs {
+		if cost.Quantity <= 0 {
+			continue
+		}
+		if cost.LocationID == locationID {
+			return cost.UnitCost, nil
+		}
+		quantity += cost.Quantity
+		value += float64(cost.Quantity) * cost.UnitCost
+	}
+	if quantity > 0 {
+		return value / float64(quantity), nil
+	}
+
+	sku, err := fetchSKU(supabaseClient, skuID.String())
+	if err != nil || sku == nil {
+		return 0, err
+	}
+	return sku.StandardCost, nil
+}
+
+// The moving average of a sku at a movement's location - a new one when the location has none yet
+func locationAverageCost(costs []models.AverageCost, movement *models.StockMovement) *models.AverageCost {
+	for _, cost := range costs {
+		if cost.LocationID == movement.LocationID {
+			return &cost
+		}
+	}
+	return &models.AverageCost{
+		SkuID:      movement.SkuID,
+		LocationID: movement.LocationID,
+	}
+}
+
+// Adds a layer of stock coming in at a unit cost, and moves the average towards it
+func addCostLayer(supabaseClient *supabase.Client, movement *models.StockMovement, unitCost float64, createdAt time.Time, average *models.AverageCost) error {
+	_, _, err := supabaseClient.From("cost_layers").Insert(&models.CostLayer{
+		ID:         uuid.New(),
+		SkuID:      movement.SkuID,
+		LocationID: movement.LocationID,
+		UserID:     movement.UserID,
+		MovementID: movement.ID,
+		UnitCost:   unitCost,
+		Quantity:   movement.Quantity,
+		Remaining:  movement.Quantity,
+		CreatedAt:  createdAt,
+	}, false, "", "", "").Execute()
+	if err != nil {
+		return err
+	}
+
+	held := max(average.Quantity, 0)
+	average.UnitCost = (float64(held)*average.UnitCost + float64(movement.Quantity)*unitCost) / float64(held+movement.Quantity)
+	average.Quantity = held + movement.Quantity
+	return nil
+}
+
+// The unit cost stock leaves a location at under the company's costing method - the cost of the
+// layers it was taken from under fifo, the location's average, or the sku's standard cost
+func issueUnitCost(supabaseClient *supabase.Client, movement *models.StockMovement, average *models.AverageCost, layeredCost float64) (float64, error) {
+	//Users outside a company have no method of their own, so fifo applies
+	method, err := fetchCostingMethod(supabaseClient)
+	if err != nil {
+		method = models.CostingMethodFIFO
+	}
+	switch method {
+	case models.CostingMethodAverage:
+		return average.UnitCost, nil
+	case models.CostingMethodStandard:
+		sku, err := fetchSKU(supabaseClient, movement.SkuID.String())
+		if err != nil || sku == nil {
+			return 0, err
+		}
+		return sku.StandardCost, nil
+	}
+	return layeredCost, nil
+}
+
+// Updates the cost layers and moving average of a sku at a location for a recorded movement.
+// Stock coming in adds a layer at its unit cost; stock going out consumes the oldest layers first,
+// and is given the unit cost it left at.
+func applyMovementCost(supabaseClient *supabase.Client, movement *models.StockMovement) error {
+	costs, err := fetchAverageCosts(supabaseClient, movement.SkuID)
+	if err != nil {
+		return err
+	}
+	average := locationAverageCost(costs, movement)
+
+	if movement.Quantity > 0 {
+		var unitCost float64
+		if movement.UnitCost != nil {
+			unitCost = *movement.UnitCost
+		} else {
+			unitCost, err = fallbackUnitCost(supabaseClient, movement.SkuID, movement.LocationID, costs)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = addCostLayer(supabaseClient, movement, unitCost, movement.CreatedAt, average)
+		if err != nil {
+			return err
+		}
+	} else {
+		layers, err := fetchCostLayers(supabaseClient, movement.SkuID, movement.LocationID)
+		if err != nil {
+			return err
+		}
+		//Stock held from before costing was recorded has no layers, so may run out before the issue does
+		outstanding := -movement.Quantity
+		layeredValue := 0.0
+		for _, layer := range layers {
+			if outstanding == 0 {
+				break
+			}
+			taken := min(layer.Remaining, outstanding)
+			outstanding -= taken
+			layeredValue += float64(taken) * layer.UnitCost
+			_, _, err = supabaseClient.From("cost_layers").Update(map[string]interface{}{
+				"remaining": layer.Remaining - taken,
+			}, "", "").Eq("id", layer.ID.String()).Execute()
+			if err != nil {
+				return err
+			}
+		}
+
+		//Record what the stock left at, so stock moved elsewhere arrives at the same cost
+		if movement.UnitCost == nil && movement.Quantity < 0 {
+			unitCost, err := issueUnitCost(supabaseClient, movement, average, (layeredValue+float64(outstanding)*average.UnitCost)/float64(-movement.Quantity))
+			if err != nil {
+				return err
+			}
+			movement.UnitCost = &unitCost
+			//The layers are already consumed, so the average is still brought up to date if this fails
+			_, _, err = supabaseClient.From("stock_movements").Update(map[string]interface{}{
+				"unit_cost": unitCost,
+			}, "", "").Eq("id", movement.ID.String()).Execute()
+			if err != nil {
+				fmt.Println(err)
+			}
+		}
+		average.Quantity += movement.Quantity
+	}
+
+	average.UserID = movement.UserID
+	average.UpdatedAt = movement.CreatedAt
+	_, _, err = supabaseClient.From("average_costs").Upsert(average, "sku_id, location_id", "", "").Execute()
+	return err
+}
+
+// Undoes the cost of a movement being reversed. Stock that came in takes its own layer back out,
+// rather than the oldest, and leaves the average as it was before. Stock that went out comes back
+// as a layer at the cost it left at, ahead of the layers it was issued before.
+func reverseMovementCost(supabaseClient *supabase.Client, recorded, reversal *models.StockMovement) error {
+	costs, err := fetchAverageCosts(supabaseClient, recorded.SkuID)
+	if err != nil {
+		return err
+	}
+	average := locationAverageCost(costs, recorded)
+
+	if recorded.Quantity > 0 {
+		layers, _, err := supabaseClient.From("cost_layers").Select("*", "", false).Eq("movement_id", recorded.ID.String()).Execute()
+		if err != nil {
+			return err
+		}
+		respLayers := []models.CostLayer{}
+		err = json.Unmarshal(layers, &respLayers)
+		if err != nil {
+			return err
+		}
+		unitCost := average.UnitCost
+		if len(respLayers) > 0 {
+			layer := respLayers[0]
+			unitCost = layer.UnitCost
+			_, _, err = supabaseClient.From("cost_layers").Update(map[string]interface{}{
+				"remaining": max(layer.Remaining-recorded.Quantity, 0),
+			}, "", "").Eq("id", layer.ID.String()).Execute()
+			if err != nil {
+				return err
+			}
+		}
+
+		held := average.Quantity - recorded.Quantity
+		if held > 0 {
+			average.UnitCost = max((float64(average.Quantity)*average.UnitCost-float64(recorded.Quantity)*unitCost)/float64(held), 0)
+		}
+		average.Quantity = held
+	} else {
+		var unitCost float64
+		if recorded.UnitCost != nil {
+			unitCost = *recorded.UnitCost
+		} else {
+			unitCost, err = fallbackUnitCost(supabaseClient, recorded.SkuID, recorded.LocationID, costs)
+			if err != nil {
+				return err
+			}
+		}
+		layers, err := fetchCostLayers(supabaseClient, recorded.SkuID, recorded.LocationID)
+		if err != nil {
+			return err
+		}
+		createdAt := reversal.CreatedAt
+		if len(layers) > 0 && layers[0].CreatedAt.Before(createdAt) {
+			createdAt = layers[0].CreatedAt
+		}
+		err = addCostLayer(supabaseClient, reversal, unitCost, createdAt, average)
+		if err != nil {
+			return err
+		}
+	}
+
+	average.UserID = recorded.UserID
+	average.UpdatedAt = reversal.CreatedAt
+	_, _, err = supabaseClient.From("average_costs").Upsert(average, "sku_id, location_id", "", "").Execute()
+	return err
+}
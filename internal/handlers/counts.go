@@ -0,0 +1,624 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/database"
+	"ucrs.com/inventory-manager/backend/internal/models"
+)
+
+// Identifies a count line - bin is uuid.Nil for warehouse level counts
+type countKey struct {
+	SkuID uuid.UUID
+	BinID uuid.UUID
+}
+
+func countLineKey(skuID uuid.UUID, binID *uuid.UUID) countKey {
+	if binID == nil {
+		return countKey{skuID, uuid.Nil}
+	}
+	return countKey{skuID, *binID}
+}
+
+// Fills in the counted quantity and variance of each line from the session's entries
+func applyCountEntries(lines []models.CountLine, entries []models.CountEntry) []models.CountLine {
+	counted := map[countKey]int{}
+	seen := map[countKey]bool{}
+	for _, entry := range entries {
+		key := countLineKey(entry.SkuID, entry.BinID)
+		counted[key] += entry.Quantity
+		seen[key] = true
+	}
+	for i := range lines {
+		key := countLineKey(lines[i].SkuID, lines[i].BinID)
+		if !seen[key] {
+			continue
+		}
+		quantity := counted[key]
+		variance := quantity - lines[i].SystemQuantity
+		lines[i].Counted = &quantity
+		lines[i].Variance = &variance
+	}
+	return lines
+}
+
+// Fetches a count session - returns nil if it does not exist
+func fetchCountSession(supabaseClient *supabase.Client, sessionID string) (*models.CountSession, error) {
+	session, _, err := supabaseClient.From("count_sessions").Select("*", "", false).Eq("id", sessionID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.CountSession{}
+	err = json.Unmarshal(session, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	if len(respStruct) == 0 {
+		return nil, nil
+	}
+	return &respStruct[0], nil
+}
+
+// Fetches a session's lines with their counts applied
+func fetchCountLines(supabaseClient *supabase.Client, sessionID string) ([]models.CountLine, error) {
+	lines, _, err := supabaseClient.From("count_lines").Select("*", "", false).Eq("session_id", sessionID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respLines := []models.CountLine{}
+	err = json.Unmarshal(lines, &respLines)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, _, err := supabaseClient.From("count_entries").Select("*", "", false).Eq("session_id", sessionID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respEntries := []models.CountEntry{}
+	err = json.Unmarshal(entries, &respEntries)
+	if err != nil {
+		return nil, err
+	}
+
+	return applyCountEntries(respLines, respEntries), nil
+}
+
+// Current system quantity for a count line - bin stock for bin counts, otherwise warehouse stock
+func fetchSystemQuantity(supabaseClient *supabase.Client, warehouseID, skuID uuid.UUID, binID *uuid.UUID) (int, error) {
+	if binID != nil {
+		return fetchBinQuantity(supabaseClient, *binID, skuID)
+	}
+	return fetchOnHandQuantity(supabaseClient, skuID, warehouseID)
+}
+
+// Opens a count session, snapshotting the system quantity of everything in scope so the
+// variance can be shown against what the system thought was there
+func CreateCountSession(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	session := new(models.CountSession)
+
+	if err := c.BodyParser(session); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	if session.WarehouseID == uuid.Nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Warehouse ID is required",
+		})
+	}
+
+	for _, binID := range session.BinIDs {
+		bin, err := fetchBin(supabaseClient, binID.String())
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch bin from database",
+			})
+		}
+		if bin == nil || bin.WarehouseID != session.WarehouseID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  "Bin not found in this warehouse",
+				"bin_id": binID,
+			})
+		}
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	now := time.Now()
+	session.ID = uuid.New()
+	session.UserID = userID
+	session.Status = models.CountStatusOpen
+	session.PostedAt = nil
+	session.CreatedAt = now
+	session.UpdatedAt = now
+
+	//Snapshot what the system holds for everything in scope
+	lines := []models.CountLine{}
+	added := map[countKey]bool{}
+	addLine := func(skuID uuid.UUID, binID *uuid.UUID, quantity int) {
+		key := countLineKey(skuID, binID)
+		if added[key] || (len(session.SkuIDs) > 0 && !slices.Contains(session.SkuIDs, skuID)) {
+			return
+		}
+		added[key] = true
+		lines = append(lines, models.CountLine{
+			ID:             uuid.New(),
+			SessionID:      session.ID,
+			SkuID:          skuID,
+			BinID:          binID,
+			UserID:         userID,
+			SystemQuantity: quantity,
+		})
+	}
+
+	if len(session.BinIDs) > 0 {
+		for _, binID := range session.BinIDs {
+			stock, err := fetchBinInventory(supabaseClient, "bin_id", binID.String())
+			if err != nil {
+				fmt.Println(err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Cannot fetch bin inventory from database",
+				})
+			}
+			for _, s := range stock {
+				addLine(s.SkuID, &s.BinID, s.Quantity)
+			}
+			for _, skuID := range session.SkuIDs {
+				addLine(skuID, &binID, 0)
+			}
+		}
+	} else {
+		inventory, _, err := supabaseClient.From("inventory").Select("*", "", false).Eq("location_id", session.WarehouseID.String()).Execute()
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch inventory from database",
+			})
+		}
+		respInventory := []models.Inventory{}
+		err = json.Unmarshal(inventory, &respInventory)
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot unmarshal inventory from database",
+			})
+		}
+		for _, inv := range respInventory {
+			addLine(inv.SkuID, nil, inv.Quantity)
+		}
+		for _, skuID := range session.SkuIDs {
+			addLine(skuID, nil, 0)
+		}
+	}
+
+	//Save to database
+	_, _, err = supabaseClient.From("count_sessions").Insert(session, false, "", "", "").Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save count session to database",
+		})
+	}
+
+	if len(lines) > 0 {
+		_, _, err = supabaseClient.From("count_lines").Insert(lines, false, "", "", "").Execute()
+		if err != nil {
+			fmt.Println(err)
+			supabaseClient.From("count_sessions").Delete("", "").Eq("id", session.ID.String()).Execute()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot save count lines to database",
+			})
+		}
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"session": session,
+		"lines":   lines,
+	})
+}
+
+func GetCountSessions(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+
+	query := supabaseClient.From("count_sessions").Select("*", "", false)
+	if warehouseID := c.Query("warehouse_id"); warehouseID != "" {
+		query = query.Eq("warehouse_id", warehouseID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Eq("status", status)
+	}
+	sessions, _, err := query.Order("created_at", nil).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch count sessions from database",
+		})
+	}
+	respStruct := []models.CountSession{}
+	err = json.Unmarshal(sessions, &respStruct)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal count sessions from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(respStruct)
+}
+
+// Returns a count session with each line's system quantity, counted quantity and variance
+func GetCountSession(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	sessionID := c.Params("id")
+
+	session, err := fetchCountSession(supabaseClient, sessionID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch count session from database",
+		})
+	}
+	if session == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Count session not found",
+		})
+	}
+
+	lines, err := fetchCountLines(supabaseClient, sessionID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch count lines from database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"session": session,
+		"lines":   lines,
+	})
+}
+
+// Submits a counted quantity from a scanner. Quantities add up, so several users can count
+// the same sku in different places; a mistaken entry can be deleted and re-submitted.
+func SubmitCountEntry(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	sessionID := c.Params("id")
+	entry := new(models.CountEntry)
+
+	if err := c.BodyParser(entry); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	if entry.SkuID == uuid.Nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "SKU ID is required",
+		})
+	}
+
+	if entry.Quantity < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Quantity cannot be negative",
+		})
+	}
+
+	quantity, err := toBaseQuantity(supabaseClient, entry.SkuID, entry.Unit, entry.Quantity)
+	if err != nil {
+		return unitErrorResponse(c, err)
+	}
+	entry.Quantity = quantity
+	entry.Unit = ""
+
+	session, err := fetchCountSession(supabaseClient, sessionID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch count session from database",
+		})
+	}
+	if session == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Count session not found",
+		})
+	}
+	if session.Status != models.CountStatusOpen {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Count session is not open",
+		})
+	}
+
+	if len(session.SkuIDs) > 0 && !slices.Contains(session.SkuIDs, entry.SkuID) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "SKU is not part of this count",
+		})
+	}
+	if len(session.BinIDs) > 0 {
+		if entry.BinID == nil || !slices.Contains(session.BinIDs, *entry.BinID) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "A bin that is part of this count is required",
+			})
+		}
+	} else {
+		entry.BinID = nil
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	//Stock found that the system knew nothing about gets a line of its own
+	lines, err := fetchCountLines(supabaseClient, sessionID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch count lines from database",
+		})
+	}
+	key := countLineKey(entry.SkuID, entry.BinID)
+	found := false
+	for _, line := range lines {
+		if countLineKey(line.SkuID, line.BinID) == key {
+			found = true
+			break
+		}
+	}
+	if !found {
+		quantity, err := fetchSystemQuantity(supabaseClient, session.WarehouseID, entry.SkuID, entry.BinID)
+		if err == nil {
+			_, _, err = supabaseClient.From("count_lines").Insert(&models.CountLine{
+				ID:             uuid.New(),
+				SessionID:      session.ID,
+				SkuID:          entry.SkuID,
+				BinID:          entry.BinID,
+				UserID:         userID,
+				SystemQuantity: quantity,
+			}, false, "", "", "").Execute()
+		}
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot save count line to database",
+			})
+		}
+	}
+
+	entry.ID = uuid.New()
+	entry.SessionID = session.ID
+	entry.UserID = userID
+	entry.CreatedAt = time.Now()
+
+	_, _, err = supabaseClient.From("count_entries").Insert(entry, false, "", "", "").Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save count entry to database",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(entry)
+}
+
+func DeleteCountEntry(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	sessionID := c.Params("id")
+	entryID := c.Params("entryid")
+
+	session, err := fetchCountSession(supabaseClient, sessionID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch count session from database",
+		})
+	}
+	if session == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Count session not found",
+		})
+	}
+	if session.Status != models.CountStatusOpen {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Count session is not open",
+		})
+	}
+
+	_, _, err = supabaseClient.From("count_entries").Delete("", "").Eq("id", entryID).Eq("session_id", sessionID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot delete count entry from database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Count entry deleted successfully",
+	})
+}
+
+// Posts the approved adjustments of a count session. Lines to post can be listed in "line_ids",
+// otherwise every counted line is posted. Each line is adjusted by its variance against the
+// snapshot taken when the session was opened, and recorded in the ledger as a count movement.
+func PostCountSession(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	sessionID := c.Params("id")
+	request := new(struct {
+		LineIDs []uuid.UUID `json:"line_ids"`
+	})
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(request); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Cannot parse JSON",
+			})
+		}
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	session, err := fetchCountSession(supabaseClient, sessionID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch count session from database",
+		})
+	}
+	if session == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Count session not found",
+		})
+	}
+	if session.Status != models.CountStatusOpen {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Count session is not open",
+		})
+	}
+
+	lines, err := fetchCountLines(supabaseClient, sessionID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch count lines from database",
+		})
+	}
+
+	posted := []models.CountLine{}
+	failed := []fiber.Map{}
+	for _, line := range lines {
+		if line.Posted || line.Counted == nil {
+			continue
+		}
+		if len(request.LineIDs) > 0 && !slices.Contains(request.LineIDs, line.ID) {
+			continue
+		}
+
+		//A line's adjustment and its posted flag are saved together, so a retry never adjusts twice
+		movements := []*models.StockMovement{}
+		if *line.Variance != 0 {
+			movement := &models.StockMovement{
+				SkuID:      line.SkuID,
+				LocationID: session.WarehouseID,
+				UserID:     userID,
+				Quantity:   *line.Variance,
+				Reason:     models.MovementReasonCount,
+				Reference:  "count:" + session.ID.String(),
+				BinID:      line.BinID,
+			}
+			_, err = applyStockMovement(supabaseClient, movement)
+			if err != nil {
+				fmt.Println(err)
+				reason := "Cannot update inventory in database"
+				if errors.Is(err, ErrInsufficientStock) {
+					reason = "Adjustment would take stock below the reserved quantity"
+				} else if errors.Is(err, ErrSerialRequired) {
+					reason = "Serialized SKUs must be adjusted by serial number"
+				}
+				failed = append(failed, fiber.Map{
+					"line_id": line.ID,
+					"sku_id":  line.SkuID,
+					"error":   reason,
+				})
+				continue
+			}
+			movements = append(movements, movement)
+		}
+
+		_, _, err = supabaseClient.From("count_lines").Update(map[string]interface{}{
+			"posted": true,
+		}, "", "").Eq("id", line.ID.String()).Execute()
+		if err != nil {
+			fmt.Println(err)
+			if err := reverseStockMovements(supabaseClient, movements); err != nil {
+				fmt.Println(err)
+			}
+			failed = append(failed, fiber.Map{
+				"line_id": line.ID,
+				"sku_id":  line.SkuID,
+				"error":   "Cannot save count line to database",
+			})
+			continue
+		}
+		offerToBackorders(supabaseClient, movements)
+		line.Posted = true
+		posted = append(posted, line)
+	}
+
+	if len(failed) == 0 {
+		now := time.Now()
+		session.Status = models.CountStatusPosted
+		session.PostedAt = &now
+		session.UpdatedAt = now
+		_, _, err = supabaseClient.From("count_sessions").Update(session, "", "").Eq("id", sessionID).Execute()
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot save count session to database",
+			})
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"session": session,
+		"posted":  posted,
+		"failed":  failed,
+	})
+}
+
+// Cancels an open count session without posting anything
+func CancelCountSession(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	sessionID := c.Params("id")
+
+	session, err := fetchCountSession(supabaseClient, sessionID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch count session from database",
+		})
+	}
+	if session == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Count session not found",
+		})
+	}
+	if session.Status != models.CountStatusOpen {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Count session is not open",
+		})
+	}
+
+	session.Status = models.CountStatusCancelled
+	session.UpdatedAt = time.Now()
+	_, _, err = supabaseClient.From("count_sessions").Update(session, "", "").Eq("id", sessionID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save count session to database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Count session cancelled successfully",
+	})
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/database"
+	"ucrs.com/inventory-manager/backend/internal/models"
+)
+
+// Fetches a customer - returns nil if it does not exist
+func fetchCustomer(supabaseClient *supabase.Client, customerID string) (*models.Customer, error) {
+	customer, _, err := supabaseClient.From("customers").Select("*", "", false).Eq("id", customerID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.Customer{}
+	err = json.Unmarshal(customer, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	if len(respStruct) == 0 {
+		return nil, nil
+	}
+	return &respStruct[0], nil
+}
+
+func CreateCustomer(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	customer := new(models.Customer)
+
+	if err := c.BodyParser(customer); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	// Basic validation
+	if customer.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Customer name is required",
+		})
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	now := time.Now()
+	customer.ID = uuid.New()
+	customer.UserID = userID
+	customer.CreatedAt = now
+	customer.UpdatedAt = now
+
+	//Save to database
+	_, _, err = supabaseClient.From("customers").Insert(customer, false, "", "", "").Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save customer to database",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(customer)
+}
+
+func UpdateCustomer(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	customerID := c.Params("id")
+	customer := new(models.Customer)
+
+	cid, err := uuid.Parse(customerID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid customer ID",
+		})
+	}
+
+	if err := c.BodyParser(customer); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	// Basic validation
+	if customer.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Customer name is required",
+		})
+	}
+
+	existing, err := fetchCustomer(supabaseClient, customerID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch customer from database",
+		})
+	}
+	if existing == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Customer not found",
+		})
+	}
+
+	customer.ID = cid
+	customer.UserID = existing.UserID
+	customer.CreatedAt = existing.CreatedAt
+	customer.UpdatedAt = time.Now()
+
+	_, _, err = supabaseClient.From("customers").Update(customer, "", "").Eq("id", customerID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save customer to database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(customer)
+}
+
+func GetCustomers(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	customers, _, err := supabaseClient.From("customers").Select("*", "", false).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch customers from database",
+		})
+	}
+	respStruct := []models.Customer{}
+	err = json.Unmarshal(customers, &respStruct)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal customers from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(respStruct)
+}
+
+func GetCustomer(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	customerID := c.Params("id")
+
+	customer, err := fetchCustomer(supabaseClient, customerID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch customer from database",
+		})
+	}
+	if customer == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Customer not found",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(customer)
+}
+
+func DeleteCustomer(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	customerID := c.Params("id")
+
+	//Customers with sales orders are kept for the order history
+	orders, _, err := supabaseClient.From("sales_orders").Select("id", "", false).Eq("customer_id", customerID).Limit(1, "").Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch sales orders from database",
+		})
+	}
+	respOrders := []struct {
+		ID uuid.UUID `json:"id"`
+	}{}
+	err = json.Unmarshal(orders, &respOrders)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal sales orders from database",
+		})
+	}
+	if len(respOrders) > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Customer has sales orders and cannot be deleted",
+		})
+	}
+
+	_, _, err = supabaseClient.From("customers").Delete("", "").Eq("id", customerID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot delete customer from database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Customer deleted successfully",
+	})
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/supabase-community/postgrest-go"
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/models"
+	"ucrs.com/inventory-manager/backend/pkg"
+)
+
+const (
+	forecastHistoryDays     = 182 //Half a year of shipments, so a season is seen many times over
+	forecastHorizonDays     = 28
+	forecastWindowDays      = 28 //Moving average window
+	forecastSeasonDays      = 7  //Demand is assumed to follow a weekly pattern
+	forecastReviewDays      = 14 //Cover held above the reorder point, so orders aren't placed every day
+	defaultLeadTimeDays     = 7  //Used for skus without a supplier lead time
+	forecastZScore          = 1.96
+	smoothingLevelFactor    = 0.3
+	smoothingTrendFactor    = 0.05
+	smoothingSeasonalFactor = 0.2
+)
+
+// Demand is forecast to two decimal places - fractions of a unit a day are meaningful on average
+func roundDemand(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// Shortest lead time each sku can be bought in, from its suppliers' lead times and any per-sku overrides
+func fetchLeadTimes(supabaseClient *supabase.Client) (map[uuid.UUID]int, error) {
+	suppliers := []models.Supplier{}
+	supplierSKUs := []models.SupplierSKU{}
+	err := selectAll(supabaseClient, "suppliers", "id, lead_time_days", &suppliers)
+	if err == nil {
+		err = selectAll(supabaseClient, "supplier_skus", "supplier_id, sku_id, lead_time_days", &supplierSKUs)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	supplierLeadTimes := map[uuid.UUID]int{}
+	for _, supplier := range suppliers {
+		supplierLeadTimes[supplier.ID] = supplier.LeadTimeDays
+	}
+	leadTimes := map[uuid.UUID]int{}
+	for _, supplierSKU := range supplierSKUs {
+		leadTime := supplierLeadTimes[supplierSKU.SupplierID]
+		if supplierSKU.LeadTimeDays != nil {
+			leadTime = *supplierSKU.LeadTimeDays
+		}
+		if leadTime <= 0 {
+			continue
+		}
+		if existing, ok := leadTimes[supplierSKU.SkuID]; !ok || leadTime < existing {
+			leadTimes[supplierSKU.SkuID] = leadTime
+		}
+	}
+	return leadTimes, nil
+}
+
+// Forecasts daily demand from a sku's daily shipments at a location, and suggests reorder levels to
+// cover the lead time. The moving average and seasonal smoothing are both fitted, and whichever made
+// the smaller one-step errors over the history is used - its error spread gives the confidence
+// interval and the safety stock.
+func buildForecast(series []float64, leadTimeDays int, periodEnd time.Time) *models.Forecast {
+	horizon := max(forecastHorizonDays, leadTimeDays+forecastReviewDays)
+	forecast := &models.Forecast{
+		Method:       models.ForecastMethodMovingAverage,
+		HistoryDays:  len(series),
+		LeadTimeDays: leadTimeDays,
+		PeriodEnd:    periodEnd,
+	}
+
+	result := pkg.MovingAverageForecast(series, forecastWindowDays, horizon)
+	forecast.MovingAverageError = roundDemand(result.MAE)
+	if seasonal, ok := pkg.SeasonalSmoothingForecast(series, forecastSeasonDays, smoothingLevelFactor, smoothingTrendFactor, smoothingSeasonalFactor, horizon); ok {
+		smoothingError := roundDemand(seasonal.MAE)
+		forecast.ExponentialSmoothingError = &smoothingError
+		if seasonal.MAE < result.MAE {
+			forecast.Method = models.ForecastMethodExponentialSmoothing
+			result = seasonal
+		}
+	}
+
+	margin := forecastZScore * result.StdDev
+	total := 0.0
+	forecast.Daily = make([]models.ForecastPoint, forecastHorizonDays)
+	for h := range forecast.Daily {
+		total += result.Forecast[h]
+		forecast.Daily[h] = models.ForecastPoint{
+			Date:     periodEnd.AddDate(0, 0, h),
+			Quantity: roundDemand(result.Forecast[h]),
+			Lower:    roundDemand(max(0, result.Forecast[h]-margin)),
+			Upper:    roundDemand(result.Forecast[h] + margin),
+		}
+	}
+	forecast.AverageDailyDemand = roundDemand(total / forecastHorizonDays)
+
+	//Safety stock covers the forecast error over the lead time, the reorder point covers the lead time's
+	//demand on top of it, and the maximum adds a review period's demand
+	leadTimeDemand, reviewDemand := 0.0, 0.0
+	for h, quantity := range result.Forecast {
+		if h < leadTimeDays {
+			leadTimeDemand += quantity
+		} else if h < leadTimeDays+forecastReviewDays {
+			reviewDemand += quantity
+		}
+	}
+	safetyStock := margin * math.Sqrt(float64(leadTimeDays))
+	forecast.SafetyStock = int(math.Ceil(safetyStock))
+	forecast.SuggestedMinimumLevel = forecast.SafetyStock
+	forecast.SuggestedReorderPoint = int(math.Ceil(leadTimeDemand + safetyStock))
+	forecast.SuggestedMaximumLevel = forecast.SuggestedReorderPoint + int(math.Ceil(reviewDemand))
+	return forecast
+}
+
+// Recomputes the demand forecast of every sku and location shipped from in the history window ending
+// at periodEnd. Demand is read from the shipments in the stock movement ledger - every decrease made
+// through UpdateInventory or a dispatch with the shipment reason - bucketed into days from the first
+// shipment in the window. Returns how many forecasts were saved - none if periodEnd was already done.
+func ComputeForecasts(supabaseClient *supabase.Client, periodEnd time.Time) (int, error) {
+	existing, _, err := supabaseClient.From("forecasts").Select("period_end", "", false).Eq("period_end", periodEnd.UTC().Format(time.RFC3339Nano)).Limit(1, "").Execute()
+	if err != nil {
+		return 0, err
+	}
+	respExisting := []struct {
+		PeriodEnd time.Time `json:"period_end"`
+	}{}
+	err = json.Unmarshal(existing, &respExisting)
+	if err != nil {
+		return 0, err
+	}
+	if len(respExisting) > 0 {
+		return 0, nil
+	}
+
+	historyStart := periodEnd.AddDate(0, 0, -forecastHistoryDays)
+	shipments := supabaseClient.From("stock_movements").Select("sku_id, location_id, user_id, quantity, created_at", "", false).Eq("reason", models.MovementReasonShipment).And(timeRange("created_at", "gte", historyStart, "lt", periodEnd), "")
+	movements, err := fetchAllPages[models.StockMovement](shipments.Order("id", &postgrest.OrderOpts{Ascending: true}))
+	if err != nil {
+		return 0, err
+	}
+	if len(movements) == 0 {
+		return 0, nil
+	}
+	leadTimes, err := fetchLeadTimes(supabaseClient)
+	if err != nil {
+		return 0, err
+	}
+
+	//Daily demand over the whole window, trimmed to start at each sku and location's first shipment
+	demand := map[stockKey][]float64{}
+	firstDay := map[stockKey]int{}
+	userIDs := map[stockKey]uuid.UUID{}
+	for _, movement := range movements {
+		key := stockKey{movement.SkuID, movement.LocationID}
+		if _, ok := demand[key]; !ok {
+			demand[key] = make([]float64, forecastHistoryDays)
+			firstDay[key] = forecastHistoryDays
+		}
+		day := int(movement.CreatedAt.Sub(historyStart) / (24 * time.Hour))
+		if day < 0 || day >= forecastHistoryDays {
+			continue
+		}
+		demand[key][day] += float64(-movement.Quantity)
+		firstDay[key] = min(firstDay[key], day)
+		userIDs[key] = movement.UserID
+	}
+
+	now := time.Now()
+	forecasts := make([]models.Forecast, 0, len(demand))
+	for key, series := range demand {
+		if firstDay[key] == forecastHistoryDays {
+			continue
+		}
+		leadTimeDays, ok := leadTimes[key.SkuID]
+		if !ok {
+			leadTimeDays = defaultLeadTimeDays
+		}
+		forecast := buildForecast(series[firstDay[key]:], leadTimeDays, periodEnd)
+		forecast.SkuID = key.SkuID
+		forecast.LocationID = key.LocationID
+		forecast.UserID = userIDs[key]
+		forecast.ComputedAt = now
+		forecasts = append(forecasts, *forecast)
+	}
+	if len(forecasts) == 0 {
+		return 0, nil
+	}
+
+	_, _, err = supabaseClient.From("forecasts").Upsert(forecasts, "sku_id, location_id", "", "").Execute()
+	if err != nil {
+		return 0, err
+	}
+	return len(forecasts), nil
+}
+
+// Gets the latest demand forecast of a sku at each location it ships from, or at ?location_id=.
+// Forecasts are recomputed nightly rather than on request.
+func GetSKUForecast(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	skuID := c.Params("id")
+
+	query := supabaseClient.From("forecasts").Select("*", "", false).Eq("sku_id", skuID)
+	if locationID := c.Query("location_id"); locationID != "" {
+		query = query.Eq("location_id", locationID)
+	}
+	forecasts, _, err := query.Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch forecasts from database",
+		})
+	}
+	respStruct := []models.Forecast{}
+	err = json.Unmarshal(forecasts, &respStruct)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal forecasts from database",
+		})
+	}
+	if len(respStruct) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "No forecast for this SKU yet - forecasts are computed nightly from its shipments",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(respStruct)
+}
@@ -2,22 +2,35 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/supabase-community/postgrest-go"
 	"github.com/supabase-community/supabase-go"
 	"ucrs.com/inventory-manager/backend/internal/database"
 	"ucrs.com/inventory-manager/backend/internal/models"
 )
 
+// Sets the quantity of a sku at a location. The change is recorded as a movement in the
+// stock ledger (with a reason code and optional reference document) and applied to the running
+// balance on the inventory row, so the full history is kept. If a lot number is given the
+// quantity is that of the lot.
 func UpdateInventory(c *fiber.Ctx) error {
 	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
 	locationID := c.Params("locationid")
 	skuID := c.Params("skuid")
-	inventory := new(models.Inventory)
-	if err := c.BodyParser(inventory); err != nil {
+	request := new(struct {
+		Quantity  int      `json:"quantity"`
+		Reason    string   `json:"reason"`
+		Reference string   `json:"reference"`
+		LotNumber string   `json:"lot_number"`
+		Unit      string   `json:"unit"`      //Unit the quantity is given in - defaults to the base unit
+		UnitCost  *float64 `json:"unit_cost"` //Cost of each unit added, for valuation
+	})
+	if err := c.BodyParser(request); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Cannot parse JSON",
 		})
@@ -28,18 +41,39 @@ func UpdateInventory(c *fiber.Ctx) error {
 			"error": "Invalid location ID",
 		})
 	}
-	inventory.LocationID = locID
 
-	inventory.SkuID, err = uuid.Parse(skuID)
+	sID, err := uuid.Parse(skuID)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Invalid sku ID",
 		})
 	}
 
-	// Set timestamps
-	currentTime := time.Now()
-	inventory.UpdatedAt = currentTime
+	if request.Quantity < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Quantity cannot be negative",
+		})
+	}
+
+	request.Quantity, err = toBaseQuantity(supabaseClient, sID, request.Unit, request.Quantity)
+	if err != nil {
+		return unitErrorResponse(c, err)
+	}
+
+	if request.UnitCost != nil && *request.UnitCost < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unit cost cannot be negative",
+		})
+	}
+
+	if request.Reason == "" {
+		request.Reason = models.MovementReasonAdjustment
+	}
+	if !models.IsValidMovementReason(request.Reason) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid movement reason",
+		})
+	}
 
 	//Get UserID
 	userID, err := database.FetchUserID(supabaseClient)
@@ -49,9 +83,50 @@ func UpdateInventory(c *fiber.Ctx) error {
 			"error": "Cannot fetch user ID from database",
 		})
 	}
-	inventory.UserID = userID
 
-	_, _, err = supabaseClient.From("inventory").Upsert(inventory, "sku_id, location_id", "", "").Eq("location_id", locationID).Eq("sku_id", skuID).Execute()
+	var current int
+	if request.LotNumber != "" {
+		var lot *models.Lot
+		lot, err = fetchLot(supabaseClient, sID, locID, request.LotNumber)
+		if lot != nil {
+			current = lot.Quantity
+		}
+	} else {
+		current, err = fetchOnHandQuantity(supabaseClient, sID, locID)
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch inventory from database",
+		})
+	}
+
+	movement := &models.StockMovement{
+		SkuID:      sID,
+		LocationID: locID,
+		UserID:     userID,
+		Quantity:   request.Quantity - current,
+		Reason:     request.Reason,
+		Reference:  request.Reference,
+		LotNumber:  request.LotNumber,
+		UnitCost:   request.UnitCost,
+	}
+	inventory, err := recordStockMovement(supabaseClient, movement)
+	if errors.Is(err, ErrInsufficientStock) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Quantity cannot be lower than the reserved quantity",
+		})
+	}
+	if errors.Is(err, ErrSerialRequired) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Quantities of serialized SKUs are derived from their serial numbers and cannot be set directly",
+		})
+	}
+	if errors.Is(err, ErrLotNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Lot not found",
+		})
+	}
 	if err != nil {
 		fmt.Println(err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -63,10 +138,28 @@ func UpdateInventory(c *fiber.Ctx) error {
 }
 
 // FUNCTION WILL RETURN TOO MUCH, OR JUST UP TO SUPABASE LIMITS = ADD PAGINATION FROM RESUABLE COMPONENT!
+// ?as_of= returns quantities as they stood at that time instead.
 func GetInventory(c *fiber.Ctx) error {
 	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
 	locationid := c.Params("locationid")
 
+	asOf, err := parseAsOf(c.Query("as_of"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid as_of date - use RFC 3339, e.g. 2026-09-30T23:59:59Z",
+		})
+	}
+	if asOf != nil {
+		inventory, err := fetchInventoryAsOf(supabaseClient, locationid, "", *asOf)
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch historical inventory from database",
+			})
+		}
+		return c.Status(fiber.StatusOK).JSON(inventory)
+	}
+
 	respStruct := []models.Inventory{}
 
 	if locationid == "" {
@@ -110,11 +203,35 @@ func GetInventory(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusOK).JSON(respStruct)
 }
 
+// Returns on-hand, reserved and available quantities of a sku at a location.
+// ?as_of= returns the on-hand quantity as it stood at that time instead.
 func GetSpecificInventory(c *fiber.Ctx) error {
 	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
 	locationid := c.Params("locationid")
 	skuid := c.Params("skuid")
 
+	asOf, err := parseAsOf(c.Query("as_of"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid as_of date - use RFC 3339, e.g. 2026-09-30T23:59:59Z",
+		})
+	}
+	if asOf != nil {
+		inventory, err := fetchInventoryAsOf(supabaseClient, locationid, skuid, *asOf)
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch historical inventory from database",
+			})
+		}
+		if len(inventory) == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Inventory not found",
+			})
+		}
+		return c.Status(fiber.StatusOK).JSON(inventory[0])
+	}
+
 	inventory, _, err := supabaseClient.From("inventory").Select("*", "", false).Eq("location_id", locationid).Eq("sku_id", skuid).Execute()
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -128,13 +245,45 @@ func GetSpecificInventory(c *fiber.Ctx) error {
 			"error": "Cannot unmarshal inventory from database",
 		})
 	}
-	return c.Status(fiber.StatusOK).JSON(respStruct[0])
+	if len(respStruct) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Inventory not found",
+		})
+	}
+
+	reservations, err := fetchActiveReservations(supabaseClient, skuid, locationid)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch reservations from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(applyReservations(respStruct, reservations)[0])
 }
 
+// Returns on-hand, reserved and available quantities of a sku at every location.
+// ?as_of= returns on-hand quantities as they stood at that time instead.
 func GetInventoryForSKU(c *fiber.Ctx) error {
 	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
 	skuID := c.Params("skuid")
 
+	asOf, err := parseAsOf(c.Query("as_of"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid as_of date - use RFC 3339, e.g. 2026-09-30T23:59:59Z",
+		})
+	}
+	if asOf != nil {
+		inventory, err := fetchInventoryAsOf(supabaseClient, "", skuID, *asOf)
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch historical inventory from database",
+			})
+		}
+		return c.Status(fiber.StatusOK).JSON(inventory)
+	}
+
 	inventory, _, err := supabaseClient.From("inventory").Select("*", "", false).Eq("sku_id", skuID).Execute()
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -148,22 +297,76 @@ func GetInventoryForSKU(c *fiber.Ctx) error {
 			"error": "Cannot unmarshal inventory from database",
 		})
 	}
-	return c.Status(fiber.StatusOK).JSON(respStruct)
+
+	reservations, err := fetchActiveReservations(supabaseClient, skuID, "")
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch reservations from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(applyReservations(respStruct, reservations))
 }
 
+// Deletes the inventory of a location. The stock it held is written off in the ledger first, so
+// the movement history still nets to what the location holds.
 func DeleteInventory(c *fiber.Ctx) error {
 	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
 	locationID := c.Params("locationid")
 
-	_, err := uuid.Parse(locationID)
+	locID, err := uuid.Parse(locationID)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Invalid location ID",
 		})
 	}
 
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch user ID from database",
+		})
+	}
+
+	inventory, err := fetchAllPages[models.Inventory](supabaseClient.From("inventory").Select("*", "", false).Eq("location_id", locationID).Neq("quantity", "0").Order("sku_id", &postgrest.OrderOpts{Ascending: true}))
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch inventory from database",
+		})
+	}
+	now := time.Now()
+	writeOffs := []models.StockMovement{}
+	for _, inv := range inventory {
+		writeOffs = append(writeOffs, models.StockMovement{
+			ID:         uuid.New(),
+			SkuID:      inv.SkuID,
+			LocationID: locID,
+			UserID:     userID,
+			Quantity:   -inv.Quantity,
+			Reason:     models.MovementReasonAdjustment,
+			Reference:  "inventory deleted",
+			CreatedAt:  now,
+		})
+	}
+	if len(writeOffs) > 0 {
+		_, _, err = supabaseClient.From("stock_movements").Insert(writeOffs, false, "", "", "").Execute()
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot save stock movements to database",
+			})
+		}
+	}
+
 	_, _, err = supabaseClient.From("inventory").Delete("", "").Eq("location_id", locationID).Execute()
 	if err != nil {
+		fmt.Println(err)
+		//The stock is still there, so the write-offs mustn't stay in the ledger
+		for _, writeOff := range writeOffs {
+			supabaseClient.From("stock_movements").Delete("", "").Eq("id", writeOff.ID.String()).Execute()
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Cannot delete inventory from database",
 		})
@@ -0,0 +1,496 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/database"
+	"ucrs.com/inventory-manager/backend/internal/models"
+)
+
+// Fetches the bill of materials of a kit - empty if the sku is not a kit
+func fetchBOM(supabaseClient *supabase.Client, kitSkuID string) ([]models.BOMComponent, error) {
+	components, _, err := supabaseClient.From("bom_components").Select("*", "", false).Eq("kit_sku_id", kitSkuID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.BOMComponent{}
+	err = json.Unmarshal(components, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	return respStruct, nil
+}
+
+// Reports whether target is reachable from sku by following kit components - used to stop
+// a kit being made, directly or indirectly, out of itself
+func bomReaches(components []models.BOMComponent, sku, target uuid.UUID) bool {
+	visited := map[uuid.UUID]bool{}
+	pending := []uuid.UUID{sku}
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if current == target {
+			return true
+		}
+		if visited[current] {
+			continue
+		}
+		visited[current] = true
+		for _, component := range components {
+			if component.KitSkuID == current {
+				pending = append(pending, component.ComponentSkuID)
+			}
+		}
+	}
+	return false
+}
+
+// Records a set of movements that must all succeed. If one fails, those already recorded are
+// reversed by compensating movements, so the ledger nets back to where it started - an error is
+// returned for the reversal too if that can't be done. Stock added isn't offered to backorders -
+// the caller does that with offerToBackorders once nothing is left to undo.
+func recordStockMovements(supabaseClient *supabase.Client, movements []*models.StockMovement) error {
+	for i, movement := range movements {
+		_, err := applyStockMovement(supabaseClient, movement)
+		if err == nil {
+			continue
+		}
+		if reverseErr := reverseStockMovements(supabaseClient, movements[:i]); reverseErr != nil {
+			return errors.Join(err, reverseErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// Reverses movements already recorded, newest first - used when a later step of the operation they
+// belong to fails. Every movement is attempted, and the failures are returned together.
+func reverseStockMovements(supabaseClient *supabase.Client, movements []*models.StockMovement) error {
+	errs := []error{}
+	for i := len(movements) - 1; i >= 0; i-- {
+		if err := reverseStockMovement(supabaseClient, movements[i]); err != nil {
+			fmt.Println(err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Works out how many kits are on hand at a location and how many more the components could make
+func fetchKitAvailability(supabaseClient *supabase.Client, kitSkuID, locationID uuid.UUID, components []models.BOMComponent) (*models.KitAvailability, error) {
+	assembled, err := fetchAvailableQuantity(supabaseClient, kitSkuID, locationID)
+	if err != nil {
+		return nil, err
+	}
+	availability := &models.KitAvailability{
+		SkuID:      kitSkuID,
+		LocationID: locationID,
+		Assembled:  max(assembled, 0),
+		Components: []models.ComponentAvailability{},
+	}
+	for i, component := range components {
+		available, err := fetchAvailableQuantity(supabaseClient, component.ComponentSkuID, locationID)
+		if err != nil {
+			return nil, err
+		}
+		buildable := max(available, 0) / component.Quantity
+		if i == 0 || buildable < availability.Buildable {
+			availability.Buildable = buildable
+		}
+		availability.Components = append(availability.Components, models.ComponentAvailability{
+			SkuID:     component.ComponentSkuID,
+			Quantity:  component.Quantity,
+			Available: available,
+			Buildable: buildable,
+		})
+	}
+	availability.Available = availability.Assembled + availability.Buildable
+	return availability, nil
+}
+
+// Sets the bill of materials of a kit, replacing any it already has
+func UpdateBOM(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	skuID := c.Params("id")
+	request := new(struct {
+		Components []models.BOMComponent `json:"components"`
+	})
+	if err := c.BodyParser(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	kitID, err := uuid.Parse(skuID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid sku ID",
+		})
+	}
+
+	if len(request.Components) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "At least one component is required",
+		})
+	}
+
+	kit, err := fetchSKU(supabaseClient, skuID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch SKU from database",
+		})
+	}
+	if kit == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "SKU not found",
+		})
+	}
+	if kit.Serialized {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Serialized SKUs cannot be kits",
+		})
+	}
+
+	//Every other kit's components, to check the new ones don't lead back to this kit
+	existing := []models.BOMComponent{}
+	err = selectAll(supabaseClient, "bom_components", "*", &existing)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch bills of materials from database",
+		})
+	}
+	others := []models.BOMComponent{}
+	for _, component := range existing {
+		if component.KitSkuID != kitID {
+			others = append(others, component)
+		}
+	}
+
+	seen := map[uuid.UUID]bool{}
+	for _, component := range request.Components {
+		if component.ComponentSkuID == uuid.Nil || component.Quantity <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Each component needs a component_sku_id and a quantity greater than 0",
+			})
+		}
+		if seen[component.ComponentSkuID] {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  "Component listed more than once",
+				"sku_id": component.ComponentSkuID,
+			})
+		}
+		seen[component.ComponentSkuID] = true
+
+		if bomReaches(others, component.ComponentSkuID, kitID) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  "A kit cannot contain itself",
+				"sku_id": component.ComponentSkuID,
+			})
+		}
+
+		sku, err := fetchSKU(supabaseClient, component.ComponentSkuID.String())
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch SKU from database",
+			})
+		}
+		if sku == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":  "Component SKU not found",
+				"sku_id": component.ComponentSkuID,
+			})
+		}
+		if sku.Serialized {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  "Serialized SKUs cannot be kit components",
+				"sku_id": component.ComponentSkuID,
+			})
+		}
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	now := time.Now()
+	for i := range request.Components {
+		request.Components[i].ID = uuid.New()
+		request.Components[i].KitSkuID = kitID
+		request.Components[i].UserID = userID
+		request.Components[i].CreatedAt = now
+		request.Components[i].UpdatedAt = now
+	}
+
+	_, _, err = supabaseClient.From("bom_components").Delete("", "").Eq("kit_sku_id", skuID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot delete bill of materials from database",
+		})
+	}
+	_, _, err = supabaseClient.From("bom_components").Insert(request.Components, false, "", "", "").Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save bill of materials to database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(request.Components)
+}
+
+func GetBOM(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	skuID := c.Params("id")
+
+	components, err := fetchBOM(supabaseClient, skuID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch bill of materials from database",
+		})
+	}
+	if len(components) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "SKU is not a kit",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(components)
+}
+
+// Removes a kit's bill of materials - assembled kit stock is left as it is
+func DeleteBOM(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	skuID := c.Params("id")
+
+	_, _, err := supabaseClient.From("bom_components").Delete("", "").Eq("kit_sku_id", skuID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot delete bill of materials from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Bill of materials deleted successfully",
+	})
+}
+
+// Returns how many of a kit are available at a location, from assembled stock and from components
+func GetKitAvailability(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	locationID := c.Params("locationid")
+	skuID := c.Params("skuid")
+
+	locID, err := uuid.Parse(locationID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid location ID",
+		})
+	}
+	kitID, err := uuid.Parse(skuID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid sku ID",
+		})
+	}
+
+	components, err := fetchBOM(supabaseClient, skuID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch bill of materials from database",
+		})
+	}
+	if len(components) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "SKU is not a kit",
+		})
+	}
+
+	availability, err := fetchKitAvailability(supabaseClient, kitID, locID, components)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch inventory from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(availability)
+}
+
+// Builds kits at a location, consuming their components
+func AssembleKit(c *fiber.Ctx) error {
+	return changeKitStock(c, true)
+}
+
+// Breaks kits at a location back down into their components
+func DisassembleKit(c *fiber.Ctx) error {
+	return changeKitStock(c, false)
+}
+
+// Moves stock between a kit and its components. All stock is checked before anything moves,
+// and if a movement still fails the ones already recorded are reversed.
+func changeKitStock(c *fiber.Ctx, assemble bool) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	locationID := c.Params("locationid")
+	skuID := c.Params("skuid")
+	request := new(struct {
+		Quantity  int    `json:"quantity"`
+		Unit      string `json:"unit"`
+		Reference string `json:"reference"`
+	})
+	if err := c.BodyParser(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	locID, err := uuid.Parse(locationID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid location ID",
+		})
+	}
+	kitID, err := uuid.Parse(skuID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid sku ID",
+		})
+	}
+
+	if request.Quantity <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Quantity must be greater than 0",
+		})
+	}
+
+	request.Quantity, err = toBaseQuantity(supabaseClient, kitID, request.Unit, request.Quantity)
+	if err != nil {
+		return unitErrorResponse(c, err)
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	components, err := fetchBOM(supabaseClient, skuID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch bill of materials from database",
+		})
+	}
+	if len(components) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "SKU is not a kit",
+		})
+	}
+
+	availability, err := fetchKitAvailability(supabaseClient, kitID, locID, components)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch inventory from database",
+		})
+	}
+	if assemble && availability.Buildable < request.Quantity {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":        "Insufficient component stock",
+			"availability": availability,
+		})
+	}
+	if !assemble && availability.Assembled < request.Quantity {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":        "Insufficient kit stock",
+			"availability": availability,
+		})
+	}
+
+	reason := models.MovementReasonDisassembly
+	direction := -1
+	if assemble {
+		reason = models.MovementReasonAssembly
+		direction = 1
+	}
+	reference := request.Reference
+	if reference == "" {
+		reference = "kit:" + skuID
+	}
+
+	//Stock is always taken before any is added - components then kit when assembling, and the reverse when disassembling
+	movements := []*models.StockMovement{}
+	kitCost := 0.0
+	for _, component := range components {
+		if assemble {
+			costs, err := fetchAverageCosts(supabaseClient, component.ComponentSkuID)
+			if err == nil {
+				var unitCost float64
+				unitCost, err = fallbackUnitCost(supabaseClient, component.ComponentSkuID, locID, costs)
+				kitCost += unitCost * float64(component.Quantity)
+			}
+			if err != nil {
+				fmt.Println(err)
+			}
+		}
+		movements = append(movements, &models.StockMovement{
+			SkuID:      component.ComponentSkuID,
+			LocationID: locID,
+			UserID:     userID,
+			Quantity:   -direction * component.Quantity * request.Quantity,
+			Reason:     reason,
+			Reference:  reference,
+		})
+	}
+	kitMovement := &models.StockMovement{
+		SkuID:      kitID,
+		LocationID: locID,
+		UserID:     userID,
+		Quantity:   direction * request.Quantity,
+		Reason:     reason,
+		Reference:  reference,
+	}
+	if assemble {
+		//A built kit costs what its components did
+		kitMovement.UnitCost = &kitCost
+		movements = append(movements, kitMovement)
+	} else {
+		movements = append([]*models.StockMovement{kitMovement}, movements...)
+	}
+
+	err = recordStockMovements(supabaseClient, movements)
+	if errors.Is(err, ErrInsufficientStock) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Stock changed while moving it - nothing was assembled or disassembled",
+		})
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot update inventory in database",
+		})
+	}
+	offerToBackorders(supabaseClient, movements)
+
+	availability, err = fetchKitAvailability(supabaseClient, kitID, locID, components)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch inventory from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(availability)
+}
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/supabase-community/postgrest-go"
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/database"
+	"ucrs.com/inventory-manager/backend/internal/models"
+)
+
+// Fetches a lot by number - returns nil if it does not exist
+func fetchLot(supabaseClient *supabase.Client, skuID, locationID uuid.UUID, lotNumber string) (*models.Lot, error) {
+	lot, _, err := supabaseClient.From("lots").Select("*", "", false).Eq("sku_id", skuID.String()).Eq("location_id", locationID.String()).Eq("lot_number", lotNumber).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.Lot{}
+	err = json.Unmarshal(lot, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	if len(respStruct) == 0 {
+		return nil, nil
+	}
+	return &respStruct[0], nil
+}
+
+// Fetches the lots of a sku at a location that still hold stock, soonest expiry first
+func fetchLots(supabaseClient *supabase.Client, skuID, locationID string) ([]models.Lot, error) {
+	lots, _, err := supabaseClient.From("lots").Select("*", "", false).Eq("sku_id", skuID).Eq("location_id", locationID).Gt("quantity", "0").Order("expires_at", &postgrest.OrderOpts{Ascending: true}).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.Lot{}
+	err = json.Unmarshal(lots, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	return respStruct, nil
+}
+
+// First-expired-first-out allocation. Lots must be sorted by expiry (as returned by fetchLots);
+// lots already expired at the given time are skipped. Returns the allocations and any quantity
+// that could not be covered by lot stock.
+func allocateFEFO(lots []models.Lot, quantity int, at time.Time) ([]models.LotAllocation, int) {
+	allocations := []models.LotAllocation{}
+	for _, lot := range lots {
+		if quantity == 0 {
+			break
+		}
+		if lot.Quantity <= 0 || (lot.ExpiresAt != nil && !lot.ExpiresAt.After(at)) {
+			continue
+		}
+		take := min(lot.Quantity, quantity)
+		allocations = append(allocations, models.LotAllocation{
+			LotNumber: lot.LotNumber,
+			ExpiresAt: lot.ExpiresAt,
+			Quantity:  take,
+		})
+		quantity -= take
+	}
+	return allocations, quantity
+}
+
+// Removes stock using FEFO across the sku's lots at the location. Stock not held in any lot
+// is used for whatever the lots can't cover. The movement is used as a template for the
+// reason, reference and user of each movement recorded. The movements are recorded all or
+// nothing, and returned so the caller can reverse them if a later step fails.
+func recordFEFOShipment(supabaseClient *supabase.Client, template models.StockMovement, quantity int) ([]models.LotAllocation, []*models.StockMovement, error) {
+	lots, err := fetchLots(supabaseClient, template.SkuID.String(), template.LocationID.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	allocations, shortfall := allocateFEFO(lots, quantity, time.Now())
+
+	if shortfall > 0 {
+		onHand, err := fetchOnHandQuantity(supabaseClient, template.SkuID, template.LocationID)
+		if err != nil {
+			return nil, nil, err
+		}
+		untracked := onHand
+		for _, lot := range lots {
+			untracked -= lot.Quantity
+		}
+		if untracked < shortfall {
+			return nil, nil, ErrInsufficientStock
+		}
+	}
+
+	movements := []*models.StockMovement{}
+	for _, allocation := range allocations {
+		movement := template
+		movement.Quantity = -allocation.Quantity
+		movement.LotNumber = allocation.LotNumber
+		movements = append(movements, &movement)
+	}
+	if shortfall > 0 {
+		movement := template
+		movement.Quantity = -shortfall
+		movement.LotNumber = ""
+		movements = append(movements, &movement)
+	}
+	err = recordStockMovements(supabaseClient, movements)
+	if err != nil {
+		return nil, nil, err
+	}
+	return allocations, movements, nil
+}
+
+// Creates a lot ready to receive stock into, or corrects the dates held for an existing one
+func saveLot(supabaseClient *supabase.Client, skuID, locationID, userID uuid.UUID, lotNumber string, manufacturedAt, expiresAt *time.Time) error {
+	lot, err := fetchLot(supabaseClient, skuID, locationID, lotNumber)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if lot == nil {
+		lot = &models.Lot{
+			ID:             uuid.New(),
+			SkuID:          skuID,
+			LocationID:     locationID,
+			UserID:         userID,
+			LotNumber:      lotNumber,
+			ManufacturedAt: manufacturedAt,
+			ExpiresAt:      expiresAt,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		_, _, err = supabaseClient.From("lots").Insert(lot, false, "", "", "").Execute()
+		return err
+	}
+
+	//Dates given on a later receipt correct the ones already held
+	if manufacturedAt != nil {
+		lot.ManufacturedAt = manufacturedAt
+	}
+	if expiresAt != nil {
+		lot.ExpiresAt = expiresAt
+	}
+	//Only the dates - the quantity is a running balance kept by recordStockMovement
+	_, _, err = supabaseClient.From("lots").Update(map[string]interface{}{
+		"manufactured_at": lot.ManufacturedAt,
+		"expires_at":      lot.ExpiresAt,
+		"updated_at":      now,
+	}, "", "").Eq("id", lot.ID.String()).Execute()
+	return err
+}
+
+// Receives stock into a lot, creating the lot if it is new
+func ReceiveLot(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	locationID := c.Params("locationid")
+	skuID := c.Params("skuid")
+	request := new(struct {
+		LotNumber      string     `json:"lot_number"`
+		ManufacturedAt *time.Time `json:"manufactured_at"`
+		ExpiresAt      *time.Time `json:"expires_at"`
+		Quantity       int        `json:"quantity"`
+		Reference      string     `json:"reference"`
+		Unit           string     `json:"unit"`
+		UnitCost       *float64   `json:"unit_cost"`
+	})
+	if err := c.BodyParser(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	locID, err := uuid.Parse(locationID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid location ID",
+		})
+	}
+	sID, err := uuid.Parse(skuID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid sku ID",
+		})
+	}
+
+	// Basic validation
+	if request.LotNumber == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Lot number is required",
+		})
+	}
+
+	if request.Quantity <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Quantity must be greater than 0",
+		})
+	}
+
+	request.Quantity, err = toBaseQuantity(supabaseClient, sID, request.Unit, request.Quantity)
+	if err != nil {
+		return unitErrorResponse(c, err)
+	}
+
+	if request.UnitCost != nil && *request.UnitCost < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unit cost cannot be negative",
+		})
+	}
+
+	if request.ManufacturedAt != nil && request.ExpiresAt != nil && request.ExpiresAt.Before(*request.ManufacturedAt) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Expiry date cannot be before manufacture date",
+		})
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	err = saveLot(supabaseClient, sID, locID, userID, request.LotNumber, request.ManufacturedAt, request.ExpiresAt)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save lot to database",
+		})
+	}
+
+	_, err = recordStockMovement(supabaseClient, &models.StockMovement{
+		SkuID:      sID,
+		LocationID: locID,
+		UserID:     userID,
+		Quantity:   request.Quantity,
+		Reason:     models.MovementReasonReceipt,
+		Reference:  request.Reference,
+		LotNumber:  request.LotNumber,
+		UnitCost:   request.UnitCost,
+	})
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot update inventory in database",
+		})
+	}
+
+	lot, err := fetchLot(supabaseClient, sID, locID, request.LotNumber)
+	if err != nil || lot == nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch lot from database",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(lot)
+}
+
+// Lists lots holding stock for a sku at a location, in FEFO order
+func GetLots(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	locationID := c.Params("locationid")
+	skuID := c.Params("skuid")
+
+	lots, err := fetchLots(supabaseClient, skuID, locationID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch lots from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(lots)
+}
+
+// Lists lots holding stock that expire within ?days=N (default 30), including those already expired
+func GetExpiringLots(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	days, err := strconv.Atoi(c.Query("days"))
+	if err != nil {
+		days = 30
+	}
+	if days < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Days cannot be negative",
+		})
+	}
+
+	cutoff := time.Now().AddDate(0, 0, days)
+	query := supabaseClient.From("lots").Select("*", "", false).Gt("quantity", "0").Lte("expires_at", cutoff.Format(time.RFC3339))
+	if locationID := c.Query("location_id"); locationID != "" {
+		query = query.Eq("location_id", locationID)
+	}
+	lots, _, err := query.Order("expires_at", &postgrest.OrderOpts{Ascending: true}).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch lots from database",
+		})
+	}
+	respStruct := []models.Lot{}
+	err = json.Unmarshal(lots, &respStruct)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal lots from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(respStruct)
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/database"
+	"ucrs.com/inventory-manager/backend/internal/models"
+)
+
+// Fetches a product's secondary categories
+func fetchSecondaryCategoryIDs(supabaseClient *supabase.Client, productID string) ([]uuid.UUID, error) {
+	assignments, _, err := supabaseClient.From("product_categories").Select("*", "", false).Eq("product_id", productID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.ProductCategory{}
+	err = json.Unmarshal(assignments, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	categoryIDs := []uuid.UUID{}
+	for _, assignment := range respStruct {
+		categoryIDs = append(categoryIDs, assignment.CategoryID)
+	}
+	return categoryIDs, nil
+}
+
+// Checks every category exists - returns a fiber error naming the first that doesn't
+func validateCategories(supabaseClient *supabase.Client, categoryIDs []uuid.UUID) error {
+	if len(categoryIDs) == 0 {
+		return nil
+	}
+	ids := []string{}
+	for _, id := range categoryIDs {
+		ids = append(ids, id.String())
+	}
+	categories, _, err := supabaseClient.From("categories").Select("id", "", false).In("id", ids).Execute()
+	if err != nil {
+		return err
+	}
+	respStruct := []models.Category{}
+	err = json.Unmarshal(categories, &respStruct)
+	if err != nil {
+		return err
+	}
+	found := map[uuid.UUID]bool{}
+	for _, category := range respStruct {
+		found[category.ID] = true
+	}
+	for _, id := range categoryIDs {
+		if !found[id] {
+			return fiber.NewError(fiber.StatusBadRequest, "Category "+id.String()+" not found")
+		}
+	}
+	return nil
+}
+
+func GetProductCategories(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	productID := c.Params("id")
+
+	product, err := fetchProduct(supabaseClient, productID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch product from database",
+		})
+	}
+	if product == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Product not found",
+		})
+	}
+	secondary, err := fetchSecondaryCategoryIDs(supabaseClient, productID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch product categories from database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.ProductCategories{
+		PrimaryCategoryID:    product.CategoryID,
+		SecondaryCategoryIDs: secondary,
+	})
+}
+
+// Assigns a product to one primary category and any number of secondary ones, replacing its current
+// categories. A null primary category leaves the product without one.
+func UpdateProductCategories(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	productID := c.Params("id")
+	request := new(models.ProductCategories)
+	if err := c.BodyParser(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	// Basic validation
+	secondary := []uuid.UUID{}
+	seen := map[uuid.UUID]bool{}
+	for _, categoryID := range request.SecondaryCategoryIDs {
+		if request.PrimaryCategoryID != nil && categoryID == *request.PrimaryCategoryID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "The primary category cannot also be a secondary category",
+			})
+		}
+		if !seen[categoryID] {
+			seen[categoryID] = true
+			secondary = append(secondary, categoryID)
+		}
+	}
+	request.SecondaryCategoryIDs = secondary
+
+	product, err := fetchProduct(supabaseClient, productID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch product from database",
+		})
+	}
+	if product == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Product not found",
+		})
+	}
+
+	categoryIDs := append([]uuid.UUID{}, secondary...)
+	if request.PrimaryCategoryID != nil {
+		categoryIDs = append(categoryIDs, *request.PrimaryCategoryID)
+	}
+	if err := validateCategories(supabaseClient, categoryIDs); err != nil {
+		return validationErrorResponse(c, err, "Cannot fetch categories from database")
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	//Save to database - the primary category on the product, the secondary ones replaced wholesale
+	_, _, err = supabaseClient.From("products").Update(map[string]interface{}{
+		"category_id": request.PrimaryCategoryID,
+		"updated_at":  time.Now(),
+	}, "", "").Eq("id", productID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save product to database",
+		})
+	}
+	_, _, err = supabaseClient.From("product_categories").Delete("", "").Eq("product_id", productID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save product categories to database",
+		})
+	}
+	if len(secondary) > 0 {
+		assignments := []models.ProductCategory{}
+		for _, categoryID := range secondary {
+			assignments = append(assignments, models.ProductCategory{
+				ProductID:  product.ID,
+				CategoryID: categoryID,
+				UserID:     userID,
+			})
+		}
+		_, _, err = supabaseClient.From("product_categories").Insert(assignments, false, "", "", "").Execute()
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot save product categories to database",
+			})
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(request)
+}
@@ -3,11 +3,13 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
+	"slices"
 	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/supabase-community/postgrest-go"
 	"github.com/supabase-community/supabase-go"
 	"ucrs.com/inventory-manager/backend/internal/database"
 	"ucrs.com/inventory-manager/backend/internal/models"
@@ -38,6 +40,12 @@ func CreateProduct(c *fiber.Ctx) error {
 		})
 	}
 
+	if product.CategoryID != nil {
+		if err := validateCategories(supabaseClient, []uuid.UUID{*product.CategoryID}); err != nil {
+			return validationErrorResponse(c, err, "Cannot fetch category from database")
+		}
+	}
+
 	// Set timestamps
 	now := time.Now()
 	product.CreatedAt = now
@@ -65,7 +73,9 @@ func CreateProduct(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusCreated).JSON(product)
 }
 
-// Function to fetch multiple products, split into pages of max 10 products
+// Function to fetch multiple products, split into pages of max 10 products. ?category= limits them to
+// products in a category, as their primary or a secondary category - with ?include_descendants=true,
+// in any category below it too.
 func GetProducts(c *fiber.Ctx) error {
 	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
 	page, err := strconv.Atoi(c.Query("page"))
@@ -73,7 +83,40 @@ func GetProducts(c *fiber.Ctx) error {
 		page = 1
 	}
 	startIndex, endIndex := pkg.GetPaginationIndexes(page, 10)
-	products, _, err := supabaseClient.From("products").Select("*", "", false).Range(startIndex, endIndex, "").Execute()
+	query := supabaseClient.From("products").Select("*", "", false)
+	if category := c.Query("category"); category != "" {
+		categoryID, err := uuid.Parse(category)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid category ID",
+			})
+		}
+		scope, err := fetchCategoryScope(supabaseClient, categoryID, c.Query("include_descendants") == "true")
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch categories from database",
+			})
+		}
+		productIDs, err := fetchCategoryProductIDs(supabaseClient, scope)
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch category products from database",
+			})
+		}
+		//Only the page's IDs are sent, so a large category can't outgrow the request URL
+		slices.Sort(productIDs)
+		if startIndex < 0 || startIndex >= len(productIDs) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Products not found",
+			})
+		}
+		query = query.In("id", productIDs[startIndex:min(endIndex+1, len(productIDs))]).Order("id", &postgrest.OrderOpts{Ascending: true})
+	} else {
+		query = query.Range(startIndex, endIndex, "")
+	}
+	products, _, err := query.Execute()
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Cannot fetch products from database",
@@ -175,6 +218,12 @@ func UpdateProduct(c *fiber.Ctx) error {
 		})
 	}
 
+	if product.CategoryID != nil {
+		if err := validateCategories(supabaseClient, []uuid.UUID{*product.CategoryID}); err != nil {
+			return validationErrorResponse(c, err, "Cannot fetch category from database")
+		}
+	}
+
 	// Set timestamps
 	now := time.Now()
 	product.UpdatedAt = now
@@ -209,3 +258,20 @@ func DeleteProduct(c *fiber.Ctx) error {
 		"message": "Product deleted successfully",
 	})
 }
+
+// Fetches a product - returns nil if it does not exist
+func fetchProduct(supabaseClient *supabase.Client, productID string) (*models.Product, error) {
+	product, _, err := supabaseClient.From("products").Select("*", "", false).Eq("id", productID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.Product{}
+	err = json.Unmarshal(product, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	if len(respStruct) == 0 {
+		return nil, nil
+	}
+	return &respStruct[0], nil
+}
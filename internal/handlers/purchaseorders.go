@@ -0,0 +1,645 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/database"
+	"ucrs.com/inventory-manager/backend/internal/models"
+)
+
+func convertPurchaseOrderForDB(order *models.PurchaseOrder) *models.PurchaseOrderDatabase {
+	return &models.PurchaseOrderDatabase{
+		ID:          order.ID,
+		UserID:      order.UserID,
+		SupplierID:  order.SupplierID,
+		WarehouseID: order.WarehouseID,
+		Status:      order.Status,
+		Reference:   order.Reference,
+		Currency:    order.Currency,
+		Notes:       order.Notes,
+		ExpectedAt:  order.ExpectedAt,
+		SentAt:      order.SentAt,
+		ClosedAt:    order.ClosedAt,
+		CreatedAt:   order.CreatedAt,
+		UpdatedAt:   order.UpdatedAt,
+	}
+}
+
+func convertPurchaseOrderForJSON(order *models.PurchaseOrderDatabase, lines []models.PurchaseOrderLine) *models.PurchaseOrder {
+	return &models.PurchaseOrder{
+		ID:          order.ID,
+		UserID:      order.UserID,
+		SupplierID:  order.SupplierID,
+		WarehouseID: order.WarehouseID,
+		Status:      order.Status,
+		Reference:   order.Reference,
+		Currency:    order.Currency,
+		Notes:       order.Notes,
+		Lines:       lines,
+		ExpectedAt:  order.ExpectedAt,
+		SentAt:      order.SentAt,
+		ClosedAt:    order.ClosedAt,
+		CreatedAt:   order.CreatedAt,
+		UpdatedAt:   order.UpdatedAt,
+	}
+}
+
+// Fetches a purchase order with its lines - returns nil if the order does not exist
+func fetchPurchaseOrder(supabaseClient *supabase.Client, orderID string) (*models.PurchaseOrder, error) {
+	order, _, err := supabaseClient.From("purchase_orders").Select("*", "", false).Eq("id", orderID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.PurchaseOrderDatabase{}
+	err = json.Unmarshal(order, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	if len(respStruct) == 0 {
+		return nil, nil
+	}
+
+	lines, _, err := supabaseClient.From("purchase_order_lines").Select("*", "", false).Eq("purchase_order_id", orderID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respLines := []models.PurchaseOrderLine{}
+	err = json.Unmarshal(lines, &respLines)
+	if err != nil {
+		return nil, err
+	}
+
+	return convertPurchaseOrderForJSON(&respStruct[0], respLines), nil
+}
+
+// Builds the lines of a purchase order from the ones given - quantities are converted to base
+// units, costs default to the supplier's price, and lines for the same sku are merged
+func buildPurchaseOrderLines(supabaseClient *supabase.Client, order *models.PurchaseOrder, userID uuid.UUID) ([]models.PurchaseOrderLine, error) {
+	if len(order.Lines) == 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Purchase order must have at least one line")
+	}
+
+	lines := []models.PurchaseOrderLine{}
+	lineIndex := map[uuid.UUID]int{}
+	for _, line := range order.Lines {
+		if line.SkuID == uuid.Nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "SKU ID is required on every line")
+		}
+		if line.Quantity <= 0 {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Line quantity must be greater than 0")
+		}
+		if line.UnitCost < 0 {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Unit cost cannot be negative")
+		}
+		quantity, err := toBaseQuantity(supabaseClient, line.SkuID, line.Unit, line.Quantity)
+		if err != nil {
+			return nil, err
+		}
+
+		if i, ok := lineIndex[line.SkuID]; ok {
+			lines[i].Quantity += quantity
+			continue
+		}
+
+		unitCost := line.UnitCost
+		if unitCost == 0 {
+			supplierSKU, err := fetchSupplierSKU(supabaseClient, order.SupplierID, line.SkuID)
+			if err != nil {
+				return nil, err
+			}
+			if supplierSKU != nil {
+				unitCost = supplierSKU.Price
+			}
+		}
+
+		lineIndex[line.SkuID] = len(lines)
+		lines = append(lines, models.PurchaseOrderLine{
+			ID:              uuid.New(),
+			PurchaseOrderID: order.ID,
+			SkuID:           line.SkuID,
+			UserID:          userID,
+			Quantity:        quantity,
+			UnitCost:        unitCost,
+		})
+	}
+	return lines, nil
+}
+
+// Responds to an error from a helper that validates as it goes - a *fiber.Error carries its own
+// status and message, unit errors are bad requests, and anything else fails with message
+func validationErrorResponse(c *fiber.Ctx, err error, message string) error {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"error": fiberErr.Message,
+		})
+	}
+	if errors.Is(err, ErrUnknownUnit) || errors.Is(err, ErrFractionalQuantity) {
+		return unitErrorResponse(c, err)
+	}
+	fmt.Println(err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": message,
+	})
+}
+
+// Checks a receipt of base unit quantities per sku against an order - skus must be on the order,
+// and no more can be received than was ordered
+func validatePurchaseOrderReceipt(supabaseClient *supabase.Client, order *models.PurchaseOrder, received map[uuid.UUID]int) error {
+	if order.Status != models.PurchaseOrderStatusSent && order.Status != models.PurchaseOrderStatusPartiallyReceived {
+		return fiber.NewError(fiber.StatusConflict, "Only sent purchase orders can be received")
+	}
+
+	lineIndex := map[uuid.UUID]int{}
+	for i, line := range order.Lines {
+		lineIndex[line.SkuID] = i
+	}
+	for skuID, quantity := range received {
+		i, ok := lineIndex[skuID]
+		if !ok {
+			return fiber.NewError(fiber.StatusBadRequest, "SKU "+skuID.String()+" is not on this purchase order")
+		}
+		if order.Lines[i].QuantityReceived+quantity > order.Lines[i].Quantity {
+			return fiber.NewError(fiber.StatusBadRequest, "Received quantity of SKU "+skuID.String()+" exceeds quantity ordered")
+		}
+		sku, err := fetchSKU(supabaseClient, skuID.String())
+		if err != nil {
+			return err
+		}
+		if sku != nil && sku.Serialized {
+			return fiber.NewError(fiber.StatusBadRequest, "Serialized SKU "+skuID.String()+" must be received by registering its serial numbers")
+		}
+	}
+	return nil
+}
+
+// Checks a receipt booked straight onto an order doesn't take goods that an open ASN is still
+// expecting - those are received against the ASN.
+func validateUncoveredReceipt(supabaseClient *supabase.Client, order *models.PurchaseOrder, received map[uuid.UUID]int) error {
+	covered, err := openASNQuantities(supabaseClient, order.ID.String())
+	if err != nil {
+		return err
+	}
+	for _, line := range order.Lines {
+		if received[line.SkuID] > uncoveredQuantity(line, covered) {
+			return fiber.NewError(fiber.StatusConflict, "Received quantity of SKU "+line.SkuID.String()+" is expected on an open ASN - receive it against the ASN")
+		}
+	}
+	return nil
+}
+
+// Books a validated receipt into the order's warehouse at the ordered cost. The stock and the
+// quantities received on the order are saved together - if either fails the other is undone.
+func receivePurchaseOrderStock(supabaseClient *supabase.Client, order *models.PurchaseOrder, userID uuid.UUID, received map[uuid.UUID]int, close bool) error {
+	reference := "po:" + order.ID.String()
+	if order.Reference != "" {
+		reference = order.Reference
+	}
+
+	movements := []*models.StockMovement{}
+	for _, line := range order.Lines {
+		quantity := received[line.SkuID]
+		if quantity == 0 {
+			continue
+		}
+		unitCost := line.UnitCost
+		movements = append(movements, &models.StockMovement{
+			SkuID:      line.SkuID,
+			LocationID: order.WarehouseID,
+			UserID:     userID,
+			Quantity:   quantity,
+			Reason:     models.MovementReasonReceipt,
+			Reference:  reference,
+			UnitCost:   &unitCost,
+		})
+	}
+	err := recordStockMovements(supabaseClient, movements)
+	if err != nil {
+		return err
+	}
+	err = applyPurchaseOrderReceipt(supabaseClient, order, received, close)
+	if err != nil {
+		return errors.Join(err, reverseStockMovements(supabaseClient, movements))
+	}
+	offerToBackorders(supabaseClient, movements)
+	return nil
+}
+
+// Adds received quantities to an order's lines and moves the order on to partially received - or
+// closed once everything has arrived, or when close is set. Stock is not touched. If saving fails
+// part way, the lines already saved are put back.
+func applyPurchaseOrderReceipt(supabaseClient *supabase.Client, order *models.PurchaseOrder, received map[uuid.UUID]int, close bool) error {
+	updated := []int{}
+	undo := func() {
+		for _, i := range updated {
+			order.Lines[i].QuantityReceived -= received[order.Lines[i].SkuID]
+			_, _, err := supabaseClient.From("purchase_order_lines").Update(order.Lines[i], "", "").Eq("id", order.Lines[i].ID.String()).Execute()
+			if err != nil {
+				fmt.Println(err)
+			}
+		}
+	}
+
+	outstanding := false
+	for i, line := range order.Lines {
+		if quantity := received[line.SkuID]; quantity > 0 {
+			order.Lines[i].QuantityReceived += quantity
+			_, _, err := supabaseClient.From("purchase_order_lines").Update(order.Lines[i], "", "").Eq("id", line.ID.String()).Execute()
+			if err != nil {
+				order.Lines[i].QuantityReceived -= quantity
+				undo()
+				return err
+			}
+			updated = append(updated, i)
+		}
+		if order.Lines[i].QuantityReceived < order.Lines[i].Quantity {
+			outstanding = true
+		}
+	}
+
+	now := time.Now()
+	status, closedAt, updatedAt := order.Status, order.ClosedAt, order.UpdatedAt
+	order.Status = models.PurchaseOrderStatusPartiallyReceived
+	if close || !outstanding {
+		order.Status = models.PurchaseOrderStatusClosed
+		order.ClosedAt = &now
+	}
+	order.UpdatedAt = now
+	_, _, err := supabaseClient.From("purchase_orders").Update(convertPurchaseOrderForDB(order), "", "").Eq("id", order.ID.String()).Execute()
+	if err != nil {
+		order.Status, order.ClosedAt, order.UpdatedAt = status, closedAt, updatedAt
+		undo()
+	}
+	return err
+}
+
+// Creates a draft purchase order from a supplier into a warehouse
+func CreatePurchaseOrder(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	order := new(models.PurchaseOrder)
+
+	if err := c.BodyParser(order); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	// Basic validation
+	if order.SupplierID == uuid.Nil || order.WarehouseID == uuid.Nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Supplier and warehouse are required",
+		})
+	}
+
+	supplier, err := fetchSupplier(supabaseClient, order.SupplierID.String())
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch supplier from database",
+		})
+	}
+	if supplier == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Supplier not found",
+		})
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	order.ID = uuid.New()
+	order.UserID = userID
+	order.Status = models.PurchaseOrderStatusDraft
+	order.Currency = supplier.Currency
+	order.SentAt = nil
+	order.ClosedAt = nil
+
+	order.Lines, err = buildPurchaseOrderLines(supabaseClient, order, userID)
+	if err != nil {
+		return validationErrorResponse(c, err, "Cannot update purchase order in database")
+	}
+
+	// Set timestamps
+	now := time.Now()
+	order.CreatedAt = now
+	order.UpdatedAt = now
+
+	//Save to database
+	_, _, err = supabaseClient.From("purchase_orders").Insert(convertPurchaseOrderForDB(order), false, "", "", "").Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save purchase order to database",
+		})
+	}
+
+	_, _, err = supabaseClient.From("purchase_order_lines").Insert(order.Lines, false, "", "", "").Execute()
+	if err != nil {
+		fmt.Println(err)
+		//Don't leave an order without lines behind
+		supabaseClient.From("purchase_orders").Delete("", "").Eq("id", order.ID.String()).Execute()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save purchase order lines to database",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(order)
+}
+
+// Replaces the details and lines of a draft purchase order
+func UpdatePurchaseOrder(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	orderID := c.Params("id")
+	request := new(models.PurchaseOrder)
+
+	if err := c.BodyParser(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	order, err := fetchPurchaseOrder(supabaseClient, orderID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch purchase order from database",
+		})
+	}
+	if order == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Purchase order not found",
+		})
+	}
+	if order.Status != models.PurchaseOrderStatusDraft {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Only draft purchase orders can be changed",
+		})
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	//The supplier is fixed once the order is raised - the warehouse, reference, dates and lines can change
+	if request.WarehouseID != uuid.Nil {
+		order.WarehouseID = request.WarehouseID
+	}
+	order.Reference = request.Reference
+	order.Notes = request.Notes
+	order.ExpectedAt = request.ExpectedAt
+	order.Lines = request.Lines
+	order.Lines, err = buildPurchaseOrderLines(supabaseClient, order, userID)
+	if err != nil {
+		return validationErrorResponse(c, err, "Cannot update purchase order in database")
+	}
+	order.UpdatedAt = time.Now()
+
+	_, _, err = supabaseClient.From("purchase_orders").Update(convertPurchaseOrderForDB(order), "", "").Eq("id", orderID).Execute()
+	if err == nil {
+		_, _, err = supabaseClient.From("purchase_order_lines").Delete("", "").Eq("purchase_order_id", orderID).Execute()
+	}
+	if err == nil {
+		_, _, err = supabaseClient.From("purchase_order_lines").Insert(order.Lines, false, "", "", "").Execute()
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save purchase order to database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(order)
+}
+
+func GetPurchaseOrders(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	query := supabaseClient.From("purchase_orders").Select("*", "", false)
+	if status := c.Query("status"); status != "" {
+		query = query.Eq("status", status)
+	}
+	if supplierID := c.Query("supplier_id"); supplierID != "" {
+		query = query.Eq("supplier_id", supplierID)
+	}
+	if warehouseID := c.Query("warehouse_id"); warehouseID != "" {
+		query = query.Eq("warehouse_id", warehouseID)
+	}
+	orders, _, err := query.Order("created_at", nil).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch purchase orders from database",
+		})
+	}
+	respStruct := []models.PurchaseOrderDatabase{}
+	err = json.Unmarshal(orders, &respStruct)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal purchase orders from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(respStruct)
+}
+
+func GetPurchaseOrder(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	orderID := c.Params("id")
+
+	order, err := fetchPurchaseOrder(supabaseClient, orderID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch purchase order from database",
+		})
+	}
+	if order == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Purchase order not found",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(order)
+}
+
+// Marks a draft purchase order as sent to the supplier. Unless an expected date has been set,
+// delivery is expected after the longest lead time of the skus ordered.
+func SendPurchaseOrder(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	orderID := c.Params("id")
+
+	order, err := fetchPurchaseOrder(supabaseClient, orderID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch purchase order from database",
+		})
+	}
+	if order == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Purchase order not found",
+		})
+	}
+	if order.Status != models.PurchaseOrderStatusDraft {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Only draft purchase orders can be sent",
+		})
+	}
+
+	now := time.Now()
+	if order.ExpectedAt == nil {
+		supplier, err := fetchSupplier(supabaseClient, order.SupplierID.String())
+		if err != nil || supplier == nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch supplier from database",
+			})
+		}
+		leadTime := supplier.LeadTimeDays
+		for _, line := range order.Lines {
+			supplierSKU, err := fetchSupplierSKU(supabaseClient, order.SupplierID, line.SkuID)
+			if err != nil {
+				fmt.Println(err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Cannot fetch supplier SKU from database",
+				})
+			}
+			if supplierSKU != nil && supplierSKU.LeadTimeDays != nil {
+				leadTime = max(leadTime, *supplierSKU.LeadTimeDays)
+			}
+		}
+		expected := now.AddDate(0, 0, leadTime)
+		order.ExpectedAt = &expected
+	}
+
+	order.Status = models.PurchaseOrderStatusSent
+	order.SentAt = &now
+	order.UpdatedAt = now
+	_, _, err = supabaseClient.From("purchase_orders").Update(convertPurchaseOrderForDB(order), "", "").Eq("id", orderID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save purchase order to database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(order)
+}
+
+// Receives some or all of a sent purchase order into its warehouse. The order is closed once
+// every line is fully received, or when "close" is set to accept a short delivery.
+func ReceivePurchaseOrder(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	orderID := c.Params("id")
+	request := new(struct {
+		Lines []struct {
+			SkuID    uuid.UUID `json:"sku_id"`
+			Quantity int       `json:"quantity"`
+			Unit     string    `json:"unit"`
+		} `json:"lines"`
+		Close bool `json:"close"`
+	})
+	if err := c.BodyParser(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	order, err := fetchPurchaseOrder(supabaseClient, orderID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch purchase order from database",
+		})
+	}
+	if order == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Purchase order not found",
+		})
+	}
+	received := map[uuid.UUID]int{}
+	for _, line := range request.Lines {
+		if line.Quantity <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Received quantity must be greater than 0",
+			})
+		}
+		quantity, err := toBaseQuantity(supabaseClient, line.SkuID, line.Unit, line.Quantity)
+		if err != nil {
+			return unitErrorResponse(c, err)
+		}
+		received[line.SkuID] += quantity
+	}
+
+	//Validate the whole receipt first - over-receipts are rejected
+	err = validatePurchaseOrderReceipt(supabaseClient, order, received)
+	if err == nil {
+		err = validateUncoveredReceipt(supabaseClient, order, received)
+	}
+	if err == nil {
+		err = receivePurchaseOrderStock(supabaseClient, order, userID, received, request.Close)
+	}
+	if err != nil {
+		return validationErrorResponse(c, err, "Cannot update purchase order in database")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(order)
+}
+
+// Cancels a purchase order that nothing has been received against yet
+func CancelPurchaseOrder(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	orderID := c.Params("id")
+
+	order, err := fetchPurchaseOrder(supabaseClient, orderID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch purchase order from database",
+		})
+	}
+	if order == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Purchase order not found",
+		})
+	}
+	if order.Status != models.PurchaseOrderStatusDraft && order.Status != models.PurchaseOrderStatusSent {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Only draft or sent purchase orders with nothing received can be cancelled",
+		})
+	}
+
+	now := time.Now()
+	order.Status = models.PurchaseOrderStatusCancelled
+	order.ClosedAt = &now
+	order.UpdatedAt = now
+	_, _, err = supabaseClient.From("purchase_orders").Update(convertPurchaseOrderForDB(order), "", "").Eq("id", orderID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save purchase order to database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Purchase order cancelled successfully",
+	})
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/database"
+	"ucrs.com/inventory-manager/backend/internal/models"
+)
+
+func alertThreshold(rule *models.ReorderRule, alertType string) int {
+	switch alertType {
+	case models.AlertTypeBelowMinimum:
+		return rule.MinimumLevel
+	case models.AlertTypeReorderPoint:
+		return rule.ReorderPoint
+	}
+	return rule.MaximumLevel
+}
+
+// Checks the quantity of a sku at a location against its reorder rule (if any). A breach opens a
+// stock alert, unless one of the same type is already open; alerts that no longer apply are resolved.
+// Alerts are rows in the stock_alerts table, so clients can subscribe to them through Supabase Realtime.
+func evaluateReorderRule(supabaseClient *supabase.Client, skuID, locationID uuid.UUID, quantity int) error {
+	rules, _, err := supabaseClient.From("reorder_rules").Select("*", "", false).Eq("sku_id", skuID.String()).Eq("location_id", locationID.String()).Execute()
+	if err != nil {
+		return err
+	}
+	respRules := []models.ReorderRule{}
+	err = json.Unmarshal(rules, &respRules)
+	if err != nil {
+		return err
+	}
+
+	alerts, _, err := supabaseClient.From("stock_alerts").Select("*", "", false).Eq("sku_id", skuID.String()).Eq("location_id", locationID.String()).Is("resolved_at", "null").Execute()
+	if err != nil {
+		return err
+	}
+	openAlerts := []models.StockAlert{}
+	err = json.Unmarshal(alerts, &openAlerts)
+	if err != nil {
+		return err
+	}
+
+	breach := ""
+	if len(respRules) > 0 {
+		breach = respRules[0].Evaluate(quantity)
+	}
+
+	now := time.Now()
+	alreadyOpen := false
+	for _, alert := range openAlerts {
+		if alert.Type == breach {
+			alreadyOpen = true
+			continue
+		}
+		alert.ResolvedAt = &now
+		_, _, err = supabaseClient.From("stock_alerts").Update(alert, "", "").Eq("id", alert.ID.String()).Execute()
+		if err != nil {
+			return err
+		}
+	}
+
+	if breach == "" || alreadyOpen {
+		return nil
+	}
+
+	alert := &models.StockAlert{
+		ID:         uuid.New(),
+		SkuID:      skuID,
+		LocationID: locationID,
+		UserID:     respRules[0].UserID,
+		Type:       breach,
+		Quantity:   quantity,
+		Threshold:  alertThreshold(&respRules[0], breach),
+		CreatedAt:  now,
+	}
+	_, _, err = supabaseClient.From("stock_alerts").Insert(alert, false, "", "", "").Execute()
+	return err
+}
+
+// Creates or replaces the reorder rule for a sku at a location
+func UpdateReorderRule(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	locationID := c.Params("locationid")
+	skuID := c.Params("skuid")
+	rule := new(models.ReorderRule)
+	if err := c.BodyParser(rule); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	locID, err := uuid.Parse(locationID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid location ID",
+		})
+	}
+	rule.LocationID = locID
+
+	rule.SkuID, err = uuid.Parse(skuID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid sku ID",
+		})
+	}
+
+	// Basic validation
+	if rule.MinimumLevel < 0 || rule.ReorderPoint < 0 || rule.MaximumLevel < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Levels cannot be negative",
+		})
+	}
+
+	if rule.ReorderPoint < rule.MinimumLevel {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Reorder point cannot be lower than the minimum level",
+		})
+	}
+
+	if rule.MaximumLevel > 0 && rule.MaximumLevel <= rule.ReorderPoint {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Maximum level must be greater than the reorder point",
+		})
+	}
+
+	//Get UserID
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch user ID from database",
+		})
+	}
+	rule.UserID = userID
+	rule.UpdatedAt = time.Now()
+
+	_, _, err = supabaseClient.From("reorder_rules").Upsert(rule, "sku_id, location_id", "", "").Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save reorder rule to database",
+		})
+	}
+
+	//Check the current stock against the new rule straight away
+	quantity, err := fetchOnHandQuantity(supabaseClient, rule.SkuID, rule.LocationID)
+	if err == nil {
+		err = evaluateReorderRule(supabaseClient, rule.SkuID, rule.LocationID, quantity)
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(rule)
+}
+
+func GetReorderRule(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	locationID := c.Params("locationid")
+	skuID := c.Params("skuid")
+
+	rule, _, err := supabaseClient.From("reorder_rules").Select("*", "", false).Eq("location_id", locationID).Eq("sku_id", skuID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch reorder rule from database",
+		})
+	}
+	respStruct := []models.ReorderRule{}
+	err = json.Unmarshal(rule, &respStruct)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal reorder rule from database",
+		})
+	}
+	if len(respStruct) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Reorder rule not found",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(respStruct[0])
+}
+
+func DeleteReorderRule(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	locationID := c.Params("locationid")
+	skuID := c.Params("skuid")
+
+	_, _, err := supabaseClient.From("reorder_rules").Delete("", "").Eq("location_id", locationID).Eq("sku_id", skuID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot delete reorder rule from database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Reorder rule deleted successfully",
+	})
+}
+
+// Lists stock alerts - open alerts only, unless ?all=true
+func GetStockAlerts(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+
+	query := supabaseClient.From("stock_alerts").Select("*", "", false)
+	if c.Query("all") != "true" {
+		query = query.Is("resolved_at", "null")
+	}
+	if locationID := c.Query("location_id"); locationID != "" {
+		query = query.Eq("location_id", locationID)
+	}
+	if alertType := c.Query("type"); alertType != "" {
+		query = query.Eq("type", alertType)
+	}
+	alerts, _, err := query.Order("created_at", nil).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch stock alerts from database",
+		})
+	}
+	respStruct := []models.StockAlert{}
+	err = json.Unmarshal(alerts, &respStruct)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal stock alerts from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(respStruct)
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/models"
+	"ucrs.com/inventory-manager/backend/pkg"
+)
+
+// A warehouse's position in the replenishment plan for one sku
+type replenishmentSite struct {
+	LocationID uuid.UUID
+	Available  int
+	Quantity   int //Surplus it can give, or stock it needs
+	Urgency    string
+	Ratio      float64 //Available as a fraction of its reorder point - lower is more urgent
+}
+
+// Ranks urgency so critical needs are met first
+func urgencyRank(urgency string) int {
+	if urgency == models.UrgencyCritical {
+		return 0
+	}
+	return 1
+}
+
+// Proposes transfers from overstocked warehouses to understocked ones, and flags skus where the
+// network as a whole is short. Only locations with a reorder rule take part, as the rule is what
+// says how much stock a location needs: locations at or below their reorder point need stock up to
+// their maximum level (or reorder point if there is none), and locations above their reorder point
+// can give away anything above it - or above their maximum level where they are over it. The most
+// urgent needs are met first, each from the nearest warehouses with surplus.
+// ?sku_id= and ?warehouse_id= (destination) narrow the suggestions.
+func GetReplenishmentSuggestions(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+
+	warehouses := []models.WarehouseDatabase{}
+	rules := []models.ReorderRule{}
+	inventory := []models.Inventory{}
+	err := selectAll(supabaseClient, "warehouses", "*", &warehouses)
+	if err == nil {
+		err = selectAll(supabaseClient, "reorder_rules", "*", &rules)
+	}
+	if err == nil {
+		err = selectAll(supabaseClient, "inventory", "*", &inventory)
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch stock levels from database",
+		})
+	}
+	reservations, err := fetchActiveReservations(supabaseClient, "", "")
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch reservations from database",
+		})
+	}
+
+	locations := map[uuid.UUID]models.WarehouseDatabase{}
+	for _, w := range warehouses {
+		locations[w.ID] = w
+	}
+	available := map[stockKey]int{}
+	for _, level := range applyReservations(inventory, reservations) {
+		available[stockKey{level.SkuID, level.LocationID}] = level.Available
+	}
+
+	//Split each sku's locations into those needing stock and those with surplus to give
+	needs := map[uuid.UUID][]replenishmentSite{}
+	surpluses := map[uuid.UUID][]replenishmentSite{}
+	for _, rule := range rules {
+		if _, ok := locations[rule.LocationID]; !ok {
+			continue
+		}
+		if skuID := c.Query("sku_id"); skuID != "" && rule.SkuID.String() != skuID {
+			continue
+		}
+		site := replenishmentSite{
+			LocationID: rule.LocationID,
+			Available:  available[stockKey{rule.SkuID, rule.LocationID}],
+		}
+
+		if site.Available <= rule.ReorderPoint {
+			target := rule.ReorderPoint
+			if rule.MaximumLevel > 0 {
+				target = rule.MaximumLevel
+			}
+			site.Quantity = target - site.Available
+			site.Urgency = models.UrgencyReorder
+			if site.Available < rule.MinimumLevel {
+				site.Urgency = models.UrgencyCritical
+			}
+			if rule.ReorderPoint > 0 {
+				site.Ratio = float64(site.Available) / float64(rule.ReorderPoint)
+			}
+			if site.Quantity > 0 {
+				needs[rule.SkuID] = append(needs[rule.SkuID], site)
+			}
+			continue
+		}
+
+		keep := rule.ReorderPoint + 1
+		if rule.MaximumLevel > 0 && site.Available > rule.MaximumLevel {
+			keep = rule.MaximumLevel
+		}
+		site.Quantity = site.Available - keep
+		if site.Quantity > 0 {
+			surpluses[rule.SkuID] = append(surpluses[rule.SkuID], site)
+		}
+	}
+
+	suggestions := models.ReplenishmentSuggestions{
+		Transfers: []models.TransferSuggestion{},
+		Shortages: []models.NetworkShortage{},
+	}
+	for skuID, skuNeeds := range needs {
+		//Most urgent first - critical before reorder, then the emptiest relative to its reorder point
+		slices.SortFunc(skuNeeds, func(a, b replenishmentSite) int {
+			return cmp.Or(cmp.Compare(urgencyRank(a.Urgency), urgencyRank(b.Urgency)), cmp.Compare(a.Ratio, b.Ratio))
+		})
+		sources := surpluses[skuID]
+
+		needed, shortfall, short := 0, 0, 0
+		for _, need := range skuNeeds {
+			needed += need.Quantity
+			destination := locations[need.LocationID]
+
+			//Nearest surplus first
+			distances := map[uuid.UUID]float64{}
+			for _, source := range sources {
+				origin := locations[source.LocationID]
+				distances[source.LocationID] = pkg.HaversineDistance(float64(origin.Latitude), float64(origin.Longitude), float64(destination.Latitude), float64(destination.Longitude))
+			}
+			slices.SortFunc(sources, func(a, b replenishmentSite) int {
+				return cmp.Compare(distances[a.LocationID], distances[b.LocationID])
+			})
+
+			remaining := need.Quantity
+			for i := range sources {
+				if remaining == 0 {
+					break
+				}
+				quantity := min(remaining, sources[i].Quantity)
+				if quantity <= 0 {
+					continue
+				}
+				remaining -= quantity
+				sources[i].Quantity -= quantity
+
+				if warehouseID := c.Query("warehouse_id"); warehouseID != "" && need.LocationID.String() != warehouseID {
+					continue
+				}
+				suggestions.Transfers = append(suggestions.Transfers, models.TransferSuggestion{
+					SkuID:                 skuID,
+					SourceLocationID:      sources[i].LocationID,
+					DestinationLocationID: need.LocationID,
+					Quantity:              quantity,
+					DistanceKm:            math.Round(distances[sources[i].LocationID]*10) / 10,
+					Urgency:               need.Urgency,
+					SourceAvailable:       sources[i].Available,
+					DestinationAvailable:  need.Available,
+				})
+			}
+			if remaining > 0 {
+				shortfall += remaining
+				short++
+			}
+		}
+
+		if shortfall > 0 {
+			suggestions.Shortages = append(suggestions.Shortages, models.NetworkShortage{
+				SkuID:          skuID,
+				QuantityNeeded: needed,
+				Shortfall:      shortfall,
+				Locations:      short,
+			})
+		}
+	}
+
+	//Ranked by urgency, then by distance
+	slices.SortFunc(suggestions.Transfers, func(a, b models.TransferSuggestion) int {
+		return cmp.Or(cmp.Compare(urgencyRank(a.Urgency), urgencyRank(b.Urgency)), cmp.Compare(a.DistanceKm, b.DistanceKm))
+	})
+	slices.SortFunc(suggestions.Shortages, func(a, b models.NetworkShortage) int {
+		return cmp.Compare(b.Shortfall, a.Shortfall)
+	})
+
+	return c.Status(fiber.StatusOK).JSON(suggestions)
+}
@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/supabase-community/postgrest-go"
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/database"
+	"ucrs.com/inventory-manager/backend/internal/models"
+)
+
+// Rows requested per page by fetchAllPages - the server may return fewer
+const pageSize = 1000
+
+// Selects every row of a table visible to the user into out
+func selectAll(supabaseClient *supabase.Client, table, columns string, out interface{}) error {
+	rows, _, err := supabaseClient.From(table).Select(columns, "", false).Execute()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(rows, out)
+}
+
+// Runs a select a page at a time until every matching row has been read, as a single request is cut
+// off at the API's row limit. The query must be ordered so pages don't overlap.
+func fetchAllPages[T any](query *postgrest.FilterBuilder) ([]T, error) {
+	rows := []T{}
+	for {
+		page, _, err := query.Range(len(rows), len(rows)+pageSize-1, "").Execute()
+		if err != nil {
+			return nil, err
+		}
+		respPage := []T{}
+		err = json.Unmarshal(page, &respPage)
+		if err != nil {
+			return nil, err
+		}
+		if len(respPage) == 0 {
+			return rows, nil
+		}
+		rows = append(rows, respPage...)
+	}
+}
+
+// Builds an And filter bounding a time column on both sides, e.g. timeRange("created_at", "gt", from,
+// "lte", to). Two filters on the same column can't be chained, as the later one replaces the earlier.
+func timeRange(column, lowerOperator string, lower time.Time, upperOperator string, upper time.Time) string {
+	return fmt.Sprintf(`%s.%s."%s",%s.%s."%s"`,
+		column, lowerOperator, lower.UTC().Format(time.RFC3339Nano),
+		column, upperOperator, upper.UTC().Format(time.RFC3339Nano))
+}
+
+// Reports whether any row of a table matches all the given column values
+func rowExists(supabaseClient *supabase.Client, table string, match map[string]string) (bool, error) {
+	rows, _, err := supabaseClient.From(table).Select("*", "", false).Match(match).Limit(1, "").Execute()
+	if err != nil {
+		return false, err
+	}
+	respStruct := []map[string]interface{}{}
+	err = json.Unmarshal(rows, &respStruct)
+	if err != nil {
+		return false, err
+	}
+	return len(respStruct) > 0, nil
+}
+
+// Fetches the costing method of the user's company - fifo unless the company has chosen otherwise
+func fetchCostingMethod(supabaseClient *supabase.Client) (string, error) {
+	companyID, err := database.FetchCompanyID(supabaseClient)
+	if err != nil {
+		return "", err
+	}
+	company, _, err := supabaseClient.From("companies").Select("costing_method", "", false).Eq("id", companyID.String()).Execute()
+	if err != nil {
+		return "", err
+	}
+	respStruct := []struct {
+		CostingMethod string `json:"costing_method"`
+	}{}
+	err = json.Unmarshal(company, &respStruct)
+	if err != nil {
+		return "", err
+	}
+	if len(respStruct) == 0 || respStruct[0].CostingMethod == "" {
+		return models.CostingMethodFIFO, nil
+	}
+	return respStruct[0].CostingMethod, nil
+}
+
+func roundMoney(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// Values stock on hand by the company's costing method, or the one given in ?method=,
+// broken down by warehouse and by product category. ?warehouse_id= limits the report to one warehouse.
+func GetValuationReport(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+
+	method := c.Query("method")
+	if method == "" {
+		var err error
+		method, err = fetchCostingMethod(supabaseClient)
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch company costing method from database",
+			})
+		}
+	}
+	if !models.IsValidCostingMethod(method) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid costing method",
+		})
+	}
+
+	query := supabaseClient.From("inventory").Select("*", "", false).Gt("quantity", "0")
+	if warehouseID := c.Query("warehouse_id"); warehouseID != "" {
+		query = query.Eq("location_id", warehouseID)
+	}
+	inventory, _, err := query.Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch inventory from database",
+		})
+	}
+	respInventory := []models.Inventory{}
+	err = json.Unmarshal(inventory, &respInventory)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal inventory from database",
+		})
+	}
+
+	//Fetch everything needed to price and group the stock up front, rather than per row
+	layers := []models.CostLayer{}
+	averages := []models.AverageCost{}
+	skus := []models.SKU{}
+	products := []models.Product{}
+	categories := []models.Category{}
+	warehouses := []models.WarehouseDatabase{}
+	switch method {
+	case models.CostingMethodFIFO:
+		err = selectAll(supabaseClient, "cost_layers", "*", &layers) //Used up layers add nothing to the value
+	case models.CostingMethodAverage:
+		err = selectAll(supabaseClient, "average_costs", "*", &averages)
+	}
+	if err == nil {
+		err = selectAll(supabaseClient, "skus", "*", &skus)
+	}
+	if err == nil {
+		err = selectAll(supabaseClient, "products", "*", &products)
+	}
+	if err == nil {
+		err = selectAll(supabaseClient, "categories", "*", &categories)
+	}
+	if err == nil {
+		err = selectAll(supabaseClient, "warehouses", "*", &warehouses)
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch valuation data from database",
+		})
+	}
+
+	layerValues := map[stockKey]float64{}
+	for _, layer := range layers {
+		layerValues[stockKey{layer.SkuID, layer.LocationID}] += float64(layer.Remaining) * layer.UnitCost
+	}
+	averageCosts := map[stockKey]float64{}
+	for _, average := range averages {
+		averageCosts[stockKey{average.SkuID, average.LocationID}] = average.UnitCost
+	}
+	skuByID := map[uuid.UUID]models.SKU{}
+	for _, sku := range skus {
+		skuByID[sku.ID] = sku
+	}
+	productCategories := map[uuid.UUID]*uuid.UUID{}
+	for _, product := range products {
+		productCategories[product.ID] = product.CategoryID
+	}
+	categoryNames := map[uuid.UUID]string{}
+	for _, category := range categories {
+		categoryNames[category.ID] = category.Name
+	}
+	warehouseNames := map[uuid.UUID]string{}
+	for _, warehouse := range warehouses {
+		warehouseNames[warehouse.ID] = warehouse.Name
+	}
+
+	report := models.ValuationReport{
+		Method:      method,
+		Warehouses:  []models.ValuationLine{},
+		Categories:  []models.ValuationLine{},
+		GeneratedAt: time.Now(),
+	}
+	byWarehouse := map[uuid.UUID]*models.ValuationLine{}
+	byCategory := map[uuid.UUID]*models.ValuationLine{}
+	for _, inv := range respInventory {
+		key := stockKey{inv.SkuID, inv.LocationID}
+		var value float64
+		switch method {
+		case models.CostingMethodFIFO:
+			value = layerValues[key]
+		case models.CostingMethodAverage:
+			value = float64(inv.Quantity) * averageCosts[key]
+		case models.CostingMethodStandard:
+			value = float64(inv.Quantity) * skuByID[inv.SkuID].StandardCost
+		}
+		report.Quantity += inv.Quantity
+		report.Value += value
+
+		warehouse, ok := byWarehouse[inv.LocationID]
+		if !ok {
+			warehouseID := inv.LocationID
+			warehouse = &models.ValuationLine{ID: &warehouseID, Name: warehouseNames[inv.LocationID]}
+			byWarehouse[inv.LocationID] = warehouse
+		}
+		warehouse.Quantity += inv.Quantity
+		warehouse.Value += value
+
+		//Stock of skus whose product has no category is grouped under a nil ID
+		categoryID := productCategories[skuByID[inv.SkuID].ProductID]
+		categoryKey := uuid.Nil
+		if categoryID != nil {
+			categoryKey = *categoryID
+		}
+		category, ok := byCategory[categoryKey]
+		if !ok {
+			category = &models.ValuationLine{ID: categoryID, Name: "Uncategorised"}
+			if categoryID != nil {
+				category.Name = categoryNames[*categoryID]
+			}
+			byCategory[categoryKey] = category
+		}
+		category.Quantity += inv.Quantity
+		category.Value += value
+	}
+
+	for _, line := range byWarehouse {
+		line.Value = roundMoney(line.Value)
+		report.Warehouses = append(report.Warehouses, *line)
+	}
+	for _, line := range byCategory {
+		line.Value = roundMoney(line.Value)
+		report.Categories = append(report.Categories, *line)
+	}
+	byValue := func(a, b models.ValuationLine) int {
+		return cmp.Compare(b.Value, a.Value)
+	}
+	slices.SortFunc(report.Warehouses, byValue)
+	slices.SortFunc(report.Categories, byValue)
+	report.Value = roundMoney(report.Value)
+
+	return c.Status(fiber.StatusOK).JSON(report)
+}
+
+// Summarises outstanding backorders per sku with how long they have been waiting, oldest first.
+// ?location_id= limits the report to one location.
+func GetBackorderReport(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	query := supabaseClient.From("backorders").Select("*", "", false).Eq("status", models.BackorderStatusOpen)
+	if locationID := c.Query("location_id"); locationID != "" {
+		query = query.Eq("location_id", locationID)
+	}
+	backorders, _, err := query.Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch backorders from database",
+		})
+	}
+	respStruct := []models.Backorder{}
+	err = json.Unmarshal(backorders, &respStruct)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal backorders from database",
+		})
+	}
+
+	now := time.Now()
+	summaries := map[uuid.UUID]*models.BackorderSummary{}
+	totalAge := map[uuid.UUID]float64{}
+	for _, backorder := range respStruct {
+		summary, ok := summaries[backorder.SkuID]
+		if !ok {
+			summary = &models.BackorderSummary{
+				SkuID:           backorder.SkuID,
+				OldestCreatedAt: backorder.CreatedAt,
+			}
+			summaries[backorder.SkuID] = summary
+		}
+		summary.Backorders++
+		summary.QuantityOutstanding += backorder.Quantity - backorder.QuantityFilled
+		if backorder.CreatedAt.Before(summary.OldestCreatedAt) {
+			summary.OldestCreatedAt = backorder.CreatedAt
+		}
+		totalAge[backorder.SkuID] += now.Sub(backorder.CreatedAt).Hours() / 24
+	}
+
+	report := []models.BackorderSummary{}
+	for skuID, summary := range summaries {
+		summary.OldestAgeDays = int(now.Sub(summary.OldestCreatedAt).Hours() / 24)
+		summary.AverageAgeDays = math.Round(totalAge[skuID]/float64(summary.Backorders)*10) / 10
+		report = append(report, *summary)
+	}
+	slices.SortFunc(report, func(a, b models.BackorderSummary) int {
+		return a.OldestCreatedAt.Compare(b.OldestCreatedAt)
+	})
+
+	return c.Status(fiber.StatusOK).JSON(report)
+}
@@ -0,0 +1,411 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/database"
+	"ucrs.com/inventory-manager/backend/internal/models"
+)
+
+const defaultReservationTTL = 24 * time.Hour
+
+// Identifies the stock of one sku at one location
+type stockKey struct {
+	SkuID      uuid.UUID
+	LocationID uuid.UUID
+}
+
+// Marks every active reservation past its expiry as expired, releasing its stock. Reservations
+// without an expiry are left alone.
+func expireReservations(supabaseClient *supabase.Client) error {
+	now := time.Now()
+	_, _, err := supabaseClient.From("reservations").Update(map[string]interface{}{
+		"status":     models.ReservationStatusExpired,
+		"updated_at": now,
+	}, "", "").Eq("status", models.ReservationStatusActive).Lte("expires_at", now.Format(time.RFC3339)).Execute()
+	return err
+}
+
+// Fetches unexpired active reservations, optionally filtered by sku and/or location (pass "" to skip a filter)
+func fetchActiveReservations(supabaseClient *supabase.Client, skuID, locationID string) ([]models.Reservation, error) {
+	if err := expireReservations(supabaseClient); err != nil {
+		return nil, err
+	}
+
+	query := supabaseClient.From("reservations").Select("*", "", false).Eq("status", models.ReservationStatusActive)
+	if skuID != "" {
+		query = query.Eq("sku_id", skuID)
+	}
+	if locationID != "" {
+		query = query.Eq("location_id", locationID)
+	}
+	reservations, _, err := query.Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.Reservation{}
+	err = json.Unmarshal(reservations, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	return respStruct, nil
+}
+
+func sumReservations(reservations []models.Reservation) map[stockKey]int {
+	reserved := map[stockKey]int{}
+	for _, r := range reservations {
+		reserved[stockKey{r.SkuID, r.LocationID}] += r.Quantity
+	}
+	return reserved
+}
+
+func fetchReservedQuantity(supabaseClient *supabase.Client, skuID, locationID uuid.UUID) (int, error) {
+	reservations, err := fetchActiveReservations(supabaseClient, skuID.String(), locationID.String())
+	if err != nil {
+		return 0, err
+	}
+	return sumReservations(reservations)[stockKey{skuID, locationID}], nil
+}
+
+// Available quantity is on-hand stock less active reservations
+func fetchAvailableQuantity(supabaseClient *supabase.Client, skuID, locationID uuid.UUID) (int, error) {
+	onHand, err := fetchOnHandQuantity(supabaseClient, skuID, locationID)
+	if err != nil {
+		return 0, err
+	}
+	reserved, err := fetchReservedQuantity(supabaseClient, skuID, locationID)
+	if err != nil {
+		return 0, err
+	}
+	return onHand - reserved, nil
+}
+
+func applyReservations(inventory []models.Inventory, reservations []models.Reservation) []models.InventoryLevel {
+	reserved := sumReservations(reservations)
+	levels := make([]models.InventoryLevel, len(inventory))
+	for i, inv := range inventory {
+		r := reserved[stockKey{inv.SkuID, inv.LocationID}]
+		levels[i] = models.InventoryLevel{
+			Inventory: inv,
+			Reserved:  r,
+			Available: inv.Quantity - r,
+		}
+	}
+	return levels
+}
+
+// Fetches a reservation by ID - returns nil if it does not exist
+func fetchReservation(supabaseClient *supabase.Client, reservationID string) (*models.Reservation, error) {
+	if err := expireReservations(supabaseClient); err != nil {
+		return nil, err
+	}
+	reservation, _, err := supabaseClient.From("reservations").Select("*", "", false).Eq("id", reservationID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.Reservation{}
+	err = json.Unmarshal(reservation, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	if len(respStruct) == 0 {
+		return nil, nil
+	}
+	return &respStruct[0], nil
+}
+
+func setReservationStatus(supabaseClient *supabase.Client, reservation *models.Reservation, status string) error {
+	reservation.Status = status
+	reservation.UpdatedAt = time.Now()
+	_, _, err := supabaseClient.From("reservations").Update(reservation, "", "").Eq("id", reservation.ID.String()).Execute()
+	return err
+}
+
+// Saves a new reservation if enough stock is available, suggesting the lots to pick FEFO. If not,
+// ErrInsufficientStock is returned with the quantity that is available.
+func reserveStock(supabaseClient *supabase.Client, reservation *models.Reservation) (int, error) {
+	available, err := fetchAvailableQuantity(supabaseClient, reservation.SkuID, reservation.LocationID)
+	if err != nil {
+		return 0, err
+	}
+	if available < reservation.Quantity {
+		return available, ErrInsufficientStock
+	}
+
+	lots, err := fetchLots(supabaseClient, reservation.SkuID.String(), reservation.LocationID.String())
+	if err != nil {
+		return 0, err
+	}
+	reservation.Lots, _ = allocateFEFO(lots, reservation.Quantity, time.Now())
+
+	_, _, err = supabaseClient.From("reservations").Insert(reservation, false, "", "", "").Execute()
+	if err != nil {
+		return 0, err
+	}
+
+	//Re-check now the reservation is saved - if a concurrent request took the same stock, back this one out
+	available, err = fetchAvailableQuantity(supabaseClient, reservation.SkuID, reservation.LocationID)
+	if err != nil || available < 0 {
+		supabaseClient.From("reservations").Delete("", "").Eq("id", reservation.ID.String()).Execute()
+		if err != nil {
+			return 0, err
+		}
+		return available + reservation.Quantity, ErrInsufficientStock
+	}
+	return available, nil
+}
+
+func CreateReservation(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	reservation := new(models.Reservation)
+
+	if err := c.BodyParser(reservation); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	// Basic validation
+	if reservation.SkuID == uuid.Nil || reservation.LocationID == uuid.Nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "SKU ID and location ID are required",
+		})
+	}
+
+	if reservation.Quantity <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Quantity must be greater than 0",
+		})
+	}
+
+	quantity, err := toBaseQuantity(supabaseClient, reservation.SkuID, reservation.Unit, reservation.Quantity)
+	if err != nil {
+		return unitErrorResponse(c, err)
+	}
+	reservation.Quantity = quantity
+	reservation.Unit = ""
+
+	now := time.Now()
+	if reservation.ExpiresAt == nil {
+		expiresAt := now.Add(defaultReservationTTL)
+		reservation.ExpiresAt = &expiresAt
+	}
+	if !reservation.ExpiresAt.After(now) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Expiry must be in the future",
+		})
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+	reservation.UserID = userID
+	reservation.ID = uuid.New()
+	reservation.Status = models.ReservationStatusActive
+	reservation.CreatedAt = now
+	reservation.UpdatedAt = now
+
+	available, err := reserveStock(supabaseClient, reservation)
+	if errors.Is(err, ErrInsufficientStock) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":     "Insufficient available stock",
+			"available": available,
+		})
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save reservation to database",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(reservation)
+}
+
+func GetReservations(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+
+	if err := expireReservations(supabaseClient); err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot update reservations in database",
+		})
+	}
+
+	query := supabaseClient.From("reservations").Select("*", "", false)
+	if skuID := c.Query("sku_id"); skuID != "" {
+		query = query.Eq("sku_id", skuID)
+	}
+	if locationID := c.Query("location_id"); locationID != "" {
+		query = query.Eq("location_id", locationID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Eq("status", status)
+	}
+	reservations, _, err := query.Order("created_at", nil).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch reservations from database",
+		})
+	}
+	respStruct := []models.Reservation{}
+	err = json.Unmarshal(reservations, &respStruct)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal reservation from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(respStruct)
+}
+
+func GetReservation(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	reservationID := c.Params("id")
+
+	reservation, err := fetchReservation(supabaseClient, reservationID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch reservation from database",
+		})
+	}
+	if reservation == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Reservation not found",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(reservation)
+}
+
+// Releases an active reservation, returning its stock to available
+func ReleaseReservation(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	reservationID := c.Params("id")
+
+	reservation, err := fetchReservation(supabaseClient, reservationID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch reservation from database",
+		})
+	}
+	if reservation == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Reservation not found",
+		})
+	}
+	if reservation.Status != models.ReservationStatusActive {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Reservation is not active",
+		})
+	}
+
+	err = setReservationStatus(supabaseClient, reservation, models.ReservationStatusReleased)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save reservation to database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Reservation released successfully",
+	})
+}
+
+// Ships the reserved stock - the reservation is consumed and a shipment is recorded in the ledger,
+// picking from the sku's lots first-expired-first-out
+func FulfilReservation(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	reservationID := c.Params("id")
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	reservation, err := fetchReservation(supabaseClient, reservationID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch reservation from database",
+		})
+	}
+	if reservation == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Reservation not found",
+		})
+	}
+	if reservation.Status != models.ReservationStatusActive {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Reservation is not active",
+		})
+	}
+
+	//Consume the reservation first so the shipment can draw on the stock it was holding
+	err = setReservationStatus(supabaseClient, reservation, models.ReservationStatusFulfilled)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save reservation to database",
+		})
+	}
+
+	reference := "reservation:" + reservation.ID.String()
+	if reservation.Reference != "" {
+		reference = reservation.Reference
+	}
+	allocations, _, err := recordFEFOShipment(supabaseClient, models.StockMovement{
+		SkuID:      reservation.SkuID,
+		LocationID: reservation.LocationID,
+		UserID:     userID,
+		Reason:     models.MovementReasonShipment,
+		Reference:  reference,
+	}, reservation.Quantity)
+	if err != nil {
+		fmt.Println(err)
+		setReservationStatus(supabaseClient, reservation, models.ReservationStatusActive)
+		if errors.Is(err, ErrInsufficientStock) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Insufficient stock to fulfil reservation",
+			})
+		}
+		if errors.Is(err, ErrSerialRequired) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Serialized SKUs must be shipped by serial number",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot update inventory in database",
+		})
+	}
+	onHand, err := fetchOnHandQuantity(supabaseClient, reservation.SkuID, reservation.LocationID)
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"reservation": reservation,
+		"inventory": models.Inventory{
+			SkuID:      reservation.SkuID,
+			LocationID: reservation.LocationID,
+			UserID:     userID,
+			Quantity:   onHand,
+			UpdatedAt:  reservation.UpdatedAt,
+		},
+		"lots": allocations,
+	})
+}
@@ -0,0 +1,723 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/database"
+	"ucrs.com/inventory-manager/backend/internal/models"
+)
+
+func convertReturnForDB(ret *models.Return) *models.ReturnDatabase {
+	return &models.ReturnDatabase{
+		ID:             ret.ID,
+		UserID:         ret.UserID,
+		CustomerID:     ret.CustomerID,
+		OrderReference: ret.OrderReference,
+		WarehouseID:    ret.WarehouseID,
+		Status:         ret.Status,
+		Reason:         ret.Reason,
+		Notes:          ret.Notes,
+		ReceivedAt:     ret.ReceivedAt,
+		ClosedAt:       ret.ClosedAt,
+		CreatedAt:      ret.CreatedAt,
+		UpdatedAt:      ret.UpdatedAt,
+	}
+}
+
+func convertReturnForJSON(ret *models.ReturnDatabase, lines []models.ReturnLine) *models.Return {
+	return &models.Return{
+		ID:             ret.ID,
+		UserID:         ret.UserID,
+		CustomerID:     ret.CustomerID,
+		OrderReference: ret.OrderReference,
+		WarehouseID:    ret.WarehouseID,
+		Status:         ret.Status,
+		Reason:         ret.Reason,
+		Notes:          ret.Notes,
+		Lines:          lines,
+		ReceivedAt:     ret.ReceivedAt,
+		ClosedAt:       ret.ClosedAt,
+		CreatedAt:      ret.CreatedAt,
+		UpdatedAt:      ret.UpdatedAt,
+	}
+}
+
+// Fetches a return with its lines - returns nil if the return does not exist
+func fetchReturn(supabaseClient *supabase.Client, returnID string) (*models.Return, error) {
+	ret, _, err := supabaseClient.From("returns").Select("*", "", false).Eq("id", returnID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.ReturnDatabase{}
+	err = json.Unmarshal(ret, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	if len(respStruct) == 0 {
+		return nil, nil
+	}
+
+	lines, _, err := supabaseClient.From("return_lines").Select("*", "", false).Eq("return_id", returnID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respLines := []models.ReturnLine{}
+	err = json.Unmarshal(lines, &respLines)
+	if err != nil {
+		return nil, err
+	}
+
+	return convertReturnForJSON(&respStruct[0], respLines), nil
+}
+
+// Fetches a quarantine record - returns nil if it does not exist
+func fetchQuarantineStock(supabaseClient *supabase.Client, quarantineID string) (*models.QuarantineStock, error) {
+	stock, _, err := supabaseClient.From("quarantine_stock").Select("*", "", false).Eq("id", quarantineID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.QuarantineStock{}
+	err = json.Unmarshal(stock, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	if len(respStruct) == 0 {
+		return nil, nil
+	}
+	return &respStruct[0], nil
+}
+
+// Received items still waiting for a disposition
+func uninspectedQuantity(line models.ReturnLine) int {
+	return line.QuantityReceived - line.QuantityRestocked - line.QuantityQuarantined - line.QuantityScrapped
+}
+
+// Authorizes a customer to return quantities of skus from one of their orders
+func CreateReturn(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	ret := new(models.Return)
+
+	if err := c.BodyParser(ret); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	// Basic validation
+	if ret.CustomerID == uuid.Nil || ret.OrderReference == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Customer and order reference are required",
+		})
+	}
+
+	if len(ret.Lines) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Return must have at least one line",
+		})
+	}
+
+	customer, err := fetchCustomer(supabaseClient, ret.CustomerID.String())
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch customer from database",
+		})
+	}
+	if customer == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Customer not found",
+		})
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	ret.ID = uuid.New()
+	ret.UserID = userID
+	ret.Status = models.ReturnStatusAuthorized
+	ret.WarehouseID = nil
+	ret.ReceivedAt = nil
+	ret.ClosedAt = nil
+
+	//Lines for the same sku are merged so each sku appears once on the return
+	lines := []models.ReturnLine{}
+	lineIndex := map[uuid.UUID]int{}
+	for _, line := range ret.Lines {
+		if line.SkuID == uuid.Nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "SKU ID is required on every line",
+			})
+		}
+		if line.QuantityAuthorized <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Authorized quantity must be greater than 0",
+			})
+		}
+		line.QuantityAuthorized, err = toBaseQuantity(supabaseClient, line.SkuID, line.Unit, line.QuantityAuthorized)
+		if err != nil {
+			return unitErrorResponse(c, err)
+		}
+		if i, ok := lineIndex[line.SkuID]; ok {
+			lines[i].QuantityAuthorized += line.QuantityAuthorized
+			continue
+		}
+
+		sku, err := fetchSKU(supabaseClient, line.SkuID.String())
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch SKU from database",
+			})
+		}
+		if sku == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":  "SKU not found",
+				"sku_id": line.SkuID,
+			})
+		}
+		if sku.Serialized {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  "Serialized SKUs must be returned by serial number",
+				"sku_id": line.SkuID,
+			})
+		}
+
+		lineIndex[line.SkuID] = len(lines)
+		lines = append(lines, models.ReturnLine{
+			ID:                 uuid.New(),
+			ReturnID:           ret.ID,
+			SkuID:              line.SkuID,
+			UserID:             userID,
+			QuantityAuthorized: line.QuantityAuthorized,
+		})
+	}
+	ret.Lines = lines
+
+	// Set timestamps
+	now := time.Now()
+	ret.CreatedAt = now
+	ret.UpdatedAt = now
+
+	//Save to database
+	_, _, err = supabaseClient.From("returns").Insert(convertReturnForDB(ret), false, "", "", "").Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save return to database",
+		})
+	}
+
+	_, _, err = supabaseClient.From("return_lines").Insert(ret.Lines, false, "", "", "").Execute()
+	if err != nil {
+		fmt.Println(err)
+		//Don't leave a return without lines behind
+		supabaseClient.From("returns").Delete("", "").Eq("id", ret.ID.String()).Execute()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save return lines to database",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(ret)
+}
+
+func GetReturns(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	query := supabaseClient.From("returns").Select("*", "", false)
+	if status := c.Query("status"); status != "" {
+		query = query.Eq("status", status)
+	}
+	if customerID := c.Query("customer_id"); customerID != "" {
+		query = query.Eq("customer_id", customerID)
+	}
+	if orderReference := c.Query("order_reference"); orderReference != "" {
+		query = query.Eq("order_reference", orderReference)
+	}
+	returns, _, err := query.Order("created_at", nil).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch returns from database",
+		})
+	}
+	respStruct := []models.ReturnDatabase{}
+	err = json.Unmarshal(returns, &respStruct)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal returns from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(respStruct)
+}
+
+func GetReturn(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	returnID := c.Params("id")
+
+	ret, err := fetchReturn(supabaseClient, returnID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch return from database",
+		})
+	}
+	if ret == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Return not found",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(ret)
+}
+
+// Receives returned items into a warehouse. They are held for inspection and are not added to
+// inventory until they are restocked.
+func ReceiveReturn(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	returnID := c.Params("id")
+	request := new(struct {
+		WarehouseID uuid.UUID `json:"warehouse_id"`
+		Lines       []struct {
+			SkuID    uuid.UUID `json:"sku_id"`
+			Quantity int       `json:"quantity"`
+			Unit     string    `json:"unit"`
+		} `json:"lines"`
+	})
+	if err := c.BodyParser(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	if len(request.Lines) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Receipt must have at least one line",
+		})
+	}
+
+	ret, err := fetchReturn(supabaseClient, returnID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch return from database",
+		})
+	}
+	if ret == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Return not found",
+		})
+	}
+	if ret.Status != models.ReturnStatusAuthorized && ret.Status != models.ReturnStatusReceived {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Only open returns can be received",
+		})
+	}
+
+	//All items of a return are received into the same warehouse
+	if ret.WarehouseID == nil {
+		if request.WarehouseID == uuid.Nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Warehouse is required",
+			})
+		}
+		ret.WarehouseID = &request.WarehouseID
+	} else if request.WarehouseID != uuid.Nil && request.WarehouseID != *ret.WarehouseID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Return is already being received into another warehouse",
+		})
+	}
+
+	lineIndex := map[uuid.UUID]int{}
+	for i, line := range ret.Lines {
+		lineIndex[line.SkuID] = i
+	}
+
+	//Validate the whole receipt first - items beyond what was authorized are rejected
+	received := map[uuid.UUID]int{}
+	for _, line := range request.Lines {
+		i, ok := lineIndex[line.SkuID]
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  "SKU is not on this return",
+				"sku_id": line.SkuID,
+			})
+		}
+		if line.Quantity <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Received quantity must be greater than 0",
+			})
+		}
+		quantity, err := toBaseQuantity(supabaseClient, line.SkuID, line.Unit, line.Quantity)
+		if err != nil {
+			return unitErrorResponse(c, err)
+		}
+		received[line.SkuID] += quantity
+		if ret.Lines[i].QuantityReceived+received[line.SkuID] > ret.Lines[i].QuantityAuthorized {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  "Received quantity exceeds quantity authorized",
+				"sku_id": line.SkuID,
+			})
+		}
+	}
+
+	for skuID, quantity := range received {
+		i := lineIndex[skuID]
+		ret.Lines[i].QuantityReceived += quantity
+		_, _, err = supabaseClient.From("return_lines").Update(ret.Lines[i], "", "").Eq("id", ret.Lines[i].ID.String()).Execute()
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  "Cannot save return line to database",
+				"sku_id": skuID,
+			})
+		}
+	}
+
+	now := time.Now()
+	ret.Status = models.ReturnStatusReceived
+	ret.ReceivedAt = &now
+	ret.UpdatedAt = now
+	_, _, err = supabaseClient.From("returns").Update(convertReturnForDB(ret), "", "").Eq("id", returnID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save return to database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(ret)
+}
+
+// Records the inspection of received items. Restocked items are added back to inventory,
+// quarantined ones are held aside at the warehouse and scrapped ones are written off. The return
+// is closed once everything authorized has been received and inspected.
+func InspectReturn(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	returnID := c.Params("id")
+	request := new(struct {
+		Lines []struct {
+			SkuID       uuid.UUID `json:"sku_id"`
+			Disposition string    `json:"disposition"`
+			Quantity    int       `json:"quantity"`
+			Unit        string    `json:"unit"`
+			Reason      string    `json:"reason"`
+		} `json:"lines"`
+		Close bool `json:"close"` //Close even if authorized items never arrived
+	})
+	if err := c.BodyParser(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	ret, err := fetchReturn(supabaseClient, returnID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch return from database",
+		})
+	}
+	if ret == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Return not found",
+		})
+	}
+	if ret.Status != models.ReturnStatusReceived {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Only received returns can be inspected",
+		})
+	}
+
+	lineIndex := map[uuid.UUID]int{}
+	for i, line := range ret.Lines {
+		lineIndex[line.SkuID] = i
+	}
+
+	//Validate the whole inspection first - only received items waiting for inspection can be given a disposition
+	inspected := map[uuid.UUID]int{}
+	for i, line := range request.Lines {
+		index, ok := lineIndex[line.SkuID]
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  "SKU is not on this return",
+				"sku_id": line.SkuID,
+			})
+		}
+		request.Lines[i].Disposition = strings.ToLower(line.Disposition)
+		if !models.IsValidDisposition(request.Lines[i].Disposition) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Disposition must be restock, quarantine or scrap",
+			})
+		}
+		if line.Quantity <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Inspected quantity must be greater than 0",
+			})
+		}
+		request.Lines[i].Quantity, err = toBaseQuantity(supabaseClient, line.SkuID, line.Unit, line.Quantity)
+		if err != nil {
+			return unitErrorResponse(c, err)
+		}
+		inspected[line.SkuID] += request.Lines[i].Quantity
+		if inspected[line.SkuID] > uninspectedQuantity(ret.Lines[index]) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  "Inspected quantity exceeds items received and waiting for inspection",
+				"sku_id": line.SkuID,
+			})
+		}
+	}
+
+	now := time.Now()
+	for _, line := range request.Lines {
+		i := lineIndex[line.SkuID]
+		//The disposition and the line are saved together - if the line can't be saved the stock is taken back
+		movements := []*models.StockMovement{}
+		var quarantine *models.QuarantineStock
+		switch line.Disposition {
+		case models.DispositionRestock:
+			movement := &models.StockMovement{
+				SkuID:      line.SkuID,
+				LocationID: *ret.WarehouseID,
+				UserID:     userID,
+				Quantity:   line.Quantity,
+				Reason:     models.MovementReasonReturn,
+				Reference:  "rma:" + ret.ID.String(),
+			}
+			_, err = applyStockMovement(supabaseClient, movement)
+			if err == nil {
+				movements = append(movements, movement)
+			}
+			ret.Lines[i].QuantityRestocked += line.Quantity
+		case models.DispositionQuarantine:
+			quarantine = &models.QuarantineStock{
+				ID:          uuid.New(),
+				SkuID:       line.SkuID,
+				WarehouseID: *ret.WarehouseID,
+				ReturnID:    &ret.ID,
+				UserID:      userID,
+				Quantity:    line.Quantity,
+				Reason:      line.Reason,
+				CreatedAt:   now,
+			}
+			_, _, err = supabaseClient.From("quarantine_stock").Insert(quarantine, false, "", "", "").Execute()
+			ret.Lines[i].QuantityQuarantined += line.Quantity
+		case models.DispositionScrap:
+			ret.Lines[i].QuantityScrapped += line.Quantity
+		}
+		if err == nil {
+			_, _, err = supabaseClient.From("return_lines").Update(ret.Lines[i], "", "").Eq("id", ret.Lines[i].ID.String()).Execute()
+			if err != nil {
+				if reverseErr := reverseStockMovements(supabaseClient, movements); reverseErr != nil {
+					fmt.Println(reverseErr)
+				}
+				if quarantine != nil {
+					if _, _, deleteErr := supabaseClient.From("quarantine_stock").Delete("", "").Eq("id", quarantine.ID.String()).Execute(); deleteErr != nil {
+						fmt.Println(deleteErr)
+					}
+				}
+			}
+		}
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  "Cannot save inspection to database",
+				"sku_id": line.SkuID,
+			})
+		}
+		offerToBackorders(supabaseClient, movements)
+	}
+
+	complete := true
+	for _, line := range ret.Lines {
+		if uninspectedQuantity(line) > 0 || (!request.Close && line.QuantityReceived < line.QuantityAuthorized) {
+			complete = false
+		}
+	}
+	if complete {
+		ret.Status = models.ReturnStatusClosed
+		ret.ClosedAt = &now
+	}
+	ret.UpdatedAt = now
+	_, _, err = supabaseClient.From("returns").Update(convertReturnForDB(ret), "", "").Eq("id", returnID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save return to database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(ret)
+}
+
+// Cancels a return that nothing has been received against yet
+func CancelReturn(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	returnID := c.Params("id")
+
+	ret, err := fetchReturn(supabaseClient, returnID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch return from database",
+		})
+	}
+	if ret == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Return not found",
+		})
+	}
+	if ret.Status != models.ReturnStatusAuthorized {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Only returns with nothing received can be cancelled",
+		})
+	}
+
+	now := time.Now()
+	ret.Status = models.ReturnStatusCancelled
+	ret.ClosedAt = &now
+	ret.UpdatedAt = now
+	_, _, err = supabaseClient.From("returns").Update(convertReturnForDB(ret), "", "").Eq("id", returnID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save return to database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Return cancelled successfully",
+	})
+}
+
+// Lists stock held in quarantine - unreleased only unless ?released=true
+func GetQuarantineStock(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	query := supabaseClient.From("quarantine_stock").Select("*", "", false)
+	if c.Query("released") != "true" {
+		query = query.Is("released_at", "null")
+	}
+	if warehouseID := c.Query("warehouse_id"); warehouseID != "" {
+		query = query.Eq("warehouse_id", warehouseID)
+	}
+	if skuID := c.Query("sku_id"); skuID != "" {
+		query = query.Eq("sku_id", skuID)
+	}
+	stock, _, err := query.Order("created_at", nil).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch quarantine stock from database",
+		})
+	}
+	respStruct := []models.QuarantineStock{}
+	err = json.Unmarshal(stock, &respStruct)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal quarantine stock from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(respStruct)
+}
+
+// Releases quarantined stock, either back into inventory ("restock") or written off ("scrap")
+func ReleaseQuarantineStock(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	quarantineID := c.Params("id")
+	request := new(struct {
+		Disposition string `json:"disposition"`
+	})
+	if err := c.BodyParser(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	request.Disposition = strings.ToLower(request.Disposition)
+	if request.Disposition != models.DispositionRestock && request.Disposition != models.DispositionScrap {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Disposition must be restock or scrap",
+		})
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	stock, err := fetchQuarantineStock(supabaseClient, quarantineID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch quarantine stock from database",
+		})
+	}
+	if stock == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Quarantine stock not found",
+		})
+	}
+	if stock.ReleasedAt != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Quarantine stock has already been released",
+		})
+	}
+
+	//Mark it released first so a repeated request can't restock it twice
+	now := time.Now()
+	stock.Disposition = request.Disposition
+	stock.ReleasedAt = &now
+	_, _, err = supabaseClient.From("quarantine_stock").Update(stock, "", "").Eq("id", quarantineID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save quarantine stock to database",
+		})
+	}
+
+	if request.Disposition == models.DispositionRestock {
+		reference := "quarantine:" + stock.ID.String()
+		if stock.ReturnID != nil {
+			reference = "rma:" + stock.ReturnID.String()
+		}
+		_, err = recordStockMovement(supabaseClient, &models.StockMovement{
+			SkuID:      stock.SkuID,
+			LocationID: stock.WarehouseID,
+			UserID:     userID,
+			Quantity:   stock.Quantity,
+			Reason:     models.MovementReasonReturn,
+			Reference:  reference,
+		})
+		if err != nil {
+			fmt.Println(err)
+			//Put it back in quarantine so it can be released again
+			supabaseClient.From("quarantine_stock").Update(map[string]interface{}{
+				"disposition": nil,
+				"released_at": nil,
+			}, "", "").Eq("id", quarantineID).Execute()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot update inventory in database",
+			})
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(stock)
+}
@@ -0,0 +1,1194 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/supabase-community/postgrest-go"
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/database"
+	"ucrs.com/inventory-manager/backend/internal/models"
+)
+
+// Allocations are reservations, so they lapse if an order is left unshipped for this long
+const salesOrderAllocationTTL = 30 * 24 * time.Hour
+
+func convertSalesOrderForDB(order *models.SalesOrder) *models.SalesOrderDatabase {
+	return &models.SalesOrderDatabase{
+		ID:              order.ID,
+		UserID:          order.UserID,
+		CustomerID:      order.CustomerID,
+		Status:          order.Status,
+		Reference:       order.Reference,
+		ShippingAddress: order.ShippingAddress,
+		Notes:           order.Notes,
+		ShippedAt:       order.ShippedAt,
+		CreatedAt:       order.CreatedAt,
+		UpdatedAt:       order.UpdatedAt,
+	}
+}
+
+func convertSalesOrderForJSON(order *models.SalesOrderDatabase, lines []models.SalesOrderLine) *models.SalesOrder {
+	return &models.SalesOrder{
+		ID:              order.ID,
+		UserID:          order.UserID,
+		CustomerID:      order.CustomerID,
+		Status:          order.Status,
+		Reference:       order.Reference,
+		ShippingAddress: order.ShippingAddress,
+		Notes:           order.Notes,
+		Lines:           lines,
+		ShippedAt:       order.ShippedAt,
+		CreatedAt:       order.CreatedAt,
+		UpdatedAt:       order.UpdatedAt,
+	}
+}
+
+func convertShipmentForDB(shipment *models.Shipment) *models.ShipmentDatabase {
+	return &models.ShipmentDatabase{
+		ID:             shipment.ID,
+		SalesOrderID:   shipment.SalesOrderID,
+		WarehouseID:    shipment.WarehouseID,
+		UserID:         shipment.UserID,
+		Status:         shipment.Status,
+		Carrier:        shipment.Carrier,
+		TrackingNumber: shipment.TrackingNumber,
+		DispatchedAt:   shipment.DispatchedAt,
+		CreatedAt:      shipment.CreatedAt,
+		UpdatedAt:      shipment.UpdatedAt,
+	}
+}
+
+func convertShipmentForJSON(shipment *models.ShipmentDatabase, lines []models.ShipmentLine) *models.Shipment {
+	return &models.Shipment{
+		ID:             shipment.ID,
+		SalesOrderID:   shipment.SalesOrderID,
+		WarehouseID:    shipment.WarehouseID,
+		UserID:         shipment.UserID,
+		Status:         shipment.Status,
+		Carrier:        shipment.Carrier,
+		TrackingNumber: shipment.TrackingNumber,
+		Lines:          lines,
+		DispatchedAt:   shipment.DispatchedAt,
+		CreatedAt:      shipment.CreatedAt,
+		UpdatedAt:      shipment.UpdatedAt,
+	}
+}
+
+// The reference a sales order's reservations and stock movements are recorded under
+func salesOrderReference(orderID uuid.UUID) string {
+	return "so:" + orderID.String()
+}
+
+// Fetches the unexpired active reservations holding stock for an order, oldest first
+func fetchOrderReservations(supabaseClient *supabase.Client, reference string) ([]models.Reservation, error) {
+	if err := expireReservations(supabaseClient); err != nil {
+		return nil, err
+	}
+	reservations, _, err := supabaseClient.From("reservations").Select("*", "", false).Eq("reference", reference).Eq("status", models.ReservationStatusActive).Order("created_at", &postgrest.OrderOpts{Ascending: true}).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.Reservation{}
+	err = json.Unmarshal(reservations, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	return respStruct, nil
+}
+
+// Fetches a sales order with its lines - returns nil if the order does not exist. Allocated
+// quantities are read from the order's reservations, so allocations that have lapsed drop out.
+func fetchSalesOrder(supabaseClient *supabase.Client, orderID string) (*models.SalesOrder, error) {
+	order, _, err := supabaseClient.From("sales_orders").Select("*", "", false).Eq("id", orderID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.SalesOrderDatabase{}
+	err = json.Unmarshal(order, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	if len(respStruct) == 0 {
+		return nil, nil
+	}
+
+	lines, _, err := supabaseClient.From("sales_order_lines").Select("*", "", false).Eq("sales_order_id", orderID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respLines := []models.SalesOrderLine{}
+	err = json.Unmarshal(lines, &respLines)
+	if err != nil {
+		return nil, err
+	}
+
+	reservations, err := fetchOrderReservations(supabaseClient, salesOrderReference(respStruct[0].ID))
+	if err != nil {
+		return nil, err
+	}
+	allocated := sumReservations(reservations)
+	for i, line := range respLines {
+		respLines[i].QuantityAllocated = allocated[stockKey{line.SkuID, line.WarehouseID}]
+	}
+
+	return convertSalesOrderForJSON(&respStruct[0], respLines), nil
+}
+
+// Fetches a shipment with its lines - returns nil if the shipment does not exist
+func fetchShipment(supabaseClient *supabase.Client, shipmentID string) (*models.Shipment, error) {
+	shipment, _, err := supabaseClient.From("shipments").Select("*", "", false).Eq("id", shipmentID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.ShipmentDatabase{}
+	err = json.Unmarshal(shipment, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	if len(respStruct) == 0 {
+		return nil, nil
+	}
+
+	lines, _, err := supabaseClient.From("shipment_lines").Select("*", "", false).Eq("shipment_id", shipmentID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respLines := []models.ShipmentLine{}
+	err = json.Unmarshal(lines, &respLines)
+	if err != nil {
+		return nil, err
+	}
+
+	return convertShipmentForJSON(&respStruct[0], respLines), nil
+}
+
+func isOpenSalesOrder(order *models.SalesOrder) bool {
+	switch order.Status {
+	case models.SalesOrderStatusDraft, models.SalesOrderStatusAllocated, models.SalesOrderStatusPicking, models.SalesOrderStatusPacked:
+		return true
+	}
+	return false
+}
+
+func recordSalesOrderEvent(supabaseClient *supabase.Client, event *models.SalesOrderEvent) error {
+	event.ID = uuid.New()
+	event.CreatedAt = time.Now()
+	_, _, err := supabaseClient.From("sales_order_events").Insert(event, false, "", "", "").Execute()
+	return err
+}
+
+// Saves an order's header and records the change in its audit trail. The event is written first,
+// so no change goes unrecorded - if the header then can't be saved the event is removed again.
+func saveSalesOrder(supabaseClient *supabase.Client, order *models.SalesOrder, event *models.SalesOrderEvent) error {
+	event.FromStatus = order.Status
+	if event.ToStatus == "" {
+		event.ToStatus = order.Status
+	}
+	event.SalesOrderID = order.ID
+	if err := recordSalesOrderEvent(supabaseClient, event); err != nil {
+		return err
+	}
+
+	order.Status = event.ToStatus
+	order.UpdatedAt = time.Now()
+	_, _, err := supabaseClient.From("sales_orders").Update(convertSalesOrderForDB(order), "", "").Eq("id", order.ID.String()).Execute()
+	if err != nil {
+		order.Status = event.FromStatus
+		if _, _, deleteErr := supabaseClient.From("sales_order_events").Delete("", "").Eq("id", event.ID.String()).Execute(); deleteErr != nil {
+			fmt.Println(deleteErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// Takes quantity off reservations, oldest first, so the stock they were holding can be shipped.
+// Reservations that are used up are marked fulfilled.
+func consumeReservations(supabaseClient *supabase.Client, reservations []models.Reservation, quantity int) error {
+	for i := range reservations {
+		if quantity == 0 {
+			break
+		}
+		take := min(reservations[i].Quantity, quantity)
+		quantity -= take
+		if take == reservations[i].Quantity {
+			if err := setReservationStatus(supabaseClient, &reservations[i], models.ReservationStatusFulfilled); err != nil {
+				return err
+			}
+			continue
+		}
+		reservations[i].Quantity -= take
+		reservations[i].UpdatedAt = time.Now()
+		_, _, err := supabaseClient.From("reservations").Update(reservations[i], "", "").Eq("id", reservations[i].ID.String()).Execute()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Puts reservations back as they were before consumeReservations took from them
+func restoreReservations(supabaseClient *supabase.Client, reservations []models.Reservation) {
+	for _, reservation := range reservations {
+		_, _, err := supabaseClient.From("reservations").Update(reservation, "", "").Eq("id", reservation.ID.String()).Execute()
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// Creates a draft sales order for a customer. Each line ships from the warehouse given on it.
+func CreateSalesOrder(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	order := new(models.SalesOrder)
+
+	if err := c.BodyParser(order); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	// Basic validation
+	if order.CustomerID == uuid.Nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Customer is required",
+		})
+	}
+
+	if len(order.Lines) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Sales order must have at least one line",
+		})
+	}
+
+	customer, err := fetchCustomer(supabaseClient, order.CustomerID.String())
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch customer from database",
+		})
+	}
+	if customer == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Customer not found",
+		})
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	order.ID = uuid.New()
+	order.UserID = userID
+	order.Status = models.SalesOrderStatusDraft
+	order.ShippedAt = nil
+	if order.ShippingAddress == "" {
+		order.ShippingAddress = customer.ShippingAddress
+	}
+
+	//Lines for the same sku and warehouse are merged so each appears once on the order
+	lines := []models.SalesOrderLine{}
+	lineIndex := map[stockKey]int{}
+	for _, line := range order.Lines {
+		if line.SkuID == uuid.Nil || line.WarehouseID == uuid.Nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "SKU ID and warehouse are required on every line",
+			})
+		}
+		if line.Quantity <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Line quantity must be greater than 0",
+			})
+		}
+		if line.UnitPrice < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Unit price cannot be negative",
+			})
+		}
+		line.Quantity, err = toBaseQuantity(supabaseClient, line.SkuID, line.Unit, line.Quantity)
+		if err != nil {
+			return unitErrorResponse(c, err)
+		}
+
+		key := stockKey{line.SkuID, line.WarehouseID}
+		if i, ok := lineIndex[key]; ok {
+			lines[i].Quantity += line.Quantity
+			continue
+		}
+
+		sku, err := fetchSKU(supabaseClient, line.SkuID.String())
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch SKU from database",
+			})
+		}
+		if sku == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":  "SKU not found",
+				"sku_id": line.SkuID,
+			})
+		}
+		if sku.Serialized {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  "Serialized SKUs must be shipped by serial number",
+				"sku_id": line.SkuID,
+			})
+		}
+
+		lineIndex[key] = len(lines)
+		lines = append(lines, models.SalesOrderLine{
+			ID:           uuid.New(),
+			SalesOrderID: order.ID,
+			SkuID:        line.SkuID,
+			WarehouseID:  line.WarehouseID,
+			UserID:       userID,
+			Quantity:     line.Quantity,
+			UnitPrice:    line.UnitPrice,
+		})
+	}
+	order.Lines = lines
+
+	// Set timestamps
+	now := time.Now()
+	order.CreatedAt = now
+	order.UpdatedAt = now
+
+	//Save to database
+	_, _, err = supabaseClient.From("sales_orders").Insert(convertSalesOrderForDB(order), false, "", "", "").Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save sales order to database",
+		})
+	}
+
+	_, _, err = supabaseClient.From("sales_order_lines").Insert(order.Lines, false, "", "", "").Execute()
+	if err != nil {
+		fmt.Println(err)
+		//Don't leave an order without lines behind
+		supabaseClient.From("sales_orders").Delete("", "").Eq("id", order.ID.String()).Execute()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save sales order lines to database",
+		})
+	}
+
+	err = recordSalesOrderEvent(supabaseClient, &models.SalesOrderEvent{
+		SalesOrderID: order.ID,
+		UserID:       userID,
+		Action:       "created",
+		ToStatus:     order.Status,
+	})
+	if err != nil {
+		fmt.Println(err)
+		//Every order must have its creation in the audit trail
+		supabaseClient.From("sales_order_lines").Delete("", "").Eq("sales_order_id", order.ID.String()).Execute()
+		supabaseClient.From("sales_orders").Delete("", "").Eq("id", order.ID.String()).Execute()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save sales order event to database",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(order)
+}
+
+func GetSalesOrders(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	query := supabaseClient.From("sales_orders").Select("*", "", false)
+	if status := c.Query("status"); status != "" {
+		query = query.Eq("status", status)
+	}
+	if customerID := c.Query("customer_id"); customerID != "" {
+		query = query.Eq("customer_id", customerID)
+	}
+	orders, _, err := query.Order("created_at", nil).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch sales orders from database",
+		})
+	}
+	respStruct := []models.SalesOrderDatabase{}
+	err = json.Unmarshal(orders, &respStruct)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal sales orders from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(respStruct)
+}
+
+func GetSalesOrder(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	orderID := c.Params("id")
+
+	order, err := fetchSalesOrder(supabaseClient, orderID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch sales order from database",
+		})
+	}
+	if order == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Sales order not found",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(order)
+}
+
+// Lists the audit trail of a sales order, oldest first
+func GetSalesOrderEvents(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	orderID := c.Params("id")
+
+	events, _, err := supabaseClient.From("sales_order_events").Select("*", "", false).Eq("sales_order_id", orderID).Order("created_at", &postgrest.OrderOpts{Ascending: true}).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch sales order events from database",
+		})
+	}
+	respStruct := []models.SalesOrderEvent{}
+	err = json.Unmarshal(events, &respStruct)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal sales order events from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(respStruct)
+}
+
+// Allocates stock to an order's lines from their warehouses by reserving it. Lines are allocated
+// as far as available stock allows - the rest is reported as shortages and can be allocated later.
+func AllocateSalesOrder(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	orderID := c.Params("id")
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	order, err := fetchSalesOrder(supabaseClient, orderID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch sales order from database",
+		})
+	}
+	if order == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Sales order not found",
+		})
+	}
+	if !isOpenSalesOrder(order) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Only open sales orders can be allocated",
+		})
+	}
+
+	now := time.Now()
+	allocated := 0
+	shortages := []models.AllocationShortage{}
+	for i, line := range order.Lines {
+		outstanding := line.Quantity - line.QuantityShipped - line.QuantityAllocated
+		if outstanding <= 0 {
+			continue
+		}
+
+		available, err := fetchAvailableQuantity(supabaseClient, line.SkuID, line.WarehouseID)
+		if err == nil && available > 0 {
+			expiresAt := now.Add(salesOrderAllocationTTL)
+			reservation := &models.Reservation{
+				ID:         uuid.New(),
+				SkuID:      line.SkuID,
+				LocationID: line.WarehouseID,
+				UserID:     userID,
+				Quantity:   min(outstanding, available),
+				Reference:  salesOrderReference(order.ID),
+				Status:     models.ReservationStatusActive,
+				ExpiresAt:  &expiresAt,
+				CreatedAt:  now,
+				UpdatedAt:  now,
+			}
+			_, err = reserveStock(supabaseClient, reservation)
+			if err == nil {
+				order.Lines[i].QuantityAllocated += reservation.Quantity
+				outstanding -= reservation.Quantity
+				allocated += reservation.Quantity
+			}
+		}
+		//Stock taken by a concurrent request is reported as a shortage rather than failing the order
+		if err != nil && !errors.Is(err, ErrInsufficientStock) {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  "Cannot allocate stock in database",
+				"sku_id": line.SkuID,
+			})
+		}
+
+		if outstanding > 0 {
+			shortages = append(shortages, models.AllocationShortage{
+				SalesOrderLineID: line.ID,
+				SkuID:            line.SkuID,
+				WarehouseID:      line.WarehouseID,
+				Shortage:         outstanding,
+			})
+		}
+	}
+
+	for _, line := range order.Lines {
+		_, _, err = supabaseClient.From("sales_order_lines").Update(line, "", "").Eq("id", line.ID.String()).Execute()
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot save sales order line to database",
+			})
+		}
+	}
+
+	event := &models.SalesOrderEvent{
+		UserID:  userID,
+		Action:  "allocated",
+		Details: fmt.Sprintf("%d allocated, %d lines short", allocated, len(shortages)),
+	}
+	if order.Status == models.SalesOrderStatusDraft && allocated > 0 {
+		event.ToStatus = models.SalesOrderStatusAllocated
+	}
+	err = saveSalesOrder(supabaseClient, order, event)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save sales order to database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"sales_order": order,
+		"shortages":   shortages,
+	})
+}
+
+// Generates the pick lists for an order's allocated stock that hasn't been packed yet - one list
+// per warehouse, with the lots to pick first and the bins holding each sku
+func PickSalesOrder(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	orderID := c.Params("id")
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	order, err := fetchSalesOrder(supabaseClient, orderID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch sales order from database",
+		})
+	}
+	if order == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Sales order not found",
+		})
+	}
+	if !isOpenSalesOrder(order) || order.Status == models.SalesOrderStatusDraft {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Only allocated sales orders can be picked",
+		})
+	}
+
+	now := time.Now()
+	pickLists := []*models.PickList{}
+	listIndex := map[uuid.UUID]*models.PickList{}
+	bins := map[uuid.UUID][]models.BinInventory{}
+	for _, line := range order.Lines {
+		quantity := line.QuantityAllocated - (line.QuantityPacked - line.QuantityShipped)
+		if quantity <= 0 {
+			continue
+		}
+
+		list, ok := listIndex[line.WarehouseID]
+		if !ok {
+			list = &models.PickList{
+				SalesOrderID: order.ID,
+				WarehouseID:  line.WarehouseID,
+				Lines:        []models.PickListLine{},
+			}
+			listIndex[line.WarehouseID] = list
+			pickLists = append(pickLists, list)
+
+			bins[line.WarehouseID], err = fetchBinInventory(supabaseClient, "warehouse_id", line.WarehouseID.String())
+			if err != nil {
+				fmt.Println(err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Cannot fetch bin inventory from database",
+				})
+			}
+		}
+
+		lots, err := fetchLots(supabaseClient, line.SkuID.String(), line.WarehouseID.String())
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch lots from database",
+			})
+		}
+		pickLine := models.PickListLine{
+			SalesOrderLineID: line.ID,
+			SkuID:            line.SkuID,
+			Quantity:         quantity,
+		}
+		pickLine.Lots, _ = allocateFEFO(lots, quantity, now)
+		for _, stock := range bins[line.WarehouseID] {
+			if stock.SkuID == line.SkuID && stock.Quantity > 0 {
+				pickLine.Bins = append(pickLine.Bins, stock)
+			}
+		}
+		list.Lines = append(list.Lines, pickLine)
+	}
+
+	if len(pickLists) == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Sales order has no allocated stock left to pick",
+		})
+	}
+
+	if order.Status == models.SalesOrderStatusAllocated {
+		err = saveSalesOrder(supabaseClient, order, &models.SalesOrderEvent{
+			UserID:   userID,
+			Action:   "picking",
+			ToStatus: models.SalesOrderStatusPicking,
+			Details:  fmt.Sprintf("%d pick lists", len(pickLists)),
+		})
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot save sales order to database",
+			})
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(pickLists)
+}
+
+// Records picked stock being packed into a shipment from one warehouse. Without lines, everything
+// allocated from the warehouse that isn't packed yet goes into the shipment.
+func CreateShipment(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	orderID := c.Params("id")
+	shipment := new(models.Shipment)
+
+	if err := c.BodyParser(shipment); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	// Basic validation
+	if shipment.WarehouseID == uuid.Nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Warehouse is required",
+		})
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	order, err := fetchSalesOrder(supabaseClient, orderID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch sales order from database",
+		})
+	}
+	if order == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Sales order not found",
+		})
+	}
+	if order.Status != models.SalesOrderStatusPicking && order.Status != models.SalesOrderStatusPacked {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Only sales orders being picked can be packed",
+		})
+	}
+
+	lineIndex := map[uuid.UUID]int{}
+	for i, line := range order.Lines {
+		if line.WarehouseID == shipment.WarehouseID {
+			lineIndex[line.SkuID] = i
+		}
+	}
+
+	//Pack everything that's ready if no lines are given
+	if len(shipment.Lines) == 0 {
+		for _, i := range lineIndex {
+			line := order.Lines[i]
+			if packable := line.QuantityAllocated - (line.QuantityPacked - line.QuantityShipped); packable > 0 {
+				shipment.Lines = append(shipment.Lines, models.ShipmentLine{
+					SkuID:    line.SkuID,
+					Quantity: packable,
+				})
+			}
+		}
+		if len(shipment.Lines) == 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Nothing from this warehouse is ready to pack",
+			})
+		}
+	}
+
+	shipment.ID = uuid.New()
+	shipment.SalesOrderID = order.ID
+	shipment.UserID = userID
+	shipment.Status = models.ShipmentStatusPacked
+	shipment.DispatchedAt = nil
+
+	//Validate the whole shipment first - only allocated stock can be packed
+	lines := []models.ShipmentLine{}
+	packed := map[uuid.UUID]int{}
+	for _, line := range shipment.Lines {
+		i, ok := lineIndex[line.SkuID]
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  "SKU is not on this order for this warehouse",
+				"sku_id": line.SkuID,
+			})
+		}
+		if line.Quantity <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Packed quantity must be greater than 0",
+			})
+		}
+		quantity, err := toBaseQuantity(supabaseClient, line.SkuID, line.Unit, line.Quantity)
+		if err != nil {
+			return unitErrorResponse(c, err)
+		}
+		orderLine := order.Lines[i]
+		if packed[line.SkuID]+quantity > orderLine.QuantityAllocated-(orderLine.QuantityPacked-orderLine.QuantityShipped) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  "Packed quantity exceeds stock allocated and not yet packed",
+				"sku_id": line.SkuID,
+			})
+		}
+		if _, ok := packed[line.SkuID]; !ok {
+			lines = append(lines, models.ShipmentLine{
+				ID:               uuid.New(),
+				ShipmentID:       shipment.ID,
+				SalesOrderLineID: orderLine.ID,
+				SkuID:            line.SkuID,
+				UserID:           userID,
+			})
+		}
+		packed[line.SkuID] += quantity
+	}
+	for i := range lines {
+		lines[i].Quantity = packed[lines[i].SkuID]
+	}
+	shipment.Lines = lines
+
+	// Set timestamps
+	now := time.Now()
+	shipment.CreatedAt = now
+	shipment.UpdatedAt = now
+
+	//Save to database
+	_, _, err = supabaseClient.From("shipments").Insert(convertShipmentForDB(shipment), false, "", "", "").Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save shipment to database",
+		})
+	}
+
+	_, _, err = supabaseClient.From("shipment_lines").Insert(shipment.Lines, false, "", "", "").Execute()
+	if err != nil {
+		fmt.Println(err)
+		//Don't leave a shipment without lines behind
+		supabaseClient.From("shipments").Delete("", "").Eq("id", shipment.ID.String()).Execute()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save shipment lines to database",
+		})
+	}
+
+	allPacked := true
+	for i, line := range order.Lines {
+		if quantity := packed[line.SkuID]; quantity > 0 && line.WarehouseID == shipment.WarehouseID {
+			order.Lines[i].QuantityPacked += quantity
+			_, _, err = supabaseClient.From("sales_order_lines").Update(order.Lines[i], "", "").Eq("id", line.ID.String()).Execute()
+			if err != nil {
+				fmt.Println(err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Cannot save sales order line to database",
+				})
+			}
+		}
+		if order.Lines[i].QuantityPacked < order.Lines[i].Quantity {
+			allPacked = false
+		}
+	}
+
+	event := &models.SalesOrderEvent{
+		ShipmentID: &shipment.ID,
+		UserID:     userID,
+		Action:     "packed",
+		Details:    fmt.Sprintf("%d lines packed from warehouse %s", len(shipment.Lines), shipment.WarehouseID),
+	}
+	if allPacked {
+		event.ToStatus = models.SalesOrderStatusPacked
+	}
+	err = saveSalesOrder(supabaseClient, order, event)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save sales order to database",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(shipment)
+}
+
+func GetSalesOrderShipments(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	orderID := c.Params("id")
+
+	shipments, _, err := supabaseClient.From("shipments").Select("*", "", false).Eq("sales_order_id", orderID).Order("created_at", nil).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch shipments from database",
+		})
+	}
+	respStruct := []models.ShipmentDatabase{}
+	err = json.Unmarshal(shipments, &respStruct)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal shipments from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(respStruct)
+}
+
+func GetShipment(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	shipmentID := c.Params("id")
+
+	shipment, err := fetchShipment(supabaseClient, shipmentID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch shipment from database",
+		})
+	}
+	if shipment == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Shipment not found",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(shipment)
+}
+
+// Dispatches a packed shipment - its allocations are consumed and the stock leaves the warehouse,
+// picked from lots first-expired-first-out. The order is shipped once every line has gone.
+func DispatchShipment(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	shipmentID := c.Params("id")
+	request := new(struct {
+		Carrier        string `json:"carrier"`
+		TrackingNumber string `json:"tracking_number"`
+	})
+	if err := c.BodyParser(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	shipment, err := fetchShipment(supabaseClient, shipmentID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch shipment from database",
+		})
+	}
+	if shipment == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Shipment not found",
+		})
+	}
+	if shipment.Status != models.ShipmentStatusPacked {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Only packed shipments can be dispatched",
+		})
+	}
+
+	order, err := fetchSalesOrder(supabaseClient, shipment.SalesOrderID.String())
+	if err != nil || order == nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch sales order from database",
+		})
+	}
+	reference := salesOrderReference(order.ID)
+	reservations, err := fetchOrderReservations(supabaseClient, reference)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch reservations from database",
+		})
+	}
+
+	//Check every line can ship before any stock moves - lapsed allocations must still be covered by available stock
+	for _, line := range shipment.Lines {
+		available, err := fetchAvailableQuantity(supabaseClient, line.SkuID, shipment.WarehouseID)
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch inventory from database",
+			})
+		}
+		if available+sumReservations(reservations)[stockKey{line.SkuID, shipment.WarehouseID}] < line.Quantity {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":  "Insufficient stock to dispatch shipment",
+				"sku_id": line.SkuID,
+			})
+		}
+	}
+
+	//Claim the shipment before any stock moves, so a retry or a second request can't ship it twice
+	now := time.Now()
+	if request.Carrier != "" {
+		shipment.Carrier = request.Carrier
+	}
+	if request.TrackingNumber != "" {
+		shipment.TrackingNumber = request.TrackingNumber
+	}
+	shipment.Status = models.ShipmentStatusDispatched
+	shipment.DispatchedAt = &now
+	shipment.UpdatedAt = now
+	claimed, _, err := supabaseClient.From("shipments").Update(convertShipmentForDB(shipment), "", "").Eq("id", shipmentID).Eq("status", models.ShipmentStatusPacked).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save shipment to database",
+		})
+	}
+	respClaimed := []struct {
+		ID uuid.UUID `json:"id"`
+	}{}
+	err = json.Unmarshal(claimed, &respClaimed)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot parse shipment from database",
+		})
+	}
+	if len(respClaimed) == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Only packed shipments can be dispatched",
+		})
+	}
+
+	//Every line ships or none do - each step pushes how to undo it, and a failure undoes them all
+	undo := []func(){
+		func() {
+			_, _, err := supabaseClient.From("shipments").Update(map[string]interface{}{
+				"status":        models.ShipmentStatusPacked,
+				"dispatched_at": nil,
+			}, "", "").Eq("id", shipmentID).Execute()
+			if err != nil {
+				fmt.Println(err)
+			}
+		},
+	}
+	rollback := func() {
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+	}
+	for _, line := range shipment.Lines {
+		held := []models.Reservation{}
+		for _, r := range reservations {
+			if r.SkuID == line.SkuID && r.LocationID == shipment.WarehouseID {
+				held = append(held, r)
+			}
+		}
+		//Consume the allocation first so the shipment can draw on the stock it was holding. Undoing
+		//puts the allocation back before the stock, so nothing else can claim the stock in between
+		original := slices.Clone(held)
+		var movements []*models.StockMovement
+		undo = append(undo, func() {
+			restoreReservations(supabaseClient, original)
+			if err := reverseStockMovements(supabaseClient, movements); err != nil {
+				fmt.Println(err)
+			}
+		})
+		err = consumeReservations(supabaseClient, held, line.Quantity)
+		if err == nil {
+			_, movements, err = recordFEFOShipment(supabaseClient, models.StockMovement{
+				SkuID:      line.SkuID,
+				LocationID: shipment.WarehouseID,
+				UserID:     userID,
+				Reason:     models.MovementReasonShipment,
+				Reference:  reference,
+			}, line.Quantity)
+		}
+		if err != nil {
+			fmt.Println(err)
+			rollback()
+			if errors.Is(err, ErrInsufficientStock) {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error":  "Insufficient stock to dispatch shipment",
+					"sku_id": line.SkuID,
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  "Cannot update inventory in database",
+				"sku_id": line.SkuID,
+			})
+		}
+
+		for i, orderLine := range order.Lines {
+			if orderLine.ID == line.SalesOrderLineID {
+				order.Lines[i].QuantityShipped += line.Quantity
+				order.Lines[i].QuantityAllocated = max(orderLine.QuantityAllocated-line.Quantity, 0)
+				_, _, err = supabaseClient.From("sales_order_lines").Update(order.Lines[i], "", "").Eq("id", orderLine.ID.String()).Execute()
+				if err != nil {
+					fmt.Println(err)
+					rollback()
+					return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+						"error": "Cannot save sales order line to database",
+					})
+				}
+				undo = append(undo, func() {
+					if _, _, err := supabaseClient.From("sales_order_lines").Update(orderLine, "", "").Eq("id", orderLine.ID.String()).Execute(); err != nil {
+						fmt.Println(err)
+					}
+				})
+			}
+		}
+	}
+
+	allShipped := true
+	for _, line := range order.Lines {
+		if line.QuantityShipped < line.Quantity {
+			allShipped = false
+		}
+	}
+	event := &models.SalesOrderEvent{
+		ShipmentID: &shipment.ID,
+		UserID:     userID,
+		Action:     "dispatched",
+		Details:    fmt.Sprintf("%d lines dispatched from warehouse %s", len(shipment.Lines), shipment.WarehouseID),
+	}
+	if allShipped {
+		event.ToStatus = models.SalesOrderStatusShipped
+		order.ShippedAt = &now
+	}
+	err = saveSalesOrder(supabaseClient, order, event)
+	if err != nil {
+		fmt.Println(err)
+		rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save sales order to database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"shipment":    shipment,
+		"sales_order": order,
+	})
+}
+
+// Cancels a sales order that nothing has shipped from yet, releasing its allocated stock
+func CancelSalesOrder(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	orderID := c.Params("id")
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	order, err := fetchSalesOrder(supabaseClient, orderID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch sales order from database",
+		})
+	}
+	if order == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Sales order not found",
+		})
+	}
+	shipped := false
+	for _, line := range order.Lines {
+		if line.QuantityShipped > 0 {
+			shipped = true
+		}
+	}
+	if !isOpenSalesOrder(order) || shipped {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Only open sales orders with nothing shipped can be cancelled",
+		})
+	}
+
+	now := time.Now()
+	_, _, err = supabaseClient.From("reservations").Update(map[string]interface{}{
+		"status":     models.ReservationStatusReleased,
+		"updated_at": now,
+	}, "", "").Eq("reference", salesOrderReference(order.ID)).Eq("status", models.ReservationStatusActive).Execute()
+	if err == nil {
+		_, _, err = supabaseClient.From("shipments").Update(map[string]interface{}{
+			"status":     models.ShipmentStatusCancelled,
+			"updated_at": now,
+		}, "", "").Eq("sales_order_id", orderID).Eq("status", models.ShipmentStatusPacked).Execute()
+	}
+	if err == nil {
+		err = saveSalesOrder(supabaseClient, order, &models.SalesOrderEvent{
+			UserID:   userID,
+			Action:   "cancelled",
+			ToStatus: models.SalesOrderStatusCancelled,
+		})
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot cancel sales order in database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Sales order cancelled successfully",
+	})
+}
@@ -0,0 +1,517 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/database"
+	"ucrs.com/inventory-manager/backend/internal/models"
+)
+
+// Fetches a serial number within a company - returns nil if it does not exist
+func fetchSerial(supabaseClient *supabase.Client, companyID uuid.UUID, serialNumber string) (*models.SerialNumber, error) {
+	serial, _, err := supabaseClient.From("serial_numbers").Select("*", "", false).Eq("company_id", companyID.String()).Eq("serial_number", serialNumber).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.SerialNumber{}
+	err = json.Unmarshal(serial, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	if len(respStruct) == 0 {
+		return nil, nil
+	}
+	return &respStruct[0], nil
+}
+
+func saveSerial(supabaseClient *supabase.Client, serial *models.SerialNumber) error {
+	serial.UpdatedAt = time.Now()
+	_, _, err := supabaseClient.From("serial_numbers").Update(serial, "", "").Eq("id", serial.ID.String()).Execute()
+	return err
+}
+
+// Every change to a serial records a movement of exactly one unit, so the ledger quantity
+// of a serialized sku at a location is the count of serials in stock there
+func serialMovement(serial *models.SerialNumber, locationID uuid.UUID, userID uuid.UUID, quantity int, reason, reference string) *models.StockMovement {
+	return &models.StockMovement{
+		SkuID:        serial.SkuID,
+		LocationID:   locationID,
+		UserID:       userID,
+		Quantity:     quantity,
+		Reason:       reason,
+		Reference:    reference,
+		SerialNumber: serial.SerialNumber,
+	}
+}
+
+// Registers serial numbers for a serialized sku, receiving them into a warehouse.
+// Serials already known to the company are rejected, unless they were shipped for this sku
+// and are coming back into stock.
+func RegisterSerials(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	skuID := c.Params("id")
+	request := new(struct {
+		LocationID    uuid.UUID `json:"location_id"`
+		SerialNumbers []string  `json:"serial_numbers"`
+		Reference     string    `json:"reference"`
+	})
+	if err := c.BodyParser(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	if request.LocationID == uuid.Nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Location ID is required",
+		})
+	}
+
+	if len(request.SerialNumbers) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "At least one serial number is required",
+		})
+	}
+
+	seen := map[string]bool{}
+	for _, serialNumber := range request.SerialNumbers {
+		if serialNumber == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Serial numbers cannot be empty",
+			})
+		}
+		if seen[serialNumber] {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":         "Duplicate serial number in request",
+				"serial_number": serialNumber,
+			})
+		}
+		seen[serialNumber] = true
+	}
+
+	sku, err := fetchSKU(supabaseClient, skuID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch SKU from database",
+		})
+	}
+	if sku == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "SKU not found",
+		})
+	}
+	if !sku.Serialized {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "SKU is not serialized",
+		})
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+	companyID, err := database.FetchCompanyID(supabaseClient)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "User must belong to a company to register serial numbers",
+		})
+	}
+
+	existing, _, err := supabaseClient.From("serial_numbers").Select("*", "", false).Eq("company_id", companyID.String()).In("serial_number", request.SerialNumbers).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch serial numbers from database",
+		})
+	}
+	existingSerials := []models.SerialNumber{}
+	err = json.Unmarshal(existing, &existingSerials)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal serial numbers from database",
+		})
+	}
+
+	returning := map[string]models.SerialNumber{}
+	duplicates := []string{}
+	for _, serial := range existingSerials {
+		if serial.SkuID == sku.ID && serial.Status == models.SerialStatusShipped {
+			returning[serial.SerialNumber] = serial
+			continue
+		}
+		duplicates = append(duplicates, serial.SerialNumber)
+	}
+	if len(duplicates) > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":          "Serial numbers already exist in this company",
+			"serial_numbers": duplicates,
+		})
+	}
+
+	//Every serial is registered or none are - a failure deletes the serials added, puts returning
+	//ones back to shipped and reverses their movements
+	now := time.Now()
+	registered := []models.SerialNumber{}
+	movements := []*models.StockMovement{}
+	undo := func() {
+		for _, serial := range registered {
+			var err error
+			if original, isReturn := returning[serial.SerialNumber]; isReturn {
+				err = saveSerial(supabaseClient, &original)
+			} else {
+				_, _, err = supabaseClient.From("serial_numbers").Delete("", "").Eq("id", serial.ID.String()).Execute()
+			}
+			if err != nil {
+				fmt.Println(err)
+			}
+		}
+		if err := reverseStockMovements(supabaseClient, movements); err != nil {
+			fmt.Println(err)
+		}
+	}
+	for _, serialNumber := range request.SerialNumbers {
+		locationID := request.LocationID
+		serial, isReturn := returning[serialNumber]
+		if isReturn {
+			serial.LocationID = &locationID
+			serial.Status = models.SerialStatusInStock
+			serial.UserID = userID
+			err = saveSerial(supabaseClient, &serial)
+		} else {
+			serial = models.SerialNumber{
+				ID:           uuid.New(),
+				SkuID:        sku.ID,
+				CompanyID:    companyID,
+				UserID:       userID,
+				SerialNumber: serialNumber,
+				LocationID:   &locationID,
+				Status:       models.SerialStatusInStock,
+				CreatedAt:    now,
+				UpdatedAt:    now,
+			}
+			_, _, err = supabaseClient.From("serial_numbers").Insert(serial, false, "", "", "").Execute()
+		}
+		if err != nil {
+			fmt.Println(err)
+			undo()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":         "Cannot save serial number to database",
+				"serial_number": serialNumber,
+			})
+		}
+		registered = append(registered, serial)
+
+		reason := models.MovementReasonReceipt
+		if isReturn {
+			reason = models.MovementReasonReturn
+		}
+		movement := serialMovement(&serial, request.LocationID, userID, 1, reason, request.Reference)
+		_, err = applyStockMovement(supabaseClient, movement)
+		if err != nil {
+			fmt.Println(err)
+			undo()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":         "Cannot update inventory in database",
+				"serial_number": serialNumber,
+			})
+		}
+		movements = append(movements, movement)
+	}
+	offerToBackorders(supabaseClient, movements)
+
+	return c.Status(fiber.StatusCreated).JSON(registered)
+}
+
+// Lists the serial numbers of a sku, optionally filtered by ?location_id= and ?status=
+func GetSKUSerials(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	skuID := c.Params("id")
+
+	query := supabaseClient.From("serial_numbers").Select("*", "", false).Eq("sku_id", skuID)
+	if locationID := c.Query("location_id"); locationID != "" {
+		query = query.Eq("location_id", locationID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Eq("status", status)
+	}
+	serials, _, err := query.Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch serial numbers from database",
+		})
+	}
+	respStruct := []models.SerialNumber{}
+	err = json.Unmarshal(serials, &respStruct)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal serial numbers from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(respStruct)
+}
+
+// Looks up a serial number in the user's company, including which warehouse currently holds it
+func GetSerial(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	serialNumber := c.Params("serial")
+
+	companyID, err := database.FetchCompanyID(supabaseClient)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "User must belong to a company to look up serial numbers",
+		})
+	}
+
+	serial, err := fetchSerial(supabaseClient, companyID, serialNumber)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch serial number from database",
+		})
+	}
+	if serial == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Serial number not found",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(serial)
+}
+
+// Moves an in-stock serial to another warehouse
+func MoveSerial(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	serialNumber := c.Params("serial")
+	request := new(struct {
+		LocationID uuid.UUID `json:"location_id"`
+		Reference  string    `json:"reference"`
+	})
+	if err := c.BodyParser(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	if request.LocationID == uuid.Nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Location ID is required",
+		})
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+	companyID, err := database.FetchCompanyID(supabaseClient)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "User must belong to a company to move serial numbers",
+		})
+	}
+
+	serial, err := fetchSerial(supabaseClient, companyID, serialNumber)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch serial number from database",
+		})
+	}
+	if serial == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Serial number not found",
+		})
+	}
+	if serial.Status != models.SerialStatusInStock || serial.LocationID == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Serial number is not in stock",
+		})
+	}
+	if *serial.LocationID == request.LocationID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Serial number is already at this location",
+		})
+	}
+
+	//Both sides of the move and the serial's new location are saved together
+	out := serialMovement(serial, *serial.LocationID, userID, -1, models.MovementReasonTransferOut, request.Reference)
+	_, err = applyStockMovement(supabaseClient, out)
+	if errors.Is(err, ErrInsufficientStock) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Serial number's stock is reserved at its current location",
+		})
+	}
+	//The unit arrives at the cost it left at
+	in := serialMovement(serial, request.LocationID, userID, 1, models.MovementReasonTransferIn, request.Reference)
+	if err == nil {
+		in.UnitCost = out.UnitCost
+		_, err = applyStockMovement(supabaseClient, in)
+		if err != nil {
+			err = errors.Join(err, reverseStockMovements(supabaseClient, []*models.StockMovement{out}))
+		}
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot update inventory in database",
+		})
+	}
+	movements := []*models.StockMovement{out, in}
+
+	locationID := serial.LocationID
+	serial.LocationID = &request.LocationID
+	serial.UserID = userID
+	err = saveSerial(supabaseClient, serial)
+	if err != nil {
+		fmt.Println(err)
+		serial.LocationID = locationID
+		if err := reverseStockMovements(supabaseClient, movements); err != nil {
+			fmt.Println(err)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save serial number to database",
+		})
+	}
+	offerToBackorders(supabaseClient, movements)
+
+	return c.Status(fiber.StatusOK).JSON(serial)
+}
+
+// Ships an in-stock serial out of its warehouse
+func ShipSerial(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	serialNumber := c.Params("serial")
+	request := new(struct {
+		Reference string `json:"reference"`
+	})
+	if err := c.BodyParser(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+	companyID, err := database.FetchCompanyID(supabaseClient)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "User must belong to a company to ship serial numbers",
+		})
+	}
+
+	serial, err := fetchSerial(supabaseClient, companyID, serialNumber)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch serial number from database",
+		})
+	}
+	if serial == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Serial number not found",
+		})
+	}
+	if serial.Status != models.SerialStatusInStock || serial.LocationID == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Serial number is not in stock",
+		})
+	}
+
+	movement := serialMovement(serial, *serial.LocationID, userID, -1, models.MovementReasonShipment, request.Reference)
+	_, err = recordStockMovement(supabaseClient, movement)
+	if errors.Is(err, ErrInsufficientStock) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Serial number's stock is reserved at its current location",
+		})
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot update inventory in database",
+		})
+	}
+
+	serial.LocationID = nil
+	serial.Status = models.SerialStatusShipped
+	serial.UserID = userID
+	err = saveSerial(supabaseClient, serial)
+	if err != nil {
+		fmt.Println(err)
+		//Still in stock, so put the unit back
+		if err := reverseStockMovements(supabaseClient, []*models.StockMovement{movement}); err != nil {
+			fmt.Println(err)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save serial number to database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(serial)
+}
+
+// Lists every movement of a serial number, newest first
+func GetSerialMovements(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	serialNumber := c.Params("serial")
+
+	companyID, err := database.FetchCompanyID(supabaseClient)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "User must belong to a company to look up serial numbers",
+		})
+	}
+
+	serial, err := fetchSerial(supabaseClient, companyID, serialNumber)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch serial number from database",
+		})
+	}
+	if serial == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Serial number not found",
+		})
+	}
+
+	movements, _, err := supabaseClient.From("stock_movements").Select("*", "", false).Eq("sku_id", serial.SkuID.String()).Eq("serial_number", serial.SerialNumber).Order("created_at", nil).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch stock movements from database",
+		})
+	}
+	respStruct := []models.StockMovement{}
+	err = json.Unmarshal(movements, &respStruct)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal stock movements from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"serial":    serial,
+		"movements": respStruct,
+	})
+}
@@ -92,30 +92,51 @@ func GetSKUsByProductID(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusOK).JSON(respStruct)
 }
 
+// Creates a sku. Without a SKU code one is generated from the company's SKU template, filled in from
+// the product, its category and the attribute values given - which are saved with the sku. Codes are
+// unique within the company.
 func CreateSKU(c *fiber.Ctx) error {
 	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
-	sku := new(models.SKU)
+	request := new(struct {
+		models.SKU
+		Attributes []models.SKUAttributes `json:"attributes"`
+	})
 
-	if err := c.BodyParser(sku); err != nil {
+	if err := c.BodyParser(request); err != nil {
 		fmt.Println(err)
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Cannot parse JSON",
 		})
 	}
+	sku := &request.SKU
 
 	// Basic validation
-	if sku.SKU == "" {
+	if sku.Price <= 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "SKU name is required",
+			"error": "Price must be greater than 0",
 		})
 	}
 
-	if sku.Price <= 0 {
+	if sku.StandardCost < 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Price must be greater than 0",
+			"error": "Standard cost cannot be negative",
 		})
 	}
 
+	attributeIDs := []string{}
+	for _, attribute := range request.Attributes {
+		if attribute.AttributeID == uuid.Nil || attribute.AttributeValue == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Attribute ID and value are required",
+			})
+		}
+		attributeIDs = append(attributeIDs, attribute.AttributeID.String())
+	}
+
+	if sku.BaseUnit == "" {
+		sku.BaseUnit = models.DefaultBaseUnit
+	}
+
 	// Set timestamps
 	now := time.Now()
 	sku.CreatedAt = now
@@ -130,14 +151,112 @@ func CreateSKU(c *fiber.Ctx) error {
 	sku.UserID = userID
 	sku.ID = uuid.New()
 
+	//Values must conform to their attribute's type
+	attributes, err := fetchAttributesByID(supabaseClient, attributeIDs)
+	if err != nil {
+		return validationErrorResponse(c, err, "Cannot fetch attributes from database")
+	}
+	attributeValues := map[string]string{}
+	for i := range request.Attributes {
+		attribute := attributes[request.Attributes[i].AttributeID]
+		value, err := attribute.ConformValue(request.Attributes[i].AttributeValue)
+		if err != nil {
+			return attributeValueErrorResponse(c, fmt.Sprintf("attributes[%d].attr_value", i), err)
+		}
+		request.Attributes[i].AttributeValue = value
+		attributeValues[attribute.Name] = value
+	}
+
+	generator, err := newSKUCodeGenerator(supabaseClient)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch SKU codes from database",
+		})
+	}
+	if sku.SKU == "" {
+		var product *models.Product
+		if sku.ProductID != uuid.Nil {
+			product, err = fetchProduct(supabaseClient, sku.ProductID.String())
+			if err != nil {
+				fmt.Println(err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Cannot fetch product from database",
+				})
+			}
+		}
+		values, err := skuTemplateValues(supabaseClient, product, attributeValues)
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch category from database",
+			})
+		}
+		sku.SKU, err = generator.generate("", values)
+		if err != nil {
+			return validationErrorResponse(c, err, "Cannot generate SKU code")
+		}
+	} else {
+		taken, err := generator.taken(sku.SKU)
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch SKU codes from database",
+			})
+		}
+		if taken {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "SKU code already exists in this company",
+			})
+		}
+	}
+
+	sku.CompanyID = generator.companyID
 	result, count, err := supabaseClient.From("skus").Insert(sku, false, "", "", "").Execute() //I believe the other params are correct
 	fmt.Println(string(result), count, err)
+	if isDuplicateSKUCode(err) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "SKU code was taken by another request - please try again",
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Cannot save SKU to database",
 		})
 	}
 
+	//A concurrent request may have saved the same code in the meantime - if so this sku gives way
+	duplicates, err := generator.duplicates(supabaseClient, []string{sku.SKU})
+	if err != nil {
+		fmt.Println(err)
+		supabaseClient.From("skus").Delete("", "").Eq("id", sku.ID.String()).Execute()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch SKU codes from database",
+		})
+	}
+	if len(duplicates) > 0 {
+		supabaseClient.From("skus").Delete("", "").Eq("id", sku.ID.String()).Execute()
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "SKU code was taken by another request - please try again",
+		})
+	}
+
+	if len(request.Attributes) > 0 {
+		for i := range request.Attributes {
+			request.Attributes[i].SkuID = sku.ID
+			request.Attributes[i].UserID = userID
+		}
+		_, _, err = supabaseClient.From("sku_attributes").Insert(request.Attributes, false, "", "", "").Execute()
+		if err != nil {
+			fmt.Println(err)
+			//Don't leave a sku without the attributes its code was made from behind
+			supabaseClient.From("skus").Delete("", "").Eq("id", sku.ID.String()).Execute()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot save SKU attributes to database",
+			})
+		}
+	}
+
 	return c.Status(fiber.StatusCreated).JSON(sku)
 }
 
@@ -166,6 +285,16 @@ func UpdateSKU(c *fiber.Ctx) error {
 			"error": "Cannot parse JSON",
 		})
 	}
+	//Fields that keep their stored value when left out of the body
+	given := new(struct {
+		StandardCost *float64 `json:"standard_cost"`
+		Serialized   *bool    `json:"serialized"`
+	})
+	if err := c.BodyParser(given); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
 
 	// Basic validation
 	if sku.SKU == "" {
@@ -180,6 +309,89 @@ func UpdateSKU(c *fiber.Ctx) error {
 		})
 	}
 
+	if sku.StandardCost < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Standard cost cannot be negative",
+		})
+	}
+
+	//Codes stay unique within the company
+	existing, err := fetchSKU(supabaseClient, skuID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch SKU from database",
+		})
+	}
+	if existing == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "SKU not found",
+		})
+	}
+	sku.CompanyID = existing.CompanyID
+	if given.StandardCost == nil {
+		sku.StandardCost = existing.StandardCost
+	}
+	if given.Serialized == nil {
+		sku.Serialized = existing.Serialized
+	}
+	//Stock held by serial number can't go back to being counted in bulk
+	if existing.Serialized && !sku.Serialized {
+		inStock, err := rowExists(supabaseClient, "serial_numbers", map[string]string{
+			"sku_id": skuID,
+			"status": models.SerialStatusInStock,
+		})
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch serial numbers from database",
+			})
+		}
+		if inStock {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Serial tracking cannot be turned off while serial numbers of the SKU are in stock",
+			})
+		}
+	}
+	//Ledger quantities are in the base unit, so it is fixed once stock has moved
+	if sku.BaseUnit != "" && sku.BaseUnit != baseUnit(existing) {
+		moved, err := rowExists(supabaseClient, "stock_movements", map[string]string{
+			"sku_id": skuID,
+		})
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch stock movements from database",
+			})
+		}
+		if moved {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Base unit cannot be changed once the SKU has stock movements",
+			})
+		}
+	}
+	if sku.SKU != existing.SKU {
+		generator, err := newSKUCodeGenerator(supabaseClient)
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch SKU codes from database",
+			})
+		}
+		taken, err := generator.taken(sku.SKU)
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch SKU codes from database",
+			})
+		}
+		if taken {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "SKU code already exists in this company",
+			})
+		}
+	}
+
 	// Set timestamps
 	now := time.Now()
 	sku.UpdatedAt = now
@@ -187,6 +399,11 @@ func UpdateSKU(c *fiber.Ctx) error {
 	//Save to database
 	_, _, err = supabaseClient.From("skus").Update(sku, "", "").Eq("id", skuID).Execute()
 	//fmt.Println(string(result), count, err)
+	if isDuplicateSKUCode(err) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "SKU code already exists in this company",
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Cannot save SKU to database",
@@ -213,3 +430,20 @@ func DeleteSKU(c *fiber.Ctx) error {
 		"message": "SKU deleted successfully",
 	})
 }
+
+// Fetches a SKU by ID - returns nil if it does not exist
+func fetchSKU(supabaseClient *supabase.Client, skuID string) (*models.SKU, error) {
+	sku, _, err := supabaseClient.From("skus").Select("*", "", false).Eq("id", skuID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.SKU{}
+	err = json.Unmarshal(sku, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	if len(respStruct) == 0 {
+		return nil, nil
+	}
+	return &respStruct[0], nil
+}
@@ -11,6 +11,15 @@ import (
 	"ucrs.com/inventory-manager/backend/internal/models"
 )
 
+// Rejects a value that doesn't conform to its attribute, naming the field it was given in
+func attributeValueErrorResponse(c *fiber.Ctx, field string, err error) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error":  err.Error(),
+		"errors": fiber.Map{field: err.Error()},
+	})
+}
+
+// Sets a sku's value for an attribute - it must conform to the attribute's type, and is saved normalized
 func UpdateSKUAttribute(c *fiber.Ctx) error {
 	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
 	skuID := c.Params("skuid")
@@ -34,6 +43,24 @@ func UpdateSKUAttribute(c *fiber.Ctx) error {
 		})
 	}
 
+	//Values must conform to the attribute's type and allowed values
+	attribute, err := fetchAttribute(supabaseClient, SKUAttr.AttributeID.String())
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch attribute from database",
+		})
+	}
+	if attribute == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Attribute not found",
+		})
+	}
+	SKUAttr.AttributeValue, err = attribute.ConformValue(SKUAttr.AttributeValue)
+	if err != nil {
+		return attributeValueErrorResponse(c, "attr_value", err)
+	}
+
 	SKUID, err := uuid.Parse(skuID)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/supabase-community/postgrest-go"
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/database"
+	"ucrs.com/inventory-manager/backend/internal/models"
+	"ucrs.com/inventory-manager/backend/pkg"
+)
+
+// Most codes previewed in one request
+const maxSKUCodePreviews = 20
+
+// Skus read at a time while looking for the highest sequence number already used
+const skuSequencePageSize = 50
+
+// Generates SKU codes from the company's template, unique among the company's skus. Codes it hands
+// out are remembered, so several can be generated for one request without clashing.
+type skuCodeGenerator struct {
+	client    *supabase.Client
+	template  string
+	companyID *uuid.UUID      //Company the skus it codes belong to - nil for users without one
+	userIDs   []string        //Users whose skus share the code space - the whole company
+	codes     map[string]bool //Codes handed out in this request
+	sequences map[string]int  //Last sequence number handed out per rendered template
+}
+
+// Loads the company's template and the users whose codes it must not clash with. Users without a
+// company only have their own skus to clash with, and no template.
+func newSKUCodeGenerator(supabaseClient *supabase.Client) (*skuCodeGenerator, error) {
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return nil, err
+	}
+	generator := &skuCodeGenerator{
+		client:    supabaseClient,
+		userIDs:   []string{userID.String()},
+		codes:     map[string]bool{},
+		sequences: map[string]int{},
+	}
+
+	if companyID, err := database.FetchCompanyID(supabaseClient); err == nil {
+		generator.companyID = &companyID
+		company, _, err := supabaseClient.From("companies").Select("sku_template", "", false).Eq("id", companyID.String()).Execute()
+		if err != nil {
+			return nil, err
+		}
+		respCompany := []models.Company{}
+		err = json.Unmarshal(company, &respCompany)
+		if err != nil {
+			return nil, err
+		}
+		if len(respCompany) > 0 {
+			generator.template = respCompany[0].SKUTemplate
+		}
+
+		users, _, err := supabaseClient.From("users").Select("id", "", false).Eq("company_id", companyID.String()).Execute()
+		if err != nil {
+			return nil, err
+		}
+		respUsers := []models.User{}
+		err = json.Unmarshal(users, &respUsers)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range respUsers {
+			if user.ID != userID {
+				generator.userIDs = append(generator.userIDs, user.ID.String())
+			}
+		}
+	}
+	return generator, nil
+}
+
+// Reports whether a code is already used by one of the company's skus, or was handed out in this request
+func (g *skuCodeGenerator) taken(code string) (bool, error) {
+	if g.codes[code] {
+		return true, nil
+	}
+	skus, _, err := g.client.From("skus").Select("sku", "", false).In("user_id", g.userIDs).Eq("sku", code).Limit(1, "").Execute()
+	if err != nil {
+		return false, err
+	}
+	respSKUs := []models.SKU{}
+	err = json.Unmarshal(skus, &respSKUs)
+	if err != nil {
+		return false, err
+	}
+	return len(respSKUs) > 0, nil
+}
+
+// Escapes the wildcards of a like pattern, so text is matched as it is
+func escapeLike(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(text)
+}
+
+// Finds the highest sequence number the company's skus already have for a rendered template. Codes
+// of the template's width are asked for highest first - zero padding makes their text order their
+// number order - and the first that really has a number in its place is the highest.
+func (g *skuCodeGenerator) lastSequence(rendered pkg.SKUCode) (int, error) {
+	pattern := escapeLike(rendered.Prefix) + strings.Repeat("_", rendered.SequenceWidth) + escapeLike(rendered.Suffix)
+	query := g.client.From("skus").Select("sku", "", false).In("user_id", g.userIDs).Like("sku", pattern).Order("sku", &postgrest.OrderOpts{Ascending: false})
+	for from := 0; ; from += skuSequencePageSize {
+		skus, _, err := query.Range(from, from+skuSequencePageSize-1, "").Execute()
+		if err != nil {
+			return 0, err
+		}
+		respSKUs := []models.SKU{}
+		err = json.Unmarshal(skus, &respSKUs)
+		if err != nil {
+			return 0, err
+		}
+		if len(respSKUs) == 0 {
+			return 0, nil
+		}
+		for _, sku := range respSKUs {
+			if sequence, ok := rendered.Sequence(sku.SKU); ok {
+				return sequence, nil
+			}
+		}
+	}
+}
+
+// Generates the next free code from a template - the company's when template is empty. Templates
+// with a {SEQ} are numbered on from the highest code already made with the same values; codes from
+// templates without one must not exist yet.
+func (g *skuCodeGenerator) generate(template string, values pkg.SKUTemplateValues) (string, error) {
+	if template == "" {
+		template = g.template
+	}
+	if template == "" {
+		return "", fiber.NewError(fiber.StatusBadRequest, "SKU code is required - or set a SKU template for the company")
+	}
+	rendered, err := pkg.RenderSKUTemplate(template, values)
+	if err != nil {
+		return "", fiber.NewError(fiber.StatusBadRequest, "Cannot generate SKU code: "+err.Error())
+	}
+
+	if rendered.SequenceWidth == 0 {
+		code := rendered.Code(0)
+		taken, err := g.taken(code)
+		if err != nil {
+			return "", err
+		}
+		if taken {
+			return "", fiber.NewError(fiber.StatusConflict, "Generated SKU code "+code+" already exists - add {SEQ} to the template to number codes")
+		}
+		g.codes[code] = true
+		return code, nil
+	}
+
+	key := rendered.Prefix + "\x00" + rendered.Suffix
+	last, ok := g.sequences[key]
+	if !ok {
+		last, err = g.lastSequence(rendered)
+		if err != nil {
+			return "", err
+		}
+	}
+	//Codes past the template's width aren't found above, so step over any already used
+	next := last + 1
+	for {
+		taken, err := g.taken(rendered.Code(next))
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			break
+		}
+		next++
+	}
+	g.sequences[key] = next
+	code := rendered.Code(next)
+	g.codes[code] = true
+	return code, nil
+}
+
+// Reports whether saving failed on the database's unique index of sku codes within a company
+func isDuplicateSKUCode(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "(23505)")
+}
+
+// Finds which of the codes more than one of the company's skus now have - used after saving, to catch
+// a concurrent request that took the same code
+func (g *skuCodeGenerator) duplicates(supabaseClient *supabase.Client, codes []string) ([]string, error) {
+	skus, _, err := supabaseClient.From("skus").Select("sku", "", false).In("user_id", g.userIDs).In("sku", codes).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respSKUs := []models.SKU{}
+	err = json.Unmarshal(skus, &respSKUs)
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	duplicates := []string{}
+	for _, sku := range respSKUs {
+		counts[sku.SKU]++
+		if counts[sku.SKU] == 2 {
+			duplicates = append(duplicates, sku.SKU)
+		}
+	}
+	return duplicates, nil
+}
+
+// What a product's sku codes are generated from - its name, its category's name and the sku's
+// attribute values by attribute name
+func skuTemplateValues(supabaseClient *supabase.Client, product *models.Product, attributes map[string]string) (pkg.SKUTemplateValues, error) {
+	values := pkg.SKUTemplateValues{Attributes: attributes}
+	if product == nil {
+		return values, nil
+	}
+	values.Product = product.Name
+	if product.CategoryID != nil {
+		category, err := fetchCategory(supabaseClient, product.CategoryID.String())
+		if err != nil {
+			return values, err
+		}
+		if category != nil {
+			values.Category = category.Name
+		}
+	}
+	return values, nil
+}
+
+// Previews the codes a template would generate, without saving anything - the template given, or the
+// company's. Values come from product_id, or from product_name and category_name to try a template
+// out, with attribute values by name. count (default 1) codes are generated in a row.
+func PreviewSKUCodes(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	request := new(struct {
+		Template     string            `json:"template"`
+		ProductID    *uuid.UUID        `json:"product_id"`
+		ProductName  string            `json:"product_name"`
+		CategoryName string            `json:"category_name"`
+		Attributes   map[string]string `json:"attributes"`
+		Count        int               `json:"count"`
+	})
+	if err := c.BodyParser(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	// Basic validation
+	if request.Count == 0 {
+		request.Count = 1
+	}
+	if request.Count < 0 || request.Count > maxSKUCodePreviews {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Count must be between 1 and %d", maxSKUCodePreviews),
+		})
+	}
+	if request.Template != "" {
+		if err := pkg.ValidateSKUTemplate(request.Template); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid SKU template: " + err.Error(),
+			})
+		}
+	}
+
+	generator, err := newSKUCodeGenerator(supabaseClient)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch SKU codes from database",
+		})
+	}
+
+	values := pkg.SKUTemplateValues{
+		Category:   request.CategoryName,
+		Product:    request.ProductName,
+		Attributes: request.Attributes,
+	}
+	if request.ProductID != nil {
+		product, err := fetchProduct(supabaseClient, request.ProductID.String())
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch product from database",
+			})
+		}
+		if product == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Product not found",
+			})
+		}
+		values, err = skuTemplateValues(supabaseClient, product, request.Attributes)
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch category from database",
+			})
+		}
+	}
+
+	codes := []string{}
+	for range request.Count {
+		code, err := generator.generate(request.Template, values)
+		if err != nil {
+			return validationErrorResponse(c, err, "Cannot generate SKU code")
+		}
+		codes = append(codes, code)
+	}
+
+	template := request.Template
+	if template == "" {
+		template = generator.template
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"template": template,
+		"codes":    codes,
+	})
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supabase-community/postgrest-go"
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/models"
+)
+
+// Parses the ?as_of= query parameter - returns nil when it is not given
+func parseAsOf(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	asOf, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	asOf = asOf.UTC()
+	return &asOf, nil
+}
+
+// Rebuilds inventory as it stood at asOf, optionally limited to a location and/or sku.
+// Starts from the latest snapshot taken at or before asOf and replays the movements recorded
+// after it up to asOf; without a snapshot the ledger is replayed from the beginning.
+func fetchInventoryAsOf(supabaseClient *supabase.Client, locationID, skuID string, asOf time.Time) ([]models.Inventory, error) {
+	filter := func(query *postgrest.FilterBuilder) *postgrest.FilterBuilder {
+		if locationID != "" {
+			query = query.Eq("location_id", locationID)
+		}
+		if skuID != "" {
+			query = query.Eq("sku_id", skuID)
+		}
+		return query
+	}
+
+	quantities := map[stockKey]*models.Inventory{}
+	keys := []stockKey{}
+	add := func(sku, location, user uuid.UUID, quantity int) {
+		key := stockKey{sku, location}
+		inventory, ok := quantities[key]
+		if !ok {
+			inventory = &models.Inventory{SkuID: sku, LocationID: location, UserID: user, UpdatedAt: asOf}
+			quantities[key] = inventory
+			keys = append(keys, key)
+		}
+		inventory.Quantity += quantity
+	}
+
+	latest, _, err := filter(supabaseClient.From("inventory_snapshots").Select("period_end", "", false)).Lte("period_end", asOf.Format(time.RFC3339Nano)).Order("period_end", nil).Limit(1, "").Execute()
+	if err != nil {
+		return nil, err
+	}
+	periods := []struct {
+		PeriodEnd time.Time `json:"period_end"`
+	}{}
+	err = json.Unmarshal(latest, &periods)
+	if err != nil {
+		return nil, err
+	}
+
+	movementQuery := filter(supabaseClient.From("stock_movements").Select("sku_id, location_id, user_id, quantity", "", false))
+	if len(periods) == 0 {
+		movementQuery = movementQuery.Lte("created_at", asOf.Format(time.RFC3339Nano))
+	} else {
+		periodEnd := periods[0].PeriodEnd.UTC().Format(time.RFC3339Nano)
+		snapshotQuery := filter(supabaseClient.From("inventory_snapshots").Select("*", "", false)).Eq("period_end", periodEnd)
+		respSnapshots, err := fetchAllPages[models.InventorySnapshot](snapshotQuery.Order("sku_id", &postgrest.OrderOpts{Ascending: true}).Order("location_id", &postgrest.OrderOpts{Ascending: true}))
+		if err != nil {
+			return nil, err
+		}
+		for _, snapshot := range respSnapshots {
+			add(snapshot.SkuID, snapshot.LocationID, snapshot.UserID, snapshot.Quantity)
+		}
+		movementQuery = movementQuery.And(timeRange("created_at", "gt", periods[0].PeriodEnd, "lte", asOf), "")
+	}
+
+	respMovements, err := fetchAllPages[models.StockMovement](movementQuery.Order("id", &postgrest.OrderOpts{Ascending: true}))
+	if err != nil {
+		return nil, err
+	}
+	for _, movement := range respMovements {
+		add(movement.SkuID, movement.LocationID, movement.UserID, movement.Quantity)
+	}
+
+	inventory := make([]models.Inventory, 0, len(keys))
+	for _, key := range keys {
+		inventory = append(inventory, *quantities[key])
+	}
+	return inventory, nil
+}
+
+// MaterializeSnapshots records the quantity of every sku at every location at periodEnd.
+// Periods that have already been snapshotted are skipped, so it is safe to call repeatedly.
+// Needs a client that can see every company's stock. Returns the number of snapshots taken.
+func MaterializeSnapshots(supabaseClient *supabase.Client, periodEnd time.Time) (int, error) {
+	existing, _, err := supabaseClient.From("inventory_snapshots").Select("period_end", "", false).Eq("period_end", periodEnd.UTC().Format(time.RFC3339Nano)).Limit(1, "").Execute()
+	if err != nil {
+		return 0, err
+	}
+	respExisting := []struct {
+		PeriodEnd time.Time `json:"period_end"`
+	}{}
+	err = json.Unmarshal(existing, &respExisting)
+	if err != nil {
+		return 0, err
+	}
+	if len(respExisting) > 0 {
+		return 0, nil
+	}
+
+	inventory, err := fetchInventoryAsOf(supabaseClient, "", "", periodEnd)
+	if err != nil {
+		return 0, err
+	}
+	if len(inventory) == 0 {
+		return 0, nil
+	}
+
+	now := time.Now()
+	snapshots := make([]models.InventorySnapshot, 0, len(inventory))
+	for _, inv := range inventory {
+		snapshots = append(snapshots, models.InventorySnapshot{
+			SkuID:      inv.SkuID,
+			LocationID: inv.LocationID,
+			UserID:     inv.UserID,
+			Quantity:   inv.Quantity,
+			PeriodEnd:  periodEnd,
+			CreatedAt:  now,
+		})
+	}
+	_, _, err = supabaseClient.From("inventory_snapshots").Insert(snapshots, false, "", "", "").Execute()
+	if err != nil {
+		return 0, err
+	}
+	return len(snapshots), nil
+}
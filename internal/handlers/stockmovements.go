@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/models"
+)
+
+var (
+	ErrInsufficientStock = errors.New("insufficient stock at location")
+	ErrLotNotFound       = errors.New("lot not found")
+	ErrSerialRequired    = errors.New("serialized sku stock can only be moved by serial number")
+)
+
+// Times a running balance is re-read and re-applied when concurrent movements keep changing it
+const balanceAttempts = 5
+
+// Floor for balances that may go anywhere - e.g. stock coming in, which can't take a balance too low
+const noFloor = math.MinInt
+
+// Fetches the on-hand quantity of a sku at a location - the running balance of the movement ledger
+// kept on its inventory row
+func fetchOnHandQuantity(supabaseClient *supabase.Client, skuID, locationID uuid.UUID) (int, error) {
+	inventory, _, err := supabaseClient.From("inventory").Select("quantity", "", false).Eq("sku_id", skuID.String()).Eq("location_id", locationID.String()).Execute()
+	if err != nil {
+		return 0, err
+	}
+	respStruct := []struct {
+		Quantity int `json:"quantity"`
+	}{}
+	err = json.Unmarshal(inventory, &respStruct)
+	if err != nil {
+		return 0, err
+	}
+	if len(respStruct) == 0 {
+		return 0, nil
+	}
+	return respStruct[0].Quantity, nil
+}
+
+// Adds delta to the quantity of the row matching match in table, returning the new quantity - found
+// is false when there is no such row. The row is only written if it still holds the quantity read,
+// so movements landing at the same time can't overwrite each other's changes - and a decrease that
+// would take it below floor is rejected with ErrInsufficientStock against the quantity written over.
+func addToBalance(supabaseClient *supabase.Client, table string, match map[string]string, delta, floor int) (int, bool, error) {
+	for range balanceAttempts {
+		rows, _, err := supabaseClient.From(table).Select("quantity", "", false).Match(match).Execute()
+		if err != nil {
+			return 0, false, err
+		}
+		current := []struct {
+			Quantity int `json:"quantity"`
+		}{}
+		err = json.Unmarshal(rows, &current)
+		if err != nil {
+			return 0, false, err
+		}
+		if len(current) == 0 {
+			return 0, false, nil
+		}
+
+		quantity := current[0].Quantity + delta
+		if delta < 0 && quantity < floor {
+			return 0, true, ErrInsufficientStock
+		}
+		updated, _, err := supabaseClient.From(table).Update(map[string]interface{}{
+			"quantity":   quantity,
+			"updated_at": time.Now(),
+		}, "", "").Match(match).Eq("quantity", strconv.Itoa(current[0].Quantity)).Execute()
+		if err != nil {
+			return 0, false, err
+		}
+		respUpdated := []struct {
+			Quantity int `json:"quantity"`
+		}{}
+		err = json.Unmarshal(updated, &respUpdated)
+		if err != nil {
+			return 0, false, err
+		}
+		if len(respUpdated) > 0 {
+			return quantity, true, nil
+		}
+	}
+	return 0, true, fmt.Errorf("%s quantity kept changing - cannot apply movement", table)
+}
+
+// Adds a movement to the running balance on the sku's inventory row, creating the row for its
+// first movement at the location. Returns the new on-hand quantity. Issues may not take the balance
+// below floor.
+func applyMovementToInventory(supabaseClient *supabase.Client, movement *models.StockMovement, floor int) (int, error) {
+	match := map[string]string{
+		"sku_id":      movement.SkuID.String(),
+		"location_id": movement.LocationID.String(),
+	}
+	total, found, err := addToBalance(supabaseClient, "inventory", match, movement.Quantity, floor)
+	if err != nil || found {
+		return total, err
+	}
+	if movement.Quantity < 0 && movement.Quantity < floor {
+		return 0, ErrInsufficientStock
+	}
+
+	_, _, insertErr := supabaseClient.From("inventory").Insert(&models.Inventory{
+		SkuID:      movement.SkuID,
+		LocationID: movement.LocationID,
+		UserID:     movement.UserID,
+		Quantity:   movement.Quantity,
+		UpdatedAt:  movement.CreatedAt,
+	}, false, "", "", "").Execute()
+	if insertErr == nil {
+		return movement.Quantity, nil
+	}
+	//Another movement may have created the row in the meantime
+	total, found, err = addToBalance(supabaseClient, "inventory", match, movement.Quantity, floor)
+	if err == nil && !found {
+		err = insertErr
+	}
+	return total, err
+}
+
+// Appends a movement to the ledger and applies it to the running balances on the inventory row and,
+// for lot stock, the lot. Movements naming a bin also move the bin's stock, and issues that leave
+// the bins holding more than the warehouse has take the difference out of them.
+// Movements that would take available stock (on-hand less reservations) below zero
+// are rejected with ErrInsufficientStock - checked as the balance is written, so concurrent issues
+// can't both pass. Movements against a lot must name an existing lot,
+// and cannot take that lot below zero either. Stock of serialized skus only moves one serial
+// at a time, so movements for them without a serial number are rejected with ErrSerialRequired
+// unless they move nothing.
+// Stock added is offered to the location's open backorders, oldest first.
+func recordStockMovement(supabaseClient *supabase.Client, movement *models.StockMovement) (*models.Inventory, error) {
+	inventory, err := applyStockMovement(supabaseClient, movement)
+	if err == nil {
+		offerToBackorders(supabaseClient, []*models.StockMovement{movement})
+	}
+	return inventory, err
+}
+
+// Offers stock added by recorded movements to the open backorders at their locations. Operations
+// that may still be undone call this once they have succeeded, so a backorder never reserves stock
+// that is then taken back out.
+func offerToBackorders(supabaseClient *supabase.Client, movements []*models.StockMovement) {
+	offered := map[stockKey]bool{}
+	for _, movement := range movements {
+		key := stockKey{movement.SkuID, movement.LocationID}
+		if movement.Quantity <= 0 || offered[key] {
+			continue
+		}
+		offered[key] = true
+		if err := fillBackorders(supabaseClient, movement.SkuID, movement.LocationID); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// Records a movement as recordStockMovement does, but leaves the stock it adds for the caller to
+// offer to backorders
+func applyStockMovement(supabaseClient *supabase.Client, movement *models.StockMovement) (*models.Inventory, error) {
+	//A movement of nothing doesn't move any serial either
+	if movement.SerialNumber == "" && movement.Quantity != 0 {
+		sku, err := fetchSKU(supabaseClient, movement.SkuID.String())
+		if err != nil {
+			return nil, err
+		}
+		if sku != nil && sku.Serialized {
+			return nil, ErrSerialRequired
+		}
+	}
+
+	//Issues can't dip into reserved stock
+	floor := noFloor
+	if movement.Quantity < 0 {
+		reserved, err := fetchReservedQuantity(supabaseClient, movement.SkuID, movement.LocationID)
+		if err != nil {
+			return nil, err
+		}
+		floor = reserved
+	}
+
+	if movement.BinID != nil && movement.Quantity < 0 {
+		inBin, err := fetchBinQuantity(supabaseClient, *movement.BinID, movement.SkuID)
+		if err != nil {
+			return nil, err
+		}
+		if inBin+movement.Quantity < 0 {
+			return nil, ErrInsufficientStock
+		}
+	}
+
+	if movement.LotNumber != "" {
+		lot, err := fetchLot(supabaseClient, movement.SkuID, movement.LocationID, movement.LotNumber)
+		if err != nil {
+			return nil, err
+		}
+		if lot == nil {
+			return nil, ErrLotNotFound
+		}
+	}
+
+	movement.ID = uuid.New()
+	movement.CreatedAt = time.Now()
+	_, _, err := supabaseClient.From("stock_movements").Insert(movement, false, "", "", "").Execute()
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := applyMovementToInventory(supabaseClient, movement, floor)
+	if err == nil && movement.LotNumber != "" {
+		_, _, err = addToBalance(supabaseClient, "lots", map[string]string{
+			"sku_id":      movement.SkuID.String(),
+			"location_id": movement.LocationID.String(),
+			"lot_number":  movement.LotNumber,
+		}, movement.Quantity, 0)
+		if err != nil {
+			//Keep the inventory row in step with the ledger, which loses the movement below
+			reversal := *movement
+			reversal.Quantity = -movement.Quantity
+			if _, rollbackErr := applyMovementToInventory(supabaseClient, &reversal, noFloor); rollbackErr != nil {
+				fmt.Println(rollbackErr)
+			}
+		}
+	}
+	if err != nil {
+		//The movement wasn't applied, so it mustn't stay in the ledger either
+		if _, _, deleteErr := supabaseClient.From("stock_movements").Delete("", "").Eq("id", movement.ID.String()).Execute(); deleteErr != nil {
+			fmt.Println(deleteErr)
+		}
+		return nil, err
+	}
+
+	inventory := &models.Inventory{
+		SkuID:      movement.SkuID,
+		LocationID: movement.LocationID,
+		UserID:     movement.UserID,
+		Quantity:   total,
+		UpdatedAt:  movement.CreatedAt,
+	}
+
+	//Neither bin, costing, alert nor backorder failures should fail a movement that has already been recorded
+	if movement.BinID != nil {
+		bin := &models.Bin{ID: *movement.BinID, WarehouseID: movement.LocationID}
+		if err := adjustBinQuantity(supabaseClient, bin, movement.SkuID, movement.UserID, movement.Quantity); err != nil {
+			fmt.Println(err)
+		}
+	}
+	if movement.Quantity < 0 {
+		if err := releaseBinStock(supabaseClient, movement, total); err != nil {
+			fmt.Println(err)
+		}
+	}
+	if err := applyMovementCost(supabaseClient, movement); err != nil {
+		fmt.Println(err)
+	}
+	if err := evaluateReorderRule(supabaseClient, movement.SkuID, movement.LocationID, total); err != nil {
+		fmt.Println(err)
+	}
+
+	return inventory, nil
+}
+
+// Reverses a recorded movement as part of undoing the operation it belonged to. The compensating
+// movement goes in the ledger and straight onto the balances - it puts them back as they were, so
+// it isn't held to the stock available, doesn't fill backorders or raise alerts, and takes back the
+// cost the movement added rather than consuming the oldest layers.
+func reverseStockMovement(supabaseClient *supabase.Client, recorded *models.StockMovement) error {
+	reversal := *recorded
+	reversal.ID = uuid.New()
+	reversal.Quantity = -recorded.Quantity
+	reversal.CreatedAt = time.Now()
+	_, _, err := supabaseClient.From("stock_movements").Insert(&reversal, false, "", "", "").Execute()
+	if err != nil {
+		return err
+	}
+
+	_, err = applyMovementToInventory(supabaseClient, &reversal, noFloor)
+	if err == nil && reversal.LotNumber != "" {
+		_, _, err = addToBalance(supabaseClient, "lots", map[string]string{
+			"sku_id":      reversal.SkuID.String(),
+			"location_id": reversal.LocationID.String(),
+			"lot_number":  reversal.LotNumber,
+		}, reversal.Quantity, noFloor)
+		if err != nil {
+			if _, rollbackErr := applyMovementToInventory(supabaseClient, recorded, noFloor); rollbackErr != nil {
+				fmt.Println(rollbackErr)
+			}
+		}
+	}
+	if err != nil {
+		if _, _, deleteErr := supabaseClient.From("stock_movements").Delete("", "").Eq("id", reversal.ID.String()).Execute(); deleteErr != nil {
+			fmt.Println(deleteErr)
+		}
+		return err
+	}
+
+	//The balances are back where they were - bin and cost failures are reported, not undone
+	if reversal.BinID != nil {
+		bin := &models.Bin{ID: *reversal.BinID, WarehouseID: reversal.LocationID}
+		if err := adjustBinQuantity(supabaseClient, bin, reversal.SkuID, reversal.UserID, reversal.Quantity); err != nil {
+			fmt.Println(err)
+		}
+	}
+	if err := reverseMovementCost(supabaseClient, recorded, &reversal); err != nil {
+		fmt.Println(err)
+	}
+	return nil
+}
+
+// Lists the movement history for a sku at a location, newest first
+func GetStockMovements(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	locationID := c.Params("locationid")
+	skuID := c.Params("skuid")
+
+	if _, err := uuid.Parse(locationID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid location ID",
+		})
+	}
+	if _, err := uuid.Parse(skuID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid sku ID",
+		})
+	}
+
+	movements, _, err := supabaseClient.From("stock_movements").Select("*", "", false).Eq("location_id", locationID).Eq("sku_id", skuID).Order("created_at", nil).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch stock movements from database",
+		})
+	}
+	respStruct := []models.StockMovement{}
+	err = json.Unmarshal(movements, &respStruct)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal stock movements from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(respStruct)
+}
@@ -0,0 +1,407 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/database"
+	"ucrs.com/inventory-manager/backend/internal/models"
+)
+
+// Fetches a supplier - returns nil if it does not exist
+func fetchSupplier(supabaseClient *supabase.Client, supplierID string) (*models.Supplier, error) {
+	supplier, _, err := supabaseClient.From("suppliers").Select("*", "", false).Eq("id", supplierID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.Supplier{}
+	err = json.Unmarshal(supplier, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	if len(respStruct) == 0 {
+		return nil, nil
+	}
+	return &respStruct[0], nil
+}
+
+// Fetches what a supplier charges for a sku - returns nil if they don't supply it
+func fetchSupplierSKU(supabaseClient *supabase.Client, supplierID, skuID uuid.UUID) (*models.SupplierSKU, error) {
+	supplierSKU, _, err := supabaseClient.From("supplier_skus").Select("*", "", false).Eq("supplier_id", supplierID.String()).Eq("sku_id", skuID.String()).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.SupplierSKU{}
+	err = json.Unmarshal(supplierSKU, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	if len(respStruct) == 0 {
+		return nil, nil
+	}
+	return &respStruct[0], nil
+}
+
+// Checks the fields shared by creating and updating a supplier - returns an error message, or "" if valid
+func validateSupplier(supplier *models.Supplier) string {
+	if supplier.Name == "" {
+		return "Supplier name is required"
+	}
+	supplier.Currency = strings.ToUpper(supplier.Currency)
+	if len(supplier.Currency) != 3 {
+		return "Currency must be a 3 letter ISO 4217 code"
+	}
+	if supplier.LeadTimeDays < 0 {
+		return "Lead time cannot be negative"
+	}
+	return ""
+}
+
+func CreateSupplier(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	supplier := new(models.Supplier)
+
+	if err := c.BodyParser(supplier); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	// Basic validation
+	if msg := validateSupplier(supplier); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	now := time.Now()
+	supplier.ID = uuid.New()
+	supplier.UserID = userID
+	supplier.CreatedAt = now
+	supplier.UpdatedAt = now
+
+	//Save to database
+	_, _, err = supabaseClient.From("suppliers").Insert(supplier, false, "", "", "").Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save supplier to database",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(supplier)
+}
+
+func UpdateSupplier(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	supplierID := c.Params("id")
+	supplier := new(models.Supplier)
+
+	sid, err := uuid.Parse(supplierID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid supplier ID",
+		})
+	}
+
+	if err := c.BodyParser(supplier); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	// Basic validation
+	if msg := validateSupplier(supplier); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	existing, err := fetchSupplier(supabaseClient, supplierID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch supplier from database",
+		})
+	}
+	if existing == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Supplier not found",
+		})
+	}
+
+	supplier.ID = sid
+	supplier.UserID = existing.UserID
+	supplier.CreatedAt = existing.CreatedAt
+	supplier.UpdatedAt = time.Now()
+
+	_, _, err = supabaseClient.From("suppliers").Update(supplier, "", "").Eq("id", supplierID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save supplier to database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(supplier)
+}
+
+func GetSuppliers(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	suppliers, _, err := supabaseClient.From("suppliers").Select("*", "", false).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch suppliers from database",
+		})
+	}
+	respStruct := []models.Supplier{}
+	err = json.Unmarshal(suppliers, &respStruct)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal suppliers from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(respStruct)
+}
+
+func GetSupplier(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	supplierID := c.Params("id")
+
+	supplier, err := fetchSupplier(supabaseClient, supplierID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch supplier from database",
+		})
+	}
+	if supplier == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Supplier not found",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(supplier)
+}
+
+func DeleteSupplier(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	supplierID := c.Params("id")
+
+	//Suppliers with purchase orders are kept for the order history
+	orders, _, err := supabaseClient.From("purchase_orders").Select("id", "", false).Eq("supplier_id", supplierID).Limit(1, "").Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch purchase orders from database",
+		})
+	}
+	respOrders := []struct {
+		ID uuid.UUID `json:"id"`
+	}{}
+	err = json.Unmarshal(orders, &respOrders)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal purchase orders from database",
+		})
+	}
+	if len(respOrders) > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Supplier has purchase orders and cannot be deleted",
+		})
+	}
+
+	_, _, err = supabaseClient.From("supplier_skus").Delete("", "").Eq("supplier_id", supplierID).Execute()
+	if err == nil {
+		_, _, err = supabaseClient.From("suppliers").Delete("", "").Eq("id", supplierID).Execute()
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot delete supplier from database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Supplier deleted successfully",
+	})
+}
+
+// Adds or updates the code, price and lead time a supplier has for a sku
+func UpdateSupplierSKU(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	supplierID := c.Params("id")
+	supplierSKU := new(models.SupplierSKU)
+
+	if err := c.BodyParser(supplierSKU); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	sid, err := uuid.Parse(supplierID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid supplier ID",
+		})
+	}
+
+	// Basic validation
+	if supplierSKU.SkuID == uuid.Nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "SKU ID is required",
+		})
+	}
+
+	if supplierSKU.Price < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Price cannot be negative",
+		})
+	}
+
+	if supplierSKU.MinOrderQuantity < 0 || (supplierSKU.LeadTimeDays != nil && *supplierSKU.LeadTimeDays < 0) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Minimum order quantity and lead time cannot be negative",
+		})
+	}
+
+	supplier, err := fetchSupplier(supabaseClient, supplierID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch supplier from database",
+		})
+	}
+	if supplier == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Supplier not found",
+		})
+	}
+
+	sku, err := fetchSKU(supabaseClient, supplierSKU.SkuID.String())
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch SKU from database",
+		})
+	}
+	if sku == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "SKU not found",
+		})
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	existing, err := fetchSupplierSKU(supabaseClient, sid, supplierSKU.SkuID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch supplier SKU from database",
+		})
+	}
+
+	now := time.Now()
+	supplierSKU.ID = uuid.New()
+	supplierSKU.CreatedAt = now
+	if existing != nil {
+		supplierSKU.ID = existing.ID
+		supplierSKU.CreatedAt = existing.CreatedAt
+	}
+	supplierSKU.SupplierID = sid
+	supplierSKU.UserID = userID
+	supplierSKU.UpdatedAt = now
+
+	_, _, err = supabaseClient.From("supplier_skus").Upsert(supplierSKU, "supplier_id, sku_id", "", "").Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save supplier SKU to database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(supplierSKU)
+}
+
+// Lists the skus a supplier supplies
+func GetSupplierSKUs(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	supplierID := c.Params("id")
+
+	supplierSKUs, _, err := supabaseClient.From("supplier_skus").Select("*", "", false).Eq("supplier_id", supplierID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch supplier SKUs from database",
+		})
+	}
+	respStruct := []models.SupplierSKU{}
+	err = json.Unmarshal(supplierSKUs, &respStruct)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal supplier SKUs from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(respStruct)
+}
+
+// Lists every supplier of a sku, with their price and lead time for it
+func GetSKUSuppliers(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	skuID := c.Params("id")
+
+	supplierSKUs, _, err := supabaseClient.From("supplier_skus").Select("*", "", false).Eq("sku_id", skuID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch supplier SKUs from database",
+		})
+	}
+	respStruct := []models.SupplierSKU{}
+	err = json.Unmarshal(supplierSKUs, &respStruct)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal supplier SKUs from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(respStruct)
+}
+
+func DeleteSupplierSKU(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	supplierID := c.Params("id")
+	skuID := c.Params("skuid")
+
+	_, _, err := supabaseClient.From("supplier_skus").Delete("", "").Eq("supplier_id", supplierID).Eq("sku_id", skuID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot delete supplier SKU from database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Supplier SKU deleted successfully",
+	})
+}
@@ -0,0 +1,563 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/database"
+	"ucrs.com/inventory-manager/backend/internal/models"
+)
+
+func convertTransferForDB(transfer *models.Transfer) *models.TransferDatabase {
+	return &models.TransferDatabase{
+		ID:                    transfer.ID,
+		UserID:                transfer.UserID,
+		SourceLocationID:      transfer.SourceLocationID,
+		DestinationLocationID: transfer.DestinationLocationID,
+		Status:                transfer.Status,
+		Notes:                 transfer.Notes,
+		ShippedAt:             transfer.ShippedAt,
+		ReceivedAt:            transfer.ReceivedAt,
+		CreatedAt:             transfer.CreatedAt,
+		UpdatedAt:             transfer.UpdatedAt,
+	}
+}
+
+func convertTransferForJSON(transfer *models.TransferDatabase, lines []models.TransferLine) *models.Transfer {
+	return &models.Transfer{
+		ID:                    transfer.ID,
+		UserID:                transfer.UserID,
+		SourceLocationID:      transfer.SourceLocationID,
+		DestinationLocationID: transfer.DestinationLocationID,
+		Status:                transfer.Status,
+		Notes:                 transfer.Notes,
+		Lines:                 lines,
+		ShippedAt:             transfer.ShippedAt,
+		ReceivedAt:            transfer.ReceivedAt,
+		CreatedAt:             transfer.CreatedAt,
+		UpdatedAt:             transfer.UpdatedAt,
+	}
+}
+
+// Fetches a transfer with its lines - returns nil if the transfer does not exist
+func fetchTransfer(supabaseClient *supabase.Client, transferID string) (*models.Transfer, error) {
+	transfer, _, err := supabaseClient.From("transfers").Select("*", "", false).Eq("id", transferID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.TransferDatabase{}
+	err = json.Unmarshal(transfer, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	if len(respStruct) == 0 {
+		return nil, nil
+	}
+
+	lines, _, err := supabaseClient.From("transfer_lines").Select("*", "", false).Eq("transfer_id", transferID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respLines := []models.TransferLine{}
+	err = json.Unmarshal(lines, &respLines)
+	if err != nil {
+		return nil, err
+	}
+
+	return convertTransferForJSON(&respStruct[0], respLines), nil
+}
+
+func transferDiscrepancies(lines []models.TransferLine) []models.TransferDiscrepancy {
+	discrepancies := []models.TransferDiscrepancy{}
+	for _, line := range lines {
+		if line.QuantityReceived != line.Quantity {
+			discrepancies = append(discrepancies, models.TransferDiscrepancy{
+				SkuID:            line.SkuID,
+				QuantityShipped:  line.Quantity,
+				QuantityReceived: line.QuantityReceived,
+				Difference:       line.QuantityReceived - line.Quantity,
+			})
+		}
+	}
+	return discrepancies
+}
+
+func CreateTransfer(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	transfer := new(models.Transfer)
+
+	if err := c.BodyParser(transfer); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	// Basic validation
+	if transfer.SourceLocationID == uuid.Nil || transfer.DestinationLocationID == uuid.Nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Source and destination locations are required",
+		})
+	}
+
+	if transfer.SourceLocationID == transfer.DestinationLocationID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Source and destination locations must be different",
+		})
+	}
+
+	if len(transfer.Lines) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Transfer must have at least one line",
+		})
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	transfer.ID = uuid.New()
+	transfer.UserID = userID
+	transfer.Status = models.TransferStatusDraft
+	transfer.ShippedAt = nil
+	transfer.ReceivedAt = nil
+
+	//Lines for the same sku are merged so each sku appears once on the transfer
+	lines := []models.TransferLine{}
+	lineIndex := map[uuid.UUID]int{}
+	for _, line := range transfer.Lines {
+		if line.SkuID == uuid.Nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "SKU ID is required on every line",
+			})
+		}
+		if line.Quantity <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Line quantity must be greater than 0",
+			})
+		}
+		line.Quantity, err = toBaseQuantity(supabaseClient, line.SkuID, line.Unit, line.Quantity)
+		if err != nil {
+			return unitErrorResponse(c, err)
+		}
+		if i, ok := lineIndex[line.SkuID]; ok {
+			lines[i].Quantity += line.Quantity
+			continue
+		}
+		lineIndex[line.SkuID] = len(lines)
+		lines = append(lines, models.TransferLine{
+			ID:         uuid.New(),
+			TransferID: transfer.ID,
+			SkuID:      line.SkuID,
+			UserID:     userID,
+			Quantity:   line.Quantity,
+		})
+	}
+	transfer.Lines = lines
+
+	// Set timestamps
+	now := time.Now()
+	transfer.CreatedAt = now
+	transfer.UpdatedAt = now
+
+	//Save to database
+	_, _, err = supabaseClient.From("transfers").Insert(convertTransferForDB(transfer), false, "", "", "").Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save transfer to database",
+		})
+	}
+
+	_, _, err = supabaseClient.From("transfer_lines").Insert(transfer.Lines, false, "", "", "").Execute()
+	if err != nil {
+		fmt.Println(err)
+		//Don't leave a transfer without lines behind
+		supabaseClient.From("transfers").Delete("", "").Eq("id", transfer.ID.String()).Execute()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save transfer lines to database",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(transfer)
+}
+
+func GetTransfers(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	query := supabaseClient.From("transfers").Select("*", "", false)
+	if status := c.Query("status"); status != "" {
+		query = query.Eq("status", status)
+	}
+	transfers, _, err := query.Order("created_at", nil).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch transfers from database",
+		})
+	}
+	respStruct := []models.TransferDatabase{}
+	err = json.Unmarshal(transfers, &respStruct)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal transfer from database",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(respStruct)
+}
+
+func GetTransfer(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	transferID := c.Params("id")
+
+	transfer, err := fetchTransfer(supabaseClient, transferID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch transfer from database",
+		})
+	}
+	if transfer == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Transfer not found",
+		})
+	}
+
+	resp := fiber.Map{
+		"transfer": transfer,
+	}
+	if transfer.Status != models.TransferStatusDraft && transfer.Status != models.TransferStatusCancelled {
+		resp["discrepancies"] = transferDiscrepancies(transfer.Lines)
+	}
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+// Dispatches a draft transfer - stock leaves the source location and is held on the transfer until received
+func ShipTransfer(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	transferID := c.Params("id")
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	transfer, err := fetchTransfer(supabaseClient, transferID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch transfer from database",
+		})
+	}
+	if transfer == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Transfer not found",
+		})
+	}
+	if transfer.Status != models.TransferStatusDraft {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Only draft transfers can be shipped",
+		})
+	}
+
+	//Check every line before moving anything so a short line doesn't leave the transfer half shipped
+	for _, line := range transfer.Lines {
+		sku, err := fetchSKU(supabaseClient, line.SkuID.String())
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch SKU from database",
+			})
+		}
+		if sku != nil && sku.Serialized {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  "Serialized SKUs must be moved by serial number",
+				"sku_id": line.SkuID,
+			})
+		}
+
+		available, err := fetchAvailableQuantity(supabaseClient, line.SkuID, transfer.SourceLocationID)
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch inventory from database",
+			})
+		}
+		if available < line.Quantity {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":  "Insufficient stock at source location",
+				"sku_id": line.SkuID,
+			})
+		}
+	}
+
+	//Every line leaves the source or none do
+	movements := []*models.StockMovement{}
+	for _, line := range transfer.Lines {
+		movements = append(movements, &models.StockMovement{
+			SkuID:      line.SkuID,
+			LocationID: transfer.SourceLocationID,
+			UserID:     userID,
+			Quantity:   -line.Quantity,
+			Reason:     models.MovementReasonTransferOut,
+			Reference:  "transfer:" + transfer.ID.String(),
+		})
+	}
+	err = recordStockMovements(supabaseClient, movements)
+	if errors.Is(err, ErrInsufficientStock) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Insufficient stock at source location",
+		})
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot update inventory in database",
+		})
+	}
+
+	now := time.Now()
+	transfer.Status = models.TransferStatusInTransit
+	transfer.ShippedAt = &now
+	transfer.UpdatedAt = now
+	_, _, err = supabaseClient.From("transfers").Update(convertTransferForDB(transfer), "", "").Eq("id", transferID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		//Still a draft, so put the stock back where it was
+		if err := reverseStockMovements(supabaseClient, movements); err != nil {
+			fmt.Println(err)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save transfer to database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(transfer)
+}
+
+// The unit cost each sku of a transfer left its source at, read from the transfer's issues - stock
+// received is valued the same, so moving it neither creates nor destroys value
+func fetchTransferIssueCosts(supabaseClient *supabase.Client, transfer *models.Transfer) (map[uuid.UUID]*float64, error) {
+	movements, _, err := supabaseClient.From("stock_movements").Select("sku_id, unit_cost", "", false).Eq("reference", "transfer:"+transfer.ID.String()).Eq("reason", models.MovementReasonTransferOut).Eq("location_id", transfer.SourceLocationID.String()).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.StockMovement{}
+	err = json.Unmarshal(movements, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	costs := map[uuid.UUID]*float64{}
+	for _, movement := range respStruct {
+		if movement.UnitCost != nil {
+			costs[movement.SkuID] = movement.UnitCost
+		}
+	}
+	return costs, nil
+}
+
+// Receives some or all of an in-transit transfer into the destination location - every line of
+// the receipt is booked or none is. The transfer is closed once every line is fully received, or when "close" is set -
+// any shortfall at that point is reported as a discrepancy.
+func ReceiveTransfer(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	transferID := c.Params("id")
+	request := new(struct {
+		Lines []struct {
+			SkuID    uuid.UUID `json:"sku_id"`
+			Quantity int       `json:"quantity"`
+			Unit     string    `json:"unit"`
+		} `json:"lines"`
+		Close bool `json:"close"`
+	})
+	if err := c.BodyParser(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	transfer, err := fetchTransfer(supabaseClient, transferID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch transfer from database",
+		})
+	}
+	if transfer == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Transfer not found",
+		})
+	}
+	if transfer.Status != models.TransferStatusInTransit {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Only in-transit transfers can be received",
+		})
+	}
+
+	lineIndex := map[uuid.UUID]int{}
+	for i, line := range transfer.Lines {
+		lineIndex[line.SkuID] = i
+	}
+
+	//Validate the whole receipt first - over-receipts are rejected
+	received := map[uuid.UUID]int{}
+	for _, line := range request.Lines {
+		i, ok := lineIndex[line.SkuID]
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  "SKU is not on this transfer",
+				"sku_id": line.SkuID,
+			})
+		}
+		if line.Quantity <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Received quantity must be greater than 0",
+			})
+		}
+		quantity, err := toBaseQuantity(supabaseClient, line.SkuID, line.Unit, line.Quantity)
+		if err != nil {
+			return unitErrorResponse(c, err)
+		}
+		received[line.SkuID] += quantity
+		if transfer.Lines[i].QuantityReceived+received[line.SkuID] > transfer.Lines[i].Quantity {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":  "Received quantity exceeds quantity shipped",
+				"sku_id": line.SkuID,
+			})
+		}
+	}
+
+	issueCosts, err := fetchTransferIssueCosts(supabaseClient, transfer)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch stock movements from database",
+		})
+	}
+
+	//The whole receipt is booked or none of it is - stock first, then the lines and the transfer
+	movements := []*models.StockMovement{}
+	for skuID, quantity := range received {
+		movements = append(movements, &models.StockMovement{
+			SkuID:      skuID,
+			LocationID: transfer.DestinationLocationID,
+			UserID:     userID,
+			Quantity:   quantity,
+			Reason:     models.MovementReasonTransferIn,
+			Reference:  "transfer:" + transfer.ID.String(),
+			UnitCost:   issueCosts[skuID],
+		})
+	}
+	err = recordStockMovements(supabaseClient, movements)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot update inventory in database",
+		})
+	}
+
+	saved := []int{}
+	undo := func() {
+		for _, i := range saved {
+			transfer.Lines[i].QuantityReceived -= received[transfer.Lines[i].SkuID]
+			_, _, err := supabaseClient.From("transfer_lines").Update(transfer.Lines[i], "", "").Eq("id", transfer.Lines[i].ID.String()).Execute()
+			if err != nil {
+				fmt.Println(err)
+			}
+		}
+		if err := reverseStockMovements(supabaseClient, movements); err != nil {
+			fmt.Println(err)
+		}
+	}
+	for skuID, quantity := range received {
+		i := lineIndex[skuID]
+		transfer.Lines[i].QuantityReceived += quantity
+		_, _, err = supabaseClient.From("transfer_lines").Update(transfer.Lines[i], "", "").Eq("id", transfer.Lines[i].ID.String()).Execute()
+		if err != nil {
+			fmt.Println(err)
+			transfer.Lines[i].QuantityReceived -= quantity
+			undo()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":  "Cannot save transfer line to database",
+				"sku_id": skuID,
+			})
+		}
+		saved = append(saved, i)
+	}
+
+	discrepancies := transferDiscrepancies(transfer.Lines)
+	now := time.Now()
+	transfer.UpdatedAt = now
+	if request.Close || len(discrepancies) == 0 {
+		transfer.Status = models.TransferStatusReceived
+		transfer.ReceivedAt = &now
+	}
+	_, _, err = supabaseClient.From("transfers").Update(convertTransferForDB(transfer), "", "").Eq("id", transferID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		undo()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save transfer to database",
+		})
+	}
+	offerToBackorders(supabaseClient, movements)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"transfer":      transfer,
+		"discrepancies": discrepancies,
+	})
+}
+
+// Cancels a transfer - only drafts can be cancelled, as nothing has moved yet
+func CancelTransfer(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	transferID := c.Params("id")
+
+	transfer, err := fetchTransfer(supabaseClient, transferID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch transfer from database",
+		})
+	}
+	if transfer == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Transfer not found",
+		})
+	}
+	if transfer.Status != models.TransferStatusDraft {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Only draft transfers can be cancelled",
+		})
+	}
+
+	transfer.Status = models.TransferStatusCancelled
+	transfer.UpdatedAt = time.Now()
+	_, _, err = supabaseClient.From("transfers").Update(convertTransferForDB(transfer), "", "").Eq("id", transferID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save transfer to database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Transfer cancelled successfully",
+	})
+}
@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/database"
+	"ucrs.com/inventory-manager/backend/internal/models"
+)
+
+var (
+	ErrUnknownUnit        = errors.New("unit is not defined for this sku")
+	ErrFractionalQuantity = errors.New("quantity does not convert to a whole number of base units")
+)
+
+// Fetches the alternative units of a sku
+func fetchUnits(supabaseClient *supabase.Client, skuID string) ([]models.Unit, error) {
+	units, _, err := supabaseClient.From("units").Select("*", "", false).Eq("sku_id", skuID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.Unit{}
+	err = json.Unmarshal(units, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	return respStruct, nil
+}
+
+// Fetches a unit by ID - returns nil if it does not exist
+func fetchUnit(supabaseClient *supabase.Client, unitID string) (*models.Unit, error) {
+	unit, _, err := supabaseClient.From("units").Select("*", "", false).Eq("id", unitID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respStruct := []models.Unit{}
+	err = json.Unmarshal(unit, &respStruct)
+	if err != nil {
+		return nil, err
+	}
+	if len(respStruct) == 0 {
+		return nil, nil
+	}
+	return &respStruct[0], nil
+}
+
+func baseUnit(sku *models.SKU) string {
+	if sku == nil || sku.BaseUnit == "" {
+		return models.DefaultBaseUnit
+	}
+	return sku.BaseUnit
+}
+
+// Converts a quantity given in a unit of a sku to its base unit. No unit, or the base unit,
+// leaves the quantity as it is.
+func toBaseQuantity(supabaseClient *supabase.Client, skuID uuid.UUID, unit string, quantity int) (int, error) {
+	if unit == "" {
+		return quantity, nil
+	}
+	sku, err := fetchSKU(supabaseClient, skuID.String())
+	if err != nil {
+		return 0, err
+	}
+	if strings.EqualFold(unit, baseUnit(sku)) {
+		return quantity, nil
+	}
+
+	units, err := fetchUnits(supabaseClient, skuID.String())
+	if err != nil {
+		return 0, err
+	}
+	for _, u := range units {
+		if !strings.EqualFold(u.Name, unit) {
+			continue
+		}
+		base := float64(quantity) * u.Factor
+		rounded := math.Round(base)
+		if math.Abs(base-rounded) > 1e-9 {
+			return 0, ErrFractionalQuantity
+		}
+		return int(rounded), nil
+	}
+	return 0, ErrUnknownUnit
+}
+
+// Responds to a failed unit conversion
+func unitErrorResponse(c *fiber.Ctx, err error) error {
+	if errors.Is(err, ErrUnknownUnit) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unit is not defined for this SKU",
+		})
+	}
+	if errors.Is(err, ErrFractionalQuantity) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Quantity does not convert to a whole number of base units",
+		})
+	}
+	fmt.Println(err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Cannot fetch units from database",
+	})
+}
+
+// Adds an alternative unit to a sku
+func CreateUnit(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	skuID := c.Params("id")
+	unit := new(models.Unit)
+
+	if err := c.BodyParser(unit); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	sID, err := uuid.Parse(skuID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid sku ID",
+		})
+	}
+
+	// Basic validation
+	unit.Name = strings.TrimSpace(unit.Name)
+	if unit.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unit name is required",
+		})
+	}
+
+	if unit.Factor <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Factor must be greater than 0",
+		})
+	}
+
+	sku, err := fetchSKU(supabaseClient, skuID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch SKU from database",
+		})
+	}
+	if sku == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "SKU not found",
+		})
+	}
+	if strings.EqualFold(unit.Name, baseUnit(sku)) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unit has the same name as the SKU's base unit",
+		})
+	}
+
+	units, err := fetchUnits(supabaseClient, skuID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch units from database",
+		})
+	}
+	for _, u := range units {
+		if strings.EqualFold(u.Name, unit.Name) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Unit already exists for this SKU",
+			})
+		}
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+
+	now := time.Now()
+	unit.ID = uuid.New()
+	unit.SkuID = sID
+	unit.UserID = userID
+	unit.CreatedAt = now
+	unit.UpdatedAt = now
+
+	_, _, err = supabaseClient.From("units").Insert(unit, false, "", "", "").Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save unit to database",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(unit)
+}
+
+// Lists a sku's base unit and its alternative units
+func GetUnits(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	skuID := c.Params("id")
+
+	sku, err := fetchSKU(supabaseClient, skuID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch SKU from database",
+		})
+	}
+	if sku == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "SKU not found",
+		})
+	}
+
+	units, err := fetchUnits(supabaseClient, skuID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch units from database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"base_unit": baseUnit(sku),
+		"units":     units,
+	})
+}
+
+// Removes an alternative unit. Units that still have barcodes linked to them cannot be removed.
+func DeleteUnit(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	skuID := c.Params("id")
+	unitID := c.Params("unitid")
+
+	barcodes, _, err := supabaseClient.From("barcodes").Select("id", "", false).Eq("unit_id", unitID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch barcodes from database",
+		})
+	}
+	respBarcodes := []struct {
+		ID uuid.UUID `json:"id"`
+	}{}
+	err = json.Unmarshal(barcodes, &respBarcodes)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot unmarshal barcodes from database",
+		})
+	}
+	if len(respBarcodes) > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Unit still has barcodes linked to it",
+		})
+	}
+
+	_, _, err = supabaseClient.From("units").Delete("", "").Eq("id", unitID).Eq("sku_id", skuID).Execute()
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot delete unit from database",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Unit deleted successfully",
+	})
+}
@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/database"
+	"ucrs.com/inventory-manager/backend/internal/models"
+)
+
+// Largest matrix generated in one request
+const maxVariantCombinations = 1000
+
+// Every combination of one value from each axis, in axis order
+func variantCombinations(axes []models.VariantAxis) [][]string {
+	combinations := [][]string{{}}
+	for _, axis := range axes {
+		next := make([][]string, 0, len(combinations)*len(axis.Values))
+		for _, combination := range combinations {
+			for _, value := range axis.Values {
+				next = append(next, append(append([]string{}, combination...), value))
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
+
+// Key identifying a combination of values across the axes
+func variantKey(values []string) string {
+	return strings.Join(values, "\x00")
+}
+
+// SKU code of a variant - the prefix and each of its values, upper case and joined by hyphens
+func variantSKUCode(prefix string, values []string) string {
+	parts := append([]string{prefix}, values...)
+	for i, part := range parts {
+		parts[i] = strings.ToUpper(strings.Join(strings.Fields(part), "-"))
+	}
+	return strings.Join(parts, "-")
+}
+
+// Fetches a product's skus by the combination of values they have on the given axes. Skus missing
+// a value for any of the axes aren't part of the matrix and are left out.
+func fetchVariantsByKey(supabaseClient *supabase.Client, productID string, axes []models.VariantAxis) (map[string]models.Variant, error) {
+	skus, _, err := supabaseClient.From("skus").Select("*", "", false).Eq("product_id", productID).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respSKUs := []models.SKU{}
+	err = json.Unmarshal(skus, &respSKUs)
+	if err != nil {
+		return nil, err
+	}
+	variants := map[string]models.Variant{}
+	if len(respSKUs) == 0 {
+		return variants, nil
+	}
+
+	skuIDs := make([]string, 0, len(respSKUs))
+	for _, sku := range respSKUs {
+		skuIDs = append(skuIDs, sku.ID.String())
+	}
+	attributes, _, err := supabaseClient.From("sku_attributes").Select("*", "", false).In("sku_id", skuIDs).Execute()
+	if err != nil {
+		return nil, err
+	}
+	respAttributes := []models.SKUAttributes{}
+	err = json.Unmarshal(attributes, &respAttributes)
+	if err != nil {
+		return nil, err
+	}
+	values := map[uuid.UUID]map[uuid.UUID]models.SKUAttributes{}
+	for _, attribute := range respAttributes {
+		if values[attribute.SkuID] == nil {
+			values[attribute.SkuID] = map[uuid.UUID]models.SKUAttributes{}
+		}
+		values[attribute.SkuID][attribute.AttributeID] = attribute
+	}
+
+	for _, sku := range respSKUs {
+		variant := models.Variant{SKU: sku}
+		combination := []string{}
+		for _, axis := range axes {
+			attribute, ok := values[sku.ID][axis.AttributeID]
+			if !ok {
+				break
+			}
+			combination = append(combination, attribute.AttributeValue)
+			variant.Attributes = append(variant.Attributes, attribute)
+		}
+		if len(combination) == len(axes) {
+			variants[variantKey(combination)] = variant
+		}
+	}
+	return variants, nil
+}
+
+// Generates a sku for every combination of the given attribute values, with its attribute rows, in
+// one go - e.g. 5 sizes by 6 colours gives 30 skus. Combinations the product already has a sku for
+// are skipped. Skus take the price and costs given, falling back to the product's price, and are
+// coded by the company's SKU template - or from sku_prefix (default the product name) and their
+// values when a prefix is given or there is no template.
+func GenerateVariants(c *fiber.Ctx) error {
+	supabaseClient := c.Locals("supabaseClient").(*supabase.Client)
+	productID := c.Params("id")
+	request := new(struct {
+		Attributes   []models.VariantAxis `json:"attributes"`
+		SKUPrefix    string               `json:"sku_prefix"`
+		Price        float64              `json:"price"`
+		StandardCost float64              `json:"standard_cost"`
+		BaseUnit     string               `json:"base_unit"`
+	})
+	if err := c.BodyParser(request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	// Basic validation
+	if len(request.Attributes) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "At least one attribute with values is required",
+		})
+	}
+	combinations := 1
+	seen := map[uuid.UUID]bool{}
+	attributeIDs := []string{}
+	for i := range request.Attributes {
+		axis := &request.Attributes[i]
+		if axis.AttributeID == uuid.Nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Attribute ID is required",
+			})
+		}
+		if seen[axis.AttributeID] {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Each attribute can only be given once",
+			})
+		}
+		seen[axis.AttributeID] = true
+		attributeIDs = append(attributeIDs, axis.AttributeID.String())
+
+		//Blank and repeated values would make blank or duplicate skus
+		values := []string{}
+		distinct := map[string]bool{}
+		for _, value := range axis.Values {
+			value = strings.TrimSpace(value)
+			if value == "" || distinct[value] {
+				continue
+			}
+			distinct[value] = true
+			values = append(values, value)
+		}
+		if len(values) == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Every attribute needs at least one value",
+			})
+		}
+		axis.Values = values
+		combinations *= len(values)
+		if combinations > maxVariantCombinations {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Cannot generate more than %d variants at once", maxVariantCombinations),
+			})
+		}
+	}
+
+	if request.Price < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Price cannot be negative",
+		})
+	}
+
+	if request.StandardCost < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Standard cost cannot be negative",
+		})
+	}
+
+	product, err := fetchProduct(supabaseClient, productID)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch product from database",
+		})
+	}
+	if product == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Product not found",
+		})
+	}
+
+	attributes, err := fetchAttributesByID(supabaseClient, attributeIDs)
+	if err != nil {
+		return validationErrorResponse(c, err, "Cannot fetch attributes from database")
+	}
+	//Values must conform to their attribute's type - conforming can make two values the same
+	for i := range request.Attributes {
+		axis := &request.Attributes[i]
+		attribute := attributes[axis.AttributeID]
+		values := []string{}
+		for _, value := range axis.Values {
+			value, err := attribute.ConformValue(value)
+			if err != nil {
+				return attributeValueErrorResponse(c, fmt.Sprintf("attributes[%d].values", i), err)
+			}
+			if !slices.Contains(values, value) {
+				values = append(values, value)
+			}
+		}
+		axis.Values = values
+	}
+
+	existing, err := fetchVariantsByKey(supabaseClient, productID, request.Attributes)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch SKUs from database",
+		})
+	}
+
+	userID, err := database.FetchUserID(supabaseClient)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Cannot fetch user ID - please log in",
+		})
+	}
+	generator, err := newSKUCodeGenerator(supabaseClient)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch SKU codes from database",
+		})
+	}
+	values, err := skuTemplateValues(supabaseClient, product, nil)
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch category from database",
+		})
+	}
+
+	price := request.Price
+	if price == 0 {
+		price = product.Price
+	}
+	baseUnit := request.BaseUnit
+	if baseUnit == "" {
+		baseUnit = models.DefaultBaseUnit
+	}
+	//The company's SKU template codes the variants unless a prefix is given
+	useTemplate := request.SKUPrefix == "" && generator.template != ""
+	prefix := request.SKUPrefix
+	if prefix == "" {
+		prefix = product.Name
+	}
+
+	now := time.Now()
+	matrix := models.VariantMatrix{
+		Created: []models.Variant{},
+		Skipped: []models.Variant{},
+	}
+	skus := []models.SKU{}
+	skuAttributes := []models.SKUAttributes{}
+	for _, combination := range variantCombinations(request.Attributes) {
+		if variant, ok := existing[variantKey(combination)]; ok {
+			matrix.Skipped = append(matrix.Skipped, variant)
+			continue
+		}
+
+		code := variantSKUCode(prefix, combination)
+		if useTemplate {
+			values.Attributes = map[string]string{}
+			for i, value := range combination {
+				values.Attributes[attributes[request.Attributes[i].AttributeID].Name] = value
+			}
+			code, err = generator.generate("", values)
+			if err != nil {
+				return validationErrorResponse(c, err, "Cannot generate SKU code")
+			}
+		} else {
+			taken, err := generator.taken(code)
+			if err != nil {
+				fmt.Println(err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Cannot fetch SKU codes from database",
+				})
+			}
+			if taken {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error": "SKU code " + code + " already exists in this company - give a different sku_prefix",
+				})
+			}
+			generator.codes[code] = true
+		}
+
+		variant := models.Variant{
+			SKU: models.SKU{
+				ID:           uuid.New(),
+				UserID:       userID,
+				CompanyID:    generator.companyID,
+				ProductID:    product.ID,
+				SKU:          code,
+				Price:        price,
+				BaseUnit:     baseUnit,
+				StandardCost: request.StandardCost,
+				CreatedAt:    now,
+				UpdatedAt:    now,
+			},
+		}
+		for i, value := range combination {
+			variant.Attributes = append(variant.Attributes, models.SKUAttributes{
+				SkuID:          variant.SKU.ID,
+				AttributeID:    request.Attributes[i].AttributeID,
+				AttributeValue: value,
+				UserID:         userID,
+			})
+		}
+		skus = append(skus, variant.SKU)
+		skuAttributes = append(skuAttributes, variant.Attributes...)
+		matrix.Created = append(matrix.Created, variant)
+	}
+	if len(skus) == 0 {
+		return c.Status(fiber.StatusOK).JSON(matrix)
+	}
+
+	//Save to database - every sku, then every attribute row
+	_, _, err = supabaseClient.From("skus").Insert(skus, false, "", "", "").Execute()
+	if isDuplicateSKUCode(err) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "SKU codes were taken by another request - please try again",
+		})
+	}
+	if err != nil {
+		fmt.Println(err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save SKUs to database",
+		})
+	}
+	skuIDs := make([]string, 0, len(skus))
+	codes := make([]string, 0, len(skus))
+	for _, sku := range skus {
+		skuIDs = append(skuIDs, sku.ID.String())
+		codes = append(codes, sku.SKU)
+	}
+
+	//A concurrent request may have saved some of the same codes in the meantime - if so these variants give way
+	duplicates, err := generator.duplicates(supabaseClient, codes)
+	if err != nil {
+		fmt.Println(err)
+		supabaseClient.From("skus").Delete("", "").In("id", skuIDs).Execute()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot fetch SKU codes from database",
+		})
+	}
+	if len(duplicates) > 0 {
+		supabaseClient.From("skus").Delete("", "").In("id", skuIDs).Execute()
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "SKU codes were taken by another request - please try again",
+			"codes": duplicates,
+		})
+	}
+
+	_, _, err = supabaseClient.From("sku_attributes").Insert(skuAttributes, false, "", "", "").Execute()
+	if err != nil {
+		fmt.Println(err)
+		//Don't leave variants without their attributes behind
+		supabaseClient.From("skus").Delete("", "").In("id", skuIDs).Execute()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save SKU attributes to database",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(matrix)
+}
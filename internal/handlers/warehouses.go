@@ -222,8 +222,33 @@ func GetWarehouse(c *fiber.Ctx) error {
 		})
 	}
 
+	if len(respStruct) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Warehouse not found",
+		})
+	}
+
 	resp := convertWarehouseForJSON(&respStruct[0])
 
+	//Optionally include the bin tree, with stock totals per node
+	if c.Query("include") == "bins" {
+		bins, err := fetchWarehouseBins(supabaseClient, warehouseID)
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch bins from database",
+			})
+		}
+		stock, err := fetchBinInventory(supabaseClient, "warehouse_id", warehouseID)
+		if err != nil {
+			fmt.Println(err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot fetch bin inventory from database",
+			})
+		}
+		resp.Bins = buildBinTree(bins, stock)
+	}
+
 	return c.Status(fiber.StatusOK).JSON(resp)
 }
 
@@ -0,0 +1,23 @@
+package jobs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/handlers"
+)
+
+// Recomputes demand forecasts from the shipments up to the end of each day. Runs hourly - a period
+// already forecast is skipped, so each is computed once a night.
+func computeForecasts(supabaseClient *supabase.Client) {
+	periodEnd := lastPeriodEnd(time.Now())
+	count, err := handlers.ComputeForecasts(supabaseClient, periodEnd)
+	if err != nil {
+		fmt.Println("Demand forecast failed:", err)
+		return
+	}
+	if count > 0 {
+		fmt.Printf("Computed %d demand forecasts for %s\n", count, periodEnd.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,35 @@
+package jobs
+
+import (
+	"fmt"
+	"time"
+
+	"ucrs.com/inventory-manager/backend/internal/database"
+)
+
+// Starts the background jobs. They run with the service client, as they work across every company.
+// If no service key is configured the jobs are not started.
+func Start() {
+	supabaseClient, err := database.CreateServiceClient()
+	if err != nil {
+		fmt.Println("Background jobs not started:", err)
+		return
+	}
+
+	go every(time.Hour, func() { takeSnapshots(supabaseClient) })
+	go every(time.Hour, func() { computeForecasts(supabaseClient) })
+}
+
+// Runs fn now, then again after every interval
+func every(interval time.Duration, fn func()) {
+	fn()
+	ticker := time.NewTicker(interval)
+	for range ticker.C {
+		fn()
+	}
+}
+
+// Start of the current UTC day - the end of the last full day
+func lastPeriodEnd(now time.Time) time.Time {
+	return now.UTC().Truncate(24 * time.Hour)
+}
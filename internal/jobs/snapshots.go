@@ -0,0 +1,23 @@
+package jobs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/supabase-community/supabase-go"
+	"ucrs.com/inventory-manager/backend/internal/handlers"
+)
+
+// Materializes inventory snapshots at the end of each day, so historical (?as_of=) queries only
+// replay the movements of a single day. Runs hourly - a period already snapshotted is skipped.
+func takeSnapshots(supabaseClient *supabase.Client) {
+	periodEnd := lastPeriodEnd(time.Now())
+	count, err := handlers.MaterializeSnapshots(supabaseClient, periodEnd)
+	if err != nil {
+		fmt.Println("Inventory snapshot failed:", err)
+		return
+	}
+	if count > 0 {
+		fmt.Printf("Took %d inventory snapshots for %s\n", count, periodEnd.Format(time.RFC3339))
+	}
+}
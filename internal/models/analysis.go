@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ABC classes rank skus by their share of consumption value - A skus make up the first 80% of it,
+// B the next 15% and C the rest
+const (
+	ClassA = "A"
+	ClassB = "B"
+	ClassC = "C"
+)
+
+// XYZ classes rank skus by how much their weekly demand varies - X is steady, Y fluctuates and Z is
+// erratic or has no demand at all
+const (
+	ClassX = "X"
+	ClassY = "Y"
+	ClassZ = "Z"
+)
+
+// Stock that hasn't moved out of a warehouse in a while
+const (
+	StockStatusSlowMoving = "slow_moving"
+	StockStatusDead       = "dead"
+)
+
+// SKUClassification is where a sku falls in the ABC and XYZ classes over the analysis period
+type SKUClassification struct {
+	SkuID                  uuid.UUID  `json:"sku_id"`
+	SKU                    string     `json:"sku"`
+	ProductID              uuid.UUID  `json:"product_id"`
+	CategoryID             *uuid.UUID `json:"category_id,omitempty"`
+	QuantityConsumed       int        `json:"quantity_consumed"`
+	ConsumptionValue       float64    `json:"consumption_value"`        //Quantity consumed at standard cost, or price where there is none
+	CumulativeShare        float64    `json:"cumulative_share"`         //Percentage of all consumption value up to and including this sku
+	CoefficientOfVariation *float64   `json:"coefficient_of_variation"` //Of weekly demand - not set without demand
+	ABC                    string     `json:"abc"`
+	XYZ                    string     `json:"xyz"`
+	Class                  string     `json:"class"` //e.g. AX
+}
+
+type ClassificationReport struct {
+	PeriodDays  int                 `json:"period_days"`
+	From        time.Time           `json:"from"`
+	To          time.Time           `json:"to"`
+	Classes     map[string]int      `json:"classes"` //Number of skus in each combined class
+	SKUs        []SKUClassification `json:"skus"`
+	GeneratedAt time.Time           `json:"generated_at"`
+}
+
+// DeadStockLine is stock of a sku at a warehouse that hasn't been issued or received in the report's window
+type DeadStockLine struct {
+	SkuID             uuid.UUID  `json:"sku_id"`
+	SKU               string     `json:"sku"`
+	LocationID        uuid.UUID  `json:"location_id"`
+	WarehouseName     string     `json:"warehouse_name"`
+	Quantity          int        `json:"quantity"`
+	Value             float64    `json:"value"`                   //At standard cost, or price where there is none
+	LastMovedAt       *time.Time `json:"last_moved_at,omitempty"` //Not set when it hasn't moved in the whole window
+	DaysSinceMovement *int       `json:"days_since_movement,omitempty"`
+	Status            string     `json:"status"`
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ASN states - expected -> receiving -> closed, or cancelled before anything is received
+const (
+	ASNStatusExpected  = "expected"
+	ASNStatusReceiving = "receiving"
+	ASNStatusClosed    = "closed"
+	ASNStatusCancelled = "cancelled"
+)
+
+// ASN is an advance shipping notice - a delivery expected at a warehouse, received against line by line
+type ASN struct {
+	ID                    uuid.UUID  `json:"id"`
+	UserID                uuid.UUID  `json:"user_id"`
+	WarehouseID           uuid.UUID  `json:"warehouse_id"`
+	SupplierID            *uuid.UUID `json:"supplier_id,omitempty"`
+	PurchaseOrderID       *uuid.UUID `json:"purchase_order_id,omitempty"` //Receipts are booked against the order when the ASN is closed
+	Status                string     `json:"status"`
+	Reference             string     `json:"reference,omitempty"`     //Supplier's delivery note or tracking number
+	OverTolerancePercent  float64    `json:"over_tolerance_percent"`  //How far over the expected quantity a line may be received
+	UnderTolerancePercent float64    `json:"under_tolerance_percent"` //How far short a line may be when the ASN is closed
+	Notes                 string     `json:"notes,omitempty"`
+	Lines                 []ASNLine  `json:"lines,omitempty"`
+	ExpectedAt            *time.Time `json:"expected_at,omitempty"`
+	ClosedAt              *time.Time `json:"closed_at,omitempty"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+}
+
+// ASNDatabase is the asns table row - lines are stored separately in asn_lines
+type ASNDatabase struct {
+	ID                    uuid.UUID  `json:"id"`
+	UserID                uuid.UUID  `json:"user_id"`
+	WarehouseID           uuid.UUID  `json:"warehouse_id"`
+	SupplierID            *uuid.UUID `json:"supplier_id,omitempty"`
+	PurchaseOrderID       *uuid.UUID `json:"purchase_order_id,omitempty"`
+	Status                string     `json:"status"`
+	Reference             string     `json:"reference,omitempty"`
+	OverTolerancePercent  float64    `json:"over_tolerance_percent"`
+	UnderTolerancePercent float64    `json:"under_tolerance_percent"`
+	Notes                 string     `json:"notes,omitempty"`
+	ExpectedAt            *time.Time `json:"expected_at,omitempty"`
+	ClosedAt              *time.Time `json:"closed_at,omitempty"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+}
+
+type ASNLine struct {
+	ID               uuid.UUID `json:"id"`
+	ASNID            uuid.UUID `json:"asn_id"`
+	SkuID            uuid.UUID `json:"sku_id"`
+	UserID           uuid.UUID `json:"user_id"`
+	QuantityExpected int       `json:"quantity_expected"`
+	QuantityReceived int       `json:"quantity_received"`
+	UnitCost         *float64  `json:"unit_cost,omitempty"` //Taken from the purchase order line when there is one
+	Unit             string    `json:"unit,omitempty"`      //Unit the quantity was given in - converted to the base unit before saving
+}
+
+// ASNDiscrepancy is the difference between what was expected and what was received for an ASN line
+type ASNDiscrepancy struct {
+	SkuID            uuid.UUID `json:"sku_id"`
+	QuantityExpected int       `json:"quantity_expected"`
+	QuantityReceived int       `json:"quantity_received"`
+	Difference       int       `json:"difference"`
+	WithinTolerance  bool      `json:"within_tolerance"`
+}
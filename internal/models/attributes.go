@@ -1,14 +1,176 @@
 package models
 
 import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// Types an attribute's values can take - values given for a sku must conform to the type
+const (
+	AttributeTypeText    = "text" //Optionally matching Pattern
+	AttributeTypeEnum    = "enum" //One of AllowedValues
+	AttributeTypeInteger = "integer"
+	AttributeTypeDecimal = "decimal" //Optionally with a Unit, e.g. 12.5 cm
+	AttributeTypeBoolean = "boolean"
+	AttributeTypeDate    = "date" //YYYY-MM-DD
+)
+
 type Attribute struct {
-	ID        uuid.UUID `json:"id"`
-	Name      string    `json:"name"`
-	UserID    uuid.UUID `json:"user_id,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
+	ID            uuid.UUID `json:"id"`
+	Name          string    `json:"name"`
+	UserID        uuid.UUID `json:"user_id,omitempty"`
+	Type          string    `json:"type,omitempty"`           //Defaults to text
+	AllowedValues []string  `json:"allowed_values,omitempty"` //Required for enums, optional for other types
+	Unit          string    `json:"unit,omitempty"`           //Decimals only
+	Pattern       string    `json:"pattern,omitempty"`        //Regular expression text values must match
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func IsValidAttributeType(attributeType string) bool {
+	switch attributeType {
+	case AttributeTypeText, AttributeTypeEnum, AttributeTypeInteger, AttributeTypeDecimal, AttributeTypeBoolean, AttributeTypeDate:
+		return true
+	}
+	return false
+}
+
+// Validate checks the attribute's definition, returning an error message per invalid field - empty
+// when it is valid. An empty type is set to text.
+func (a *Attribute) Validate() map[string]string {
+	errors := map[string]string{}
+	if a.Name == "" {
+		errors["name"] = "Attribute name is required"
+	}
+	if a.Type == "" {
+		a.Type = AttributeTypeText
+	}
+	if !IsValidAttributeType(a.Type) {
+		errors["type"] = "Type must be one of text, enum, integer, decimal, boolean or date"
+		return errors
+	}
+	if a.Type == AttributeTypeEnum && len(a.AllowedValues) == 0 {
+		errors["allowed_values"] = "Enum attributes need a list of allowed values"
+	}
+	if a.Unit != "" && a.Type != AttributeTypeDecimal {
+		errors["unit"] = "Only decimal attributes can have a unit"
+	}
+	if a.Pattern != "" {
+		if a.Type != AttributeTypeText {
+			errors["pattern"] = "Only text attributes can have a pattern"
+		} else if _, err := regexp.Compile(a.Pattern); err != nil {
+			errors["pattern"] = "Pattern is not a valid regular expression: " + err.Error()
+		}
+	}
+	if _, ok := errors["allowed_values"]; !ok {
+		for i, value := range a.AllowedValues {
+			if strings.TrimSpace(value) == "" {
+				errors["allowed_values"] = "Allowed values cannot be blank"
+				break
+			}
+			if slices.Contains(a.AllowedValues[:i], value) {
+				errors["allowed_values"] = fmt.Sprintf("%q is listed more than once", value)
+				break
+			}
+			//Each allowed value must itself be a valid value of the type
+			if a.Type != AttributeTypeEnum {
+				if _, err := a.conformToType(value); err != nil {
+					errors["allowed_values"] = fmt.Sprintf("Allowed value %q is invalid: %s", value, err.Error())
+					break
+				}
+			}
+		}
+	}
+	return errors
+}
+
+// Normalizes a value to the attribute's type, or explains why it doesn't conform
+func (a *Attribute) conformToType(value string) (string, error) {
+	switch a.Type {
+	case AttributeTypeEnum:
+		//Matched regardless of case, and stored as the allowed value is written
+		for _, allowed := range a.AllowedValues {
+			if strings.EqualFold(allowed, value) {
+				return allowed, nil
+			}
+		}
+		return "", fmt.Errorf("must be one of %s", strings.Join(a.AllowedValues, ", "))
+	case AttributeTypeInteger:
+		integer, err := strconv.Atoi(value)
+		if err != nil {
+			return "", fmt.Errorf("must be a whole number")
+		}
+		return strconv.Itoa(integer), nil
+	case AttributeTypeDecimal:
+		number := value
+		if a.Unit != "" {
+			//The unit may be given, but must be the attribute's
+			if fields := strings.Fields(value); len(fields) == 2 {
+				if !strings.EqualFold(fields[1], a.Unit) {
+					return "", fmt.Errorf("must be in %s", a.Unit)
+				}
+				number = fields[0]
+			} else {
+				number = strings.TrimSuffix(value, a.Unit)
+			}
+		}
+		decimal, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+		if err != nil {
+			if a.Unit != "" {
+				return "", fmt.Errorf("must be a number of %s, e.g. 12.5 %s", a.Unit, a.Unit)
+			}
+			return "", fmt.Errorf("must be a number")
+		}
+		return strconv.FormatFloat(decimal, 'f', -1, 64), nil
+	case AttributeTypeBoolean:
+		switch strings.ToLower(value) {
+		case "true", "yes", "y", "1":
+			return "true", nil
+		case "false", "no", "n", "0":
+			return "false", nil
+		}
+		return "", fmt.Errorf("must be true or false")
+	case AttributeTypeDate:
+		date, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			return "", fmt.Errorf("must be a date as YYYY-MM-DD")
+		}
+		return date.Format(time.DateOnly), nil
+	}
+
+	if a.Pattern != "" {
+		pattern, err := regexp.Compile(a.Pattern)
+		if err != nil || !pattern.MatchString(value) {
+			return "", fmt.Errorf("must match the pattern %s", a.Pattern)
+		}
+	}
+	return value, nil
+}
+
+// ConformValue checks a sku's value for the attribute against its type and allowed values, returning
+// it normalized - e.g. an enum value in the case it was listed in, or a decimal without its unit.
+// The error names the attribute and says what is expected.
+func (a *Attribute) ConformValue(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", fmt.Errorf("%s is required", a.Name)
+	}
+	normalized, err := a.conformToType(value)
+	if err != nil {
+		return "", fmt.Errorf("%s %s", a.Name, err.Error())
+	}
+	if a.Type != AttributeTypeEnum && len(a.AllowedValues) > 0 {
+		for _, allowed := range a.AllowedValues {
+			if conformed, err := a.conformToType(allowed); err == nil && conformed == normalized {
+				return normalized, nil
+			}
+		}
+		return "", fmt.Errorf("%s must be one of %s", a.Name, strings.Join(a.AllowedValues, ", "))
+	}
+	return normalized, nil
 }
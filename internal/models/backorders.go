@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	BackorderStatusOpen      = "open"
+	BackorderStatusFilled    = "filled"
+	BackorderStatusCancelled = "cancelled"
+)
+
+// Backorder is demand for a sku at a location that stock couldn't cover when it was requested.
+// Open backorders are filled oldest first as stock arrives, by reserving it for them.
+type Backorder struct {
+	ID             uuid.UUID  `json:"id"`
+	SkuID          uuid.UUID  `json:"sku_id"`
+	LocationID     uuid.UUID  `json:"location_id"`
+	UserID         uuid.UUID  `json:"user_id"`
+	Reference      string     `json:"reference,omitempty"` //e.g. the storefront order the demand came from
+	Quantity       int        `json:"quantity"`
+	QuantityFilled int        `json:"quantity_filled"`
+	Status         string     `json:"status"`
+	FilledAt       *time.Time `json:"filled_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// BackorderSummary is the outstanding backorders of one sku, with how long they've been waiting
+type BackorderSummary struct {
+	SkuID               uuid.UUID `json:"sku_id"`
+	Backorders          int       `json:"backorders"`
+	QuantityOutstanding int       `json:"quantity_outstanding"`
+	OldestCreatedAt     time.Time `json:"oldest_created_at"`
+	OldestAgeDays       int       `json:"oldest_age_days"`
+	AverageAgeDays      float64   `json:"average_age_days"`
+}
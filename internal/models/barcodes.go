@@ -7,11 +7,12 @@ import (
 )
 
 type Barcode struct {
-	ID           uuid.UUID `json:"id"`
-	UserID       uuid.UUID `json:"user_id"`
-	SkuID        uuid.UUID `json:"sku_id"`
-	BarcodeName  string    `json:"barcode_name"`
-	BarcodeValue string    `json:"barcode_value"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           uuid.UUID  `json:"id"`
+	UserID       uuid.UUID  `json:"user_id"`
+	SkuID        uuid.UUID  `json:"sku_id"`
+	BarcodeName  string     `json:"barcode_name"`
+	BarcodeValue string     `json:"barcode_value"`
+	UnitID       *uuid.UUID `json:"unit_id,omitempty"` //Pack level the barcode is printed on - nil for a single base unit
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
 }
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Bin levels - a warehouse is split into aisles, racks, shelves and bins
+const (
+	BinTypeAisle = "aisle"
+	BinTypeRack  = "rack"
+	BinTypeShelf = "shelf"
+	BinTypeBin   = "bin"
+)
+
+func IsValidBinType(binType string) bool {
+	switch binType {
+	case BinTypeAisle, BinTypeRack, BinTypeShelf, BinTypeBin:
+		return true
+	}
+	return false
+}
+
+type Bin struct {
+	ID          uuid.UUID  `json:"id"`
+	WarehouseID uuid.UUID  `json:"warehouse_id"`
+	ParentID    *uuid.UUID `json:"parent_id,omitempty"` //Null for top level locations in the warehouse
+	UserID      uuid.UUID  `json:"user_id"`
+	Name        string     `json:"name"`
+	Type        string     `json:"type"`
+	Code        string     `json:"code,omitempty"` //e.g. the label printed on the shelf
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// BinInventory is the quantity of a sku held in a bin - it is a breakdown of the warehouse's
+// inventory, so bin stock never exceeds the warehouse quantity. Stock issued without naming a bin
+// comes out of unbinned stock first, then out of the bins.
+type BinInventory struct {
+	BinID       uuid.UUID `json:"bin_id"`
+	SkuID       uuid.UUID `json:"sku_id"`
+	WarehouseID uuid.UUID `json:"warehouse_id"`
+	UserID      uuid.UUID `json:"user_id"`
+	Quantity    int       `json:"quantity"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// BinMovement records stock put away into, moved between or picked from bins
+type BinMovement struct {
+	ID          uuid.UUID  `json:"id"`
+	SkuID       uuid.UUID  `json:"sku_id"`
+	WarehouseID uuid.UUID  `json:"warehouse_id"`
+	FromBinID   *uuid.UUID `json:"from_bin_id,omitempty"` //Null for putaway
+	ToBinID     *uuid.UUID `json:"to_bin_id,omitempty"`   //Null for picks
+	Quantity    int        `json:"quantity"`
+	UserID      uuid.UUID  `json:"user_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// BinNode is a bin in the warehouse tree with its stock - TotalQuantity includes all bins below it
+type BinNode struct {
+	Bin
+	Quantity      int        `json:"quantity"`
+	TotalQuantity int        `json:"total_quantity"`
+	Children      []*BinNode `json:"children"`
+}
@@ -5,8 +5,42 @@ import (
 )
 
 type Category struct {
-	ID       uuid.UUID `json:"id"`
-	UserID   uuid.UUID `json:"user_id"`
-	Name     string    `json:"name"`
-	ParentID uuid.UUID `json:"parent_id,omitempty"`
+	ID       uuid.UUID  `json:"id"`
+	UserID   uuid.UUID  `json:"user_id"`
+	Name     string     `json:"name"`
+	ParentID *uuid.UUID `json:"parent_id"` //Null for top level categories
+}
+
+// ProductCategory assigns a product to a secondary category - its primary category is the product's CategoryID
+type ProductCategory struct {
+	ProductID  uuid.UUID `json:"product_id"`
+	CategoryID uuid.UUID `json:"category_id"`
+	UserID     uuid.UUID `json:"user_id"`
+}
+
+// ProductCategories are all the categories a product is in
+type ProductCategories struct {
+	PrimaryCategoryID    *uuid.UUID  `json:"primary_category_id"`
+	SecondaryCategoryIDs []uuid.UUID `json:"secondary_category_ids"`
+}
+
+// What DeleteCategory does with a category's children and products
+const (
+	CategoryDeleteRestrict = "restrict" //Refuse while it has children or products
+	CategoryDeleteReparent = "reparent" //Move children and products up to its parent
+	CategoryDeleteCascade  = "cascade"  //Delete its whole subtree, leaving the products uncategorised there
+)
+
+func IsValidCategoryDeletePolicy(policy string) bool {
+	switch policy {
+	case CategoryDeleteRestrict, CategoryDeleteReparent, CategoryDeleteCascade:
+		return true
+	}
+	return false
+}
+
+// CategoryNode is a category in the category tree with everything below it
+type CategoryNode struct {
+	Category
+	Children []*CategoryNode `json:"children"`
 }
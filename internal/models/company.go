@@ -7,10 +7,12 @@ import (
 )
 
 type Company struct {
-	ID        uuid.UUID `json:"id"`
-	Name      string    `json:"name"`
-	Industry  string    `json:"industry"`
-	Owner     uuid.UUID `json:"owner"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID            uuid.UUID `json:"id"`
+	Name          string    `json:"name"`
+	Industry      string    `json:"industry"`
+	Owner         uuid.UUID `json:"owner"`
+	CostingMethod string    `json:"costing_method,omitempty"` //fifo, average or standard - defaults to fifo
+	SKUTemplate   string    `json:"sku_template"`             //Generates codes for skus created without one, e.g. {CATEGORY:3}-{PRODUCT:4}-{SEQ:4}
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
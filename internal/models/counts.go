@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	CountStatusOpen      = "open"
+	CountStatusPosted    = "posted"
+	CountStatusCancelled = "cancelled"
+)
+
+// CountSession is a physical count of a warehouse, or of some of its SKUs/bins
+type CountSession struct {
+	ID          uuid.UUID   `json:"id"`
+	WarehouseID uuid.UUID   `json:"warehouse_id"`
+	UserID      uuid.UUID   `json:"user_id"`
+	Status      string      `json:"status"`
+	SkuIDs      []uuid.UUID `json:"sku_ids,omitempty"` //Empty counts every SKU
+	BinIDs      []uuid.UUID `json:"bin_ids,omitempty"` //Empty counts at warehouse level
+	Notes       string      `json:"notes,omitempty"`
+	PostedAt    *time.Time  `json:"posted_at,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+// CountLine holds the system quantity of a sku (in a bin, for bin counts) when the session was
+// opened. Counted and variance are worked out from the session's entries when read.
+type CountLine struct {
+	ID             uuid.UUID  `json:"id"`
+	SessionID      uuid.UUID  `json:"session_id"`
+	SkuID          uuid.UUID  `json:"sku_id"`
+	BinID          *uuid.UUID `json:"bin_id,omitempty"`
+	UserID         uuid.UUID  `json:"user_id"`
+	SystemQuantity int        `json:"system_quantity"`
+	Posted         bool       `json:"posted"`
+	Counted        *int       `json:"counted,omitempty"`  //Null until something has been counted
+	Variance       *int       `json:"variance,omitempty"` //Counted less system quantity
+}
+
+// CountEntry is a quantity counted by one user - a line's count is the sum of its entries,
+// so several scanners can count the same sku in different places
+type CountEntry struct {
+	ID        uuid.UUID  `json:"id"`
+	SessionID uuid.UUID  `json:"session_id"`
+	SkuID     uuid.UUID  `json:"sku_id"`
+	BinID     *uuid.UUID `json:"bin_id,omitempty"`
+	UserID    uuid.UUID  `json:"user_id"`
+	Quantity  int        `json:"quantity"`
+	Unit      string     `json:"unit,omitempty"` //Unit the quantity was given in - converted to the base unit before saving
+	CreatedAt time.Time  `json:"created_at"`
+}
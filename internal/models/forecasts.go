@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Models a forecast can be made with - whichever fitted the history better is used
+const (
+	ForecastMethodMovingAverage        = "moving_average"
+	ForecastMethodExponentialSmoothing = "exponential_smoothing" //Holt-Winters with a weekly season
+)
+
+// ForecastPoint is the expected demand on one day, with its 95% confidence interval
+type ForecastPoint struct {
+	Date     time.Time `json:"date"`
+	Quantity float64   `json:"quantity"`
+	Lower    float64   `json:"lower"`
+	Upper    float64   `json:"upper"`
+}
+
+// Forecast is the expected daily demand for a sku at a location, computed from its shipment history,
+// with reorder levels suggested from it. The errors of both models are kept so the choice can be explained.
+type Forecast struct {
+	SkuID                     uuid.UUID       `json:"sku_id"`
+	LocationID                uuid.UUID       `json:"location_id"`
+	UserID                    uuid.UUID       `json:"user_id"`
+	Method                    string          `json:"method"`
+	HistoryDays               int             `json:"history_days"`
+	MovingAverageError        float64         `json:"moving_average_error"`                  //Mean absolute one-step error
+	ExponentialSmoothingError *float64        `json:"exponential_smoothing_error,omitempty"` //Not set with under two weeks of history
+	AverageDailyDemand        float64         `json:"average_daily_demand"`                  //Over the forecast horizon
+	Daily                     []ForecastPoint `json:"daily"`
+	LeadTimeDays              int             `json:"lead_time_days"`
+	SafetyStock               int             `json:"safety_stock"`
+	SuggestedMinimumLevel     int             `json:"suggested_minimum_level"`
+	SuggestedReorderPoint     int             `json:"suggested_reorder_point"`
+	SuggestedMaximumLevel     int             `json:"suggested_maximum_level"`
+	PeriodEnd                 time.Time       `json:"period_end"` //Demand up to here was used
+	ComputedAt                time.Time       `json:"computed_at"`
+}
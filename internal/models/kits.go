@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BOMComponent is one line of a kit's bill of materials - Quantity units of the component
+// make up one unit of the kit
+type BOMComponent struct {
+	ID             uuid.UUID `json:"id"`
+	KitSkuID       uuid.UUID `json:"kit_sku_id"`
+	ComponentSkuID uuid.UUID `json:"component_sku_id"`
+	UserID         uuid.UUID `json:"user_id"`
+	Quantity       int       `json:"quantity"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// ComponentAvailability is the stock of one component at a location, and how many kits it could make
+type ComponentAvailability struct {
+	SkuID     uuid.UUID `json:"sku_id"`
+	Quantity  int       `json:"quantity"` //Per kit
+	Available int       `json:"available"`
+	Buildable int       `json:"buildable"`
+}
+
+// KitAvailability is the stock of a kit at a location - assembled kits on hand, plus those that
+// could be assembled from the components available
+type KitAvailability struct {
+	SkuID      uuid.UUID               `json:"sku_id"`
+	LocationID uuid.UUID               `json:"location_id"`
+	Assembled  int                     `json:"assembled"`
+	Buildable  int                     `json:"buildable"`
+	Available  int                     `json:"available"` //Assembled plus buildable
+	Components []ComponentAvailability `json:"components"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Lot struct {
+	ID             uuid.UUID  `json:"id"`
+	SkuID          uuid.UUID  `json:"sku_id"`
+	LocationID     uuid.UUID  `json:"location_id"`
+	UserID         uuid.UUID  `json:"user_id"`
+	LotNumber      string     `json:"lot_number"`
+	ManufacturedAt *time.Time `json:"manufactured_at,omitempty"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	Quantity       int        `json:"quantity"` //Derived from the stock movements recorded against the lot
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// LotAllocation is the quantity to take from one lot when picking stock
+type LotAllocation struct {
+	LotNumber string     `json:"lot_number"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Quantity  int        `json:"quantity"`
+}
@@ -7,11 +7,12 @@ import (
 )
 
 type Product struct {
-	ID          uuid.UUID `json:"id,omitempty"`
-	UserID      uuid.UUID `json:"user_id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description,omitempty"`
-	Price       float64   `json:"price"`
-	CreatedAt   time.Time `json:"created_at,omitempty"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          uuid.UUID  `json:"id,omitempty"`
+	UserID      uuid.UUID  `json:"user_id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Price       float64    `json:"price"`
+	CategoryID  *uuid.UUID `json:"category_id,omitempty"` //Primary category - secondary ones are in product_categories
+	CreatedAt   time.Time  `json:"created_at,omitempty"`
+	UpdatedAt   time.Time  `json:"updated_at"`
 }
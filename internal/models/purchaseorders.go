@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Purchase order states - draft -> sent -> partially_received -> closed, or cancelled before anything arrives
+const (
+	PurchaseOrderStatusDraft             = "draft"
+	PurchaseOrderStatusSent              = "sent"
+	PurchaseOrderStatusPartiallyReceived = "partially_received"
+	PurchaseOrderStatusClosed            = "closed"
+	PurchaseOrderStatusCancelled         = "cancelled"
+)
+
+type PurchaseOrder struct {
+	ID          uuid.UUID           `json:"id"`
+	UserID      uuid.UUID           `json:"user_id"`
+	SupplierID  uuid.UUID           `json:"supplier_id"`
+	WarehouseID uuid.UUID           `json:"warehouse_id"` //Where the stock is delivered to
+	Status      string              `json:"status"`
+	Reference   string              `json:"reference,omitempty"` //PO number
+	Currency    string              `json:"currency"`
+	Notes       string              `json:"notes,omitempty"`
+	Lines       []PurchaseOrderLine `json:"lines,omitempty"`
+	ExpectedAt  *time.Time          `json:"expected_at,omitempty"`
+	SentAt      *time.Time          `json:"sent_at,omitempty"`
+	ClosedAt    *time.Time          `json:"closed_at,omitempty"`
+	CreatedAt   time.Time           `json:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+}
+
+// PurchaseOrderDatabase is the purchase_orders table row - lines are stored separately in purchase_order_lines
+type PurchaseOrderDatabase struct {
+	ID          uuid.UUID  `json:"id"`
+	UserID      uuid.UUID  `json:"user_id"`
+	SupplierID  uuid.UUID  `json:"supplier_id"`
+	WarehouseID uuid.UUID  `json:"warehouse_id"`
+	Status      string     `json:"status"`
+	Reference   string     `json:"reference,omitempty"`
+	Currency    string     `json:"currency"`
+	Notes       string     `json:"notes,omitempty"`
+	ExpectedAt  *time.Time `json:"expected_at,omitempty"`
+	SentAt      *time.Time `json:"sent_at,omitempty"`
+	ClosedAt    *time.Time `json:"closed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+type PurchaseOrderLine struct {
+	ID               uuid.UUID `json:"id"`
+	PurchaseOrderID  uuid.UUID `json:"purchase_order_id"`
+	SkuID            uuid.UUID `json:"sku_id"`
+	UserID           uuid.UUID `json:"user_id"`
+	Quantity         int       `json:"quantity"`
+	QuantityReceived int       `json:"quantity_received"`
+	UnitCost         float64   `json:"unit_cost"`      //Per base unit - defaults to the supplier's price
+	Unit             string    `json:"unit,omitempty"` //Unit the quantity was given in - converted to the base unit before saving
+}
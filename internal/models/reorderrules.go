@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Alert types raised when a reorder rule is breached
+const (
+	AlertTypeBelowMinimum = "below_minimum"
+	AlertTypeReorderPoint = "reorder_point"
+	AlertTypeAboveMaximum = "above_maximum"
+)
+
+type ReorderRule struct {
+	SkuID        uuid.UUID `json:"sku_id"`
+	LocationID   uuid.UUID `json:"location_id"`
+	UserID       uuid.UUID `json:"user_id"`
+	MinimumLevel int       `json:"minimum_level"`
+	ReorderPoint int       `json:"reorder_point"`
+	MaximumLevel int       `json:"maximum_level,omitempty"` //0 means no maximum
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Evaluate returns the alert type the quantity breaches, or "" if it is within the rule
+func (r *ReorderRule) Evaluate(quantity int) string {
+	switch {
+	case quantity < r.MinimumLevel:
+		return AlertTypeBelowMinimum
+	case quantity <= r.ReorderPoint:
+		return AlertTypeReorderPoint
+	case r.MaximumLevel > 0 && quantity > r.MaximumLevel:
+		return AlertTypeAboveMaximum
+	}
+	return ""
+}
+
+type StockAlert struct {
+	ID         uuid.UUID  `json:"id"`
+	SkuID      uuid.UUID  `json:"sku_id"`
+	LocationID uuid.UUID  `json:"location_id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	Type       string     `json:"type"`
+	Quantity   int        `json:"quantity"`  //Quantity at the time the alert was raised
+	Threshold  int        `json:"threshold"` //The level that was breached
+	CreatedAt  time.Time  `json:"created_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
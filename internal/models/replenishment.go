@@ -0,0 +1,34 @@
+package models
+
+import "github.com/google/uuid"
+
+// How urgently a location needs stock - below its minimum level, or at or below its reorder point
+const (
+	UrgencyCritical = "critical"
+	UrgencyReorder  = "reorder"
+)
+
+// TransferSuggestion proposes moving surplus stock of a sku from one warehouse to another that needs it
+type TransferSuggestion struct {
+	SkuID                 uuid.UUID `json:"sku_id"`
+	SourceLocationID      uuid.UUID `json:"source_location_id"`
+	DestinationLocationID uuid.UUID `json:"destination_location_id"`
+	Quantity              int       `json:"quantity"`
+	DistanceKm            float64   `json:"distance_km"`
+	Urgency               string    `json:"urgency"`
+	SourceAvailable       int       `json:"source_available"`      //Available at the source before the transfer
+	DestinationAvailable  int       `json:"destination_available"` //Available at the destination before the transfer
+}
+
+// NetworkShortage flags a sku that surplus stock across all warehouses can't cover - it has to be bought in
+type NetworkShortage struct {
+	SkuID          uuid.UUID `json:"sku_id"`
+	QuantityNeeded int       `json:"quantity_needed"` //Total needed by understocked warehouses
+	Shortfall      int       `json:"shortfall"`       //What's left once every suggested transfer is made
+	Locations      int       `json:"locations"`       //Warehouses still short
+}
+
+type ReplenishmentSuggestions struct {
+	Transfers []TransferSuggestion `json:"transfers"`
+	Shortages []NetworkShortage    `json:"shortages"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ReservationStatusActive    = "active"
+	ReservationStatusReleased  = "released"
+	ReservationStatusExpired   = "expired"
+	ReservationStatusFulfilled = "fulfilled"
+)
+
+type Reservation struct {
+	ID         uuid.UUID  `json:"id"`
+	SkuID      uuid.UUID  `json:"sku_id"`
+	LocationID uuid.UUID  `json:"location_id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	Quantity   int        `json:"quantity"`
+	Unit       string     `json:"unit,omitempty"`      //Unit the quantity was given in - converted to the base unit before saving
+	Reference  string     `json:"reference,omitempty"` //e.g. the order number the stock is promised to
+	Status     string     `json:"status"`
+	ExpiresAt  *time.Time `json:"expires_at"` //Nil for stock held until it is fulfilled or released
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	//FEFO pick suggestion made when the stock was reserved - lots are re-allocated at shipment,
+	//as stock may have moved in the meantime
+	Lots []LotAllocation `json:"lots,omitempty"`
+}
+
+// InventoryLevel is an inventory row with its reservations applied - Quantity is the on-hand quantity
+type InventoryLevel struct {
+	Inventory
+	Reserved  int `json:"reserved"`
+	Available int `json:"available"`
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Return states - authorized -> received -> closed once every item received has been inspected,
+// or cancelled before anything arrives
+const (
+	ReturnStatusAuthorized = "authorized"
+	ReturnStatusReceived   = "received"
+	ReturnStatusClosed     = "closed"
+	ReturnStatusCancelled  = "cancelled"
+)
+
+// What happens to returned items once inspected - only restocked items go back into inventory
+const (
+	DispositionRestock    = "restock"
+	DispositionQuarantine = "quarantine"
+	DispositionScrap      = "scrap"
+)
+
+func IsValidDisposition(disposition string) bool {
+	switch disposition {
+	case DispositionRestock, DispositionQuarantine, DispositionScrap:
+		return true
+	}
+	return false
+}
+
+// Return is a customer return (RMA) of items from one of their orders
+type Return struct {
+	ID             uuid.UUID    `json:"id"`
+	UserID         uuid.UUID    `json:"user_id"`
+	CustomerID     uuid.UUID    `json:"customer_id"`
+	OrderReference string       `json:"order_reference"`        //External order number the items were sold on
+	WarehouseID    *uuid.UUID   `json:"warehouse_id,omitempty"` //Where the items were received - set on receipt
+	Status         string       `json:"status"`
+	Reason         string       `json:"reason,omitempty"`
+	Notes          string       `json:"notes,omitempty"`
+	Lines          []ReturnLine `json:"lines,omitempty"`
+	ReceivedAt     *time.Time   `json:"received_at,omitempty"`
+	ClosedAt       *time.Time   `json:"closed_at,omitempty"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+}
+
+// ReturnDatabase is the returns table row - lines are stored separately in return_lines
+type ReturnDatabase struct {
+	ID             uuid.UUID  `json:"id"`
+	UserID         uuid.UUID  `json:"user_id"`
+	CustomerID     uuid.UUID  `json:"customer_id"`
+	OrderReference string     `json:"order_reference"`
+	WarehouseID    *uuid.UUID `json:"warehouse_id,omitempty"`
+	Status         string     `json:"status"`
+	Reason         string     `json:"reason,omitempty"`
+	Notes          string     `json:"notes,omitempty"`
+	ReceivedAt     *time.Time `json:"received_at,omitempty"`
+	ClosedAt       *time.Time `json:"closed_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+type ReturnLine struct {
+	ID                  uuid.UUID `json:"id"`
+	ReturnID            uuid.UUID `json:"return_id"`
+	SkuID               uuid.UUID `json:"sku_id"`
+	UserID              uuid.UUID `json:"user_id"`
+	QuantityAuthorized  int       `json:"quantity_authorized"`
+	QuantityReceived    int       `json:"quantity_received"`
+	QuantityRestocked   int       `json:"quantity_restocked"`
+	QuantityQuarantined int       `json:"quantity_quarantined"`
+	QuantityScrapped    int       `json:"quantity_scrapped"`
+	Unit                string    `json:"unit,omitempty"` //Unit the quantity was given in - converted to the base unit before saving
+}
+
+// QuarantineStock is returned stock held aside at a warehouse - it is not in inventory, so it can't
+// be sold, until it is released back to stock or scrapped
+type QuarantineStock struct {
+	ID          uuid.UUID  `json:"id"`
+	SkuID       uuid.UUID  `json:"sku_id"`
+	WarehouseID uuid.UUID  `json:"warehouse_id"`
+	ReturnID    *uuid.UUID `json:"return_id,omitempty"`
+	UserID      uuid.UUID  `json:"user_id"`
+	Quantity    int        `json:"quantity"`
+	Reason      string     `json:"reason,omitempty"`
+	Disposition string     `json:"disposition,omitempty"` //restock or scrap once released
+	ReleasedAt  *time.Time `json:"released_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Sales order states - draft -> allocated -> picking -> packed -> shipped, or cancelled before anything ships
+const (
+	SalesOrderStatusDraft     = "draft"
+	SalesOrderStatusAllocated = "allocated"
+	SalesOrderStatusPicking   = "picking"
+	SalesOrderStatusPacked    = "packed"
+	SalesOrderStatusShipped   = "shipped"
+	SalesOrderStatusCancelled = "cancelled"
+)
+
+// Shipment states - packed -> dispatched, or cancelled to unpack
+const (
+	ShipmentStatusPacked     = "packed"
+	ShipmentStatusDispatched = "dispatched"
+	ShipmentStatusCancelled  = "cancelled"
+)
+
+type SalesOrder struct {
+	ID              uuid.UUID        `json:"id"`
+	UserID          uuid.UUID        `json:"user_id"`
+	CustomerID      uuid.UUID        `json:"customer_id"`
+	Status          string           `json:"status"`
+	Reference       string           `json:"reference,omitempty"` //Customer's order number
+	ShippingAddress string           `json:"shipping_address,omitempty"`
+	Notes           string           `json:"notes,omitempty"`
+	Lines           []SalesOrderLine `json:"lines,omitempty"`
+	ShippedAt       *time.Time       `json:"shipped_at,omitempty"`
+	CreatedAt       time.Time        `json:"created_at"`
+	UpdatedAt       time.Time        `json:"updated_at"`
+}
+
+// SalesOrderDatabase is the sales_orders table row - lines are stored separately in sales_order_lines
+type SalesOrderDatabase struct {
+	ID              uuid.UUID  `json:"id"`
+	UserID          uuid.UUID  `json:"user_id"`
+	CustomerID      uuid.UUID  `json:"customer_id"`
+	Status          string     `json:"status"`
+	Reference       string     `json:"reference,omitempty"`
+	ShippingAddress string     `json:"shipping_address,omitempty"`
+	Notes           string     `json:"notes,omitempty"`
+	ShippedAt       *time.Time `json:"shipped_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// SalesOrderLine is a quantity of a sku to be shipped from a specific warehouse. Allocated stock is
+// held as reservations against the order until it is dispatched.
+type SalesOrderLine struct {
+	ID                uuid.UUID `json:"id"`
+	SalesOrderID      uuid.UUID `json:"sales_order_id"`
+	SkuID             uuid.UUID `json:"sku_id"`
+	WarehouseID       uuid.UUID `json:"warehouse_id"`
+	UserID            uuid.UUID `json:"user_id"`
+	Quantity          int       `json:"quantity"`
+	QuantityAllocated int       `json:"quantity_allocated"` //Includes stock packed but not yet dispatched
+	QuantityPacked    int       `json:"quantity_packed"`    //Includes stock dispatched
+	QuantityShipped   int       `json:"quantity_shipped"`
+	UnitPrice         float64   `json:"unit_price"`
+	Unit              string    `json:"unit,omitempty"` //Unit the quantity was given in - converted to the base unit before saving
+}
+
+// SalesOrderEvent records a change to a sales order - every state change is kept for audit
+type SalesOrderEvent struct {
+	ID           uuid.UUID  `json:"id"`
+	SalesOrderID uuid.UUID  `json:"sales_order_id"`
+	ShipmentID   *uuid.UUID `json:"shipment_id,omitempty"`
+	UserID       uuid.UUID  `json:"user_id"`
+	Action       string     `json:"action"` //e.g. created, allocated, picking, packed, dispatched, cancelled
+	FromStatus   string     `json:"from_status,omitempty"`
+	ToStatus     string     `json:"to_status"`
+	Details      string     `json:"details,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// PickList is the stock to pick for an order from one warehouse
+type PickList struct {
+	SalesOrderID uuid.UUID      `json:"sales_order_id"`
+	WarehouseID  uuid.UUID      `json:"warehouse_id"`
+	Lines        []PickListLine `json:"lines"`
+}
+
+// PickListLine is one sku to pick, with suggested lots (FEFO) and the bins holding it
+type PickListLine struct {
+	SalesOrderLineID uuid.UUID       `json:"sales_order_line_id"`
+	SkuID            uuid.UUID       `json:"sku_id"`
+	Quantity         int             `json:"quantity"`
+	Lots             []LotAllocation `json:"lots,omitempty"`
+	Bins             []BinInventory  `json:"bins,omitempty"`
+}
+
+// AllocationShortage is the quantity of a line that could not be allocated from its warehouse
+type AllocationShortage struct {
+	SalesOrderLineID uuid.UUID `json:"sales_order_line_id"`
+	SkuID            uuid.UUID `json:"sku_id"`
+	WarehouseID      uuid.UUID `json:"warehouse_id"`
+	Shortage         int       `json:"shortage"`
+}
+
+type Shipment struct {
+	ID             uuid.UUID      `json:"id"`
+	SalesOrderID   uuid.UUID      `json:"sales_order_id"`
+	WarehouseID    uuid.UUID      `json:"warehouse_id"`
+	UserID         uuid.UUID      `json:"user_id"`
+	Status         string         `json:"status"`
+	Carrier        string         `json:"carrier,omitempty"`
+	TrackingNumber string         `json:"tracking_number,omitempty"`
+	Lines          []ShipmentLine `json:"lines,omitempty"`
+	DispatchedAt   *time.Time     `json:"dispatched_at,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+}
+
+// ShipmentDatabase is the shipments table row - lines are stored separately in shipment_lines
+type ShipmentDatabase struct {
+	ID             uuid.UUID  `json:"id"`
+	SalesOrderID   uuid.UUID  `json:"sales_order_id"`
+	WarehouseID    uuid.UUID  `json:"warehouse_id"`
+	UserID         uuid.UUID  `json:"user_id"`
+	Status         string     `json:"status"`
+	Carrier        string     `json:"carrier,omitempty"`
+	TrackingNumber string     `json:"tracking_number,omitempty"`
+	DispatchedAt   *time.Time `json:"dispatched_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+type ShipmentLine struct {
+	ID               uuid.UUID `json:"id"`
+	ShipmentID       uuid.UUID `json:"shipment_id"`
+	SalesOrderLineID uuid.UUID `json:"sales_order_line_id"`
+	SkuID            uuid.UUID `json:"sku_id"`
+	UserID           uuid.UUID `json:"user_id"`
+	Quantity         int       `json:"quantity"`
+	Unit             string    `json:"unit,omitempty"` //Unit the quantity was given in - converted to the base unit before saving
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SerialStatusInStock = "in_stock"
+	SerialStatusShipped = "shipped"
+)
+
+type SerialNumber struct {
+	ID           uuid.UUID  `json:"id"`
+	SkuID        uuid.UUID  `json:"sku_id"`
+	CompanyID    uuid.UUID  `json:"company_id"`
+	UserID       uuid.UUID  `json:"user_id"`
+	SerialNumber string     `json:"serial_number"`
+	LocationID   *uuid.UUID `json:"location_id"` //Warehouse currently holding the serial - null once shipped
+	Status       string     `json:"status"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
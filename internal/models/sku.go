@@ -7,11 +7,15 @@ import (
 )
 
 type SKU struct {
-	ID        uuid.UUID `json:"id"`
-	UserID    uuid.UUID `json:"user_id"`
-	ProductID uuid.UUID `json:"product_id"`
-	SKU       string    `json:"sku"`
-	Price     float64   `json:"price"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID           uuid.UUID  `json:"id"`
+	UserID       uuid.UUID  `json:"user_id"`
+	CompanyID    *uuid.UUID `json:"company_id,omitempty"` //Codes are unique within the company - nil for users without one
+	ProductID    uuid.UUID  `json:"product_id"`
+	SKU          string     `json:"sku"`
+	Price        float64    `json:"price"`
+	BaseUnit     string     `json:"base_unit,omitempty"` //Unit stock is held in - defaults to each
+	StandardCost float64    `json:"standard_cost"`       //Used by standard costing, and for stock received without a cost
+	Serialized   bool       `json:"serialized"`          //Stock is tracked by individual serial number
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
 }
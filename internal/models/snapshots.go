@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// InventorySnapshot is the quantity of a sku at a location at the end of a period, materialized
+// so historical quantities can be rebuilt from it rather than from the whole ledger
+type InventorySnapshot struct {
+	SkuID      uuid.UUID `json:"sku_id"`
+	LocationID uuid.UUID `json:"location_id"`
+	UserID     uuid.UUID `json:"user_id"`
+	Quantity   int       `json:"quantity"`
+	PeriodEnd  time.Time `json:"period_end"`
+	CreatedAt  time.Time `json:"created_at"`
+}
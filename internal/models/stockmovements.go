@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Reason codes recorded against each stock movement
+const (
+	MovementReasonReceipt    = "receipt"
+	MovementReasonShipment   = "shipment"
+	MovementReasonAdjustment = "adjustment"
+	MovementReasonDamage     = "damage"
+	MovementReasonReturn     = "return"
+
+	//Recorded by transfers only - not accepted through UpdateInventory
+	MovementReasonTransferOut = "transfer_out"
+	MovementReasonTransferIn  = "transfer_in"
+
+	//Recorded when a stock count's adjustments are posted
+	MovementReasonCount = "count"
+
+	//Recorded against both the kit and its components when kits are built or broken up
+	MovementReasonAssembly    = "assembly"
+	MovementReasonDisassembly = "disassembly"
+)
+
+type StockMovement struct {
+	ID           uuid.UUID  `json:"id"`
+	SkuID        uuid.UUID  `json:"sku_id"`
+	LocationID   uuid.UUID  `json:"location_id"`
+	UserID       uuid.UUID  `json:"user_id"`
+	Quantity     int        `json:"quantity"` //Signed delta - positive adds stock, negative removes it
+	Reason       string     `json:"reason"`
+	Reference    string     `json:"reference,omitempty"`
+	LotNumber    string     `json:"lot_number,omitempty"`
+	SerialNumber string     `json:"serial_number,omitempty"`
+	BinID        *uuid.UUID `json:"bin_id,omitempty"`    //Bin the stock is put into or taken from - issues without one empty unbinned stock first
+	UnitCost     *float64   `json:"unit_cost,omitempty"` //Cost of stock received - falls back to the current cost when not given
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+func IsValidMovementReason(reason string) bool {
+	switch reason {
+	case MovementReasonReceipt, MovementReasonShipment, MovementReasonAdjustment, MovementReasonDamage, MovementReasonReturn:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Supplier struct {
+	ID           uuid.UUID `json:"id"`
+	UserID       uuid.UUID `json:"user_id"`
+	Name         string    `json:"name"`
+	ContactName  string    `json:"contact_name,omitempty"`
+	Email        string    `json:"email,omitempty"`
+	Phone        string    `json:"phone,omitempty"`
+	Currency     string    `json:"currency"`       //ISO 4217 code, e.g. GBP
+	LeadTimeDays int       `json:"lead_time_days"` //Days from order to delivery
+	Notes        string    `json:"notes,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// SupplierSKU is a sku as a supplier sells it - their own code, price and lead time for it
+type SupplierSKU struct {
+	ID               uuid.UUID `json:"id"`
+	SupplierID       uuid.UUID `json:"supplier_id"`
+	SkuID            uuid.UUID `json:"sku_id"`
+	UserID           uuid.UUID `json:"user_id"`
+	SupplierCode     string    `json:"supplier_code,omitempty"`
+	Price            float64   `json:"price"` //Per base unit, in the supplier's currency
+	MinOrderQuantity int       `json:"min_order_quantity,omitempty"`
+	LeadTimeDays     *int      `json:"lead_time_days,omitempty"` //Overrides the supplier's lead time
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
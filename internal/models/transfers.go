@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Transfer states - draft -> in_transit -> received, or draft -> cancelled
+const (
+	TransferStatusDraft     = "draft"
+	TransferStatusInTransit = "in_transit"
+	TransferStatusReceived  = "received"
+	TransferStatusCancelled = "cancelled"
+)
+
+type Transfer struct {
+	ID                    uuid.UUID      `json:"id"`
+	UserID                uuid.UUID      `json:"user_id"`
+	SourceLocationID      uuid.UUID      `json:"source_location_id"`
+	DestinationLocationID uuid.UUID      `json:"destination_location_id"`
+	Status                string         `json:"status"`
+	Notes                 string         `json:"notes,omitempty"`
+	Lines                 []TransferLine `json:"lines,omitempty"`
+	ShippedAt             *time.Time     `json:"shipped_at,omitempty"`
+	ReceivedAt            *time.Time     `json:"received_at,omitempty"`
+	CreatedAt             time.Time      `json:"created_at"`
+	UpdatedAt             time.Time      `json:"updated_at"`
+}
+
+// TransferDatabase is the transfers table row - lines are stored separately in transfer_lines
+type TransferDatabase struct {
+	ID                    uuid.UUID  `json:"id"`
+	UserID                uuid.UUID  `json:"user_id"`
+	SourceLocationID      uuid.UUID  `json:"source_location_id"`
+	DestinationLocationID uuid.UUID  `json:"destination_location_id"`
+	Status                string     `json:"status"`
+	Notes                 string     `json:"notes,omitempty"`
+	ShippedAt             *time.Time `json:"shipped_at,omitempty"`
+	ReceivedAt            *time.Time `json:"received_at,omitempty"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+}
+
+type TransferLine struct {
+	ID               uuid.UUID `json:"id"`
+	TransferID       uuid.UUID `json:"transfer_id"`
+	SkuID            uuid.UUID `json:"sku_id"`
+	UserID           uuid.UUID `json:"user_id"`
+	Quantity         int       `json:"quantity"`
+	QuantityReceived int       `json:"quantity_received"`
+	Unit             string    `json:"unit,omitempty"` //Unit the quantity was given in - converted to the base unit before saving
+}
+
+// Discrepancy is the difference between what was shipped and what arrived for a transfer line
+type TransferDiscrepancy struct {
+	SkuID            uuid.UUID `json:"sku_id"`
+	QuantityShipped  int       `json:"quantity_shipped"`
+	QuantityReceived int       `json:"quantity_received"`
+	Difference       int       `json:"difference"`
+}
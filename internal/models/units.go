@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The base unit of skus that don't declare one
+const DefaultBaseUnit = "each"
+
+// Unit is an alternative unit a sku is handled in - e.g. a case of 24, or grams of a sku stocked in kg.
+// Stock is always held in the sku's base unit; quantities given in a unit are multiplied by its factor.
+type Unit struct {
+	ID        uuid.UUID `json:"id"`
+	SkuID     uuid.UUID `json:"sku_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Name      string    `json:"name"`
+	Factor    float64   `json:"factor"` //Base units in one of this unit
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
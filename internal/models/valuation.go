@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Costing methods a company can value its stock by
+const (
+	CostingMethodFIFO     = "fifo"
+	CostingMethodAverage  = "average" //Moving weighted average
+	CostingMethodStandard = "standard"
+)
+
+func IsValidCostingMethod(method string) bool {
+	switch method {
+	case CostingMethodFIFO, CostingMethodAverage, CostingMethodStandard:
+		return true
+	}
+	return false
+}
+
+// CostLayer is stock received at one unit cost - issues consume the oldest layers first
+type CostLayer struct {
+	ID         uuid.UUID `json:"id"`
+	SkuID      uuid.UUID `json:"sku_id"`
+	LocationID uuid.UUID `json:"location_id"`
+	UserID     uuid.UUID `json:"user_id"`
+	MovementID uuid.UUID `json:"movement_id"`
+	UnitCost   float64   `json:"unit_cost"`
+	Quantity   int       `json:"quantity"`  //Quantity received
+	Remaining  int       `json:"remaining"` //Quantity not yet issued
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// AverageCost is the moving weighted average cost of a sku at a location - receipts move the
+// average, issues leave it unchanged
+type AverageCost struct {
+	SkuID      uuid.UUID `json:"sku_id"`
+	LocationID uuid.UUID `json:"location_id"`
+	UserID     uuid.UUID `json:"user_id"`
+	Quantity   int       `json:"quantity"`
+	UnitCost   float64   `json:"unit_cost"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ValuationLine is the stock value of one warehouse or category - ID is nil for uncategorised stock
+type ValuationLine struct {
+	ID       *uuid.UUID `json:"id"`
+	Name     string     `json:"name"`
+	Quantity int        `json:"quantity"`
+	Value    float64    `json:"value"`
+}
+
+type ValuationReport struct {
+	Method      string          `json:"method"`
+	Quantity    int             `json:"quantity"`
+	Value       float64         `json:"value"`
+	Warehouses  []ValuationLine `json:"warehouses"`
+	Categories  []ValuationLine `json:"categories"`
+	GeneratedAt time.Time       `json:"generated_at"`
+}
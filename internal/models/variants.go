@@ -0,0 +1,22 @@
+package models
+
+import "github.com/google/uuid"
+
+// VariantAxis is one attribute of a variant matrix with the values it takes, e.g. size S, M and L
+type VariantAxis struct {
+	AttributeID uuid.UUID `json:"attribute_id"`
+	Values      []string  `json:"values"`
+}
+
+// Variant is a sku of a product along with the attribute values that set it apart
+type Variant struct {
+	SKU        SKU             `json:"sku"`
+	Attributes []SKUAttributes `json:"attributes"`
+}
+
+// VariantMatrix is the result of generating a product's variants - skipped combinations are those the
+// product already had a sku for, which is given in their place
+type VariantMatrix struct {
+	Created []Variant `json:"created"`
+	Skipped []Variant `json:"skipped"`
+}
@@ -18,10 +18,11 @@ type Warehouse struct {
 		PostZipCode  string `json:"post_zip_code"`
 		Country      string `json:"country"`
 	} `json:"address"`
-	Latitude  float32   `json:"latitude"`
-	Longitude float32   `json:"longitude"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	Latitude  float32    `json:"latitude"`
+	Longitude float32    `json:"longitude"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Bins      []*BinNode `json:"bins,omitempty"` //Only populated when requested with ?include=bins
 }
 
 type WarehouseDatabase struct {
@@ -9,10 +9,13 @@ import (
 func SetupRoutes(app *fiber.App) {
 	// Product routes
 	app.Post("/products", handlers.CreateProduct)
-	app.Get("/products", handlers.GetProducts)
+	app.Get("/products", handlers.GetProducts) //?category=, ?include_descendants=true
 	app.Get("/products/:id", handlers.GetProduct)
 	app.Put("/products/:id", handlers.UpdateProduct)
 	app.Delete("/products/:id", handlers.DeleteProduct)
+	app.Post("/products/:id/variants/generate", handlers.GenerateVariants) //Every combination of the given attribute values as a sku, skipping existing ones
+	app.Get("/products/:id/categories", handlers.GetProductCategories)
+	app.Put("/products/:id/categories", handlers.UpdateProductCategories) //One primary and any number of secondary categories
 
 	// Attribute routes
 	app.Post("/attributes", handlers.CreateAttribute)
@@ -28,6 +31,28 @@ func SetupRoutes(app *fiber.App) {
 	app.Get("/skus", handlers.GetSKUs)
 	app.Get("/skus/:id/products", handlers.GetSKUsByProductID)
 	app.Delete("/skus/:id", handlers.DeleteSKU)
+	app.Post("/sku-templates/preview", handlers.PreviewSKUCodes) //Codes a template would generate, without saving
+
+	// Serial number routes - individually tracked units of serialized SKUs
+	app.Post("/skus/:id/serials", handlers.RegisterSerials)
+	app.Get("/skus/:id/serials", handlers.GetSKUSerials)
+	app.Get("/serials/:serial", handlers.GetSerial)
+	app.Get("/serials/:serial/movements", handlers.GetSerialMovements)
+	app.Post("/serials/:serial/move", handlers.MoveSerial)
+	app.Post("/serials/:serial/ship", handlers.ShipSerial)
+
+	// Unit of measure routes - alternative units (case, pallet, g) and their base unit conversions
+	app.Post("/skus/:id/units", handlers.CreateUnit)
+	app.Get("/skus/:id/units", handlers.GetUnits)
+	app.Delete("/skus/:id/units/:unitid", handlers.DeleteUnit)
+
+	// Kit routes - bills of materials, and building kits from their components
+	app.Put("/skus/:id/bom", handlers.UpdateBOM) //Replaces the whole bill of materials
+	app.Get("/skus/:id/bom", handlers.GetBOM)
+	app.Delete("/skus/:id/bom", handlers.DeleteBOM)
+	app.Get("/inventory/:locationid/sku/:skuid/kit", handlers.GetKitAvailability)
+	app.Post("/inventory/:locationid/sku/:skuid/assemble", handlers.AssembleKit)
+	app.Post("/inventory/:locationid/sku/:skuid/disassemble", handlers.DisassembleKit)
 
 	// SKU Attribute routes
 	app.Post("/sku/:skuid/attributes", handlers.UpdateSKUAttribute)       //Insert/update skuattribute
@@ -37,6 +62,7 @@ func SetupRoutes(app *fiber.App) {
 
 	// Barcode routes
 	app.Post("/barcodes", handlers.CreateBarcode)
+	app.Post("/barcodes/scan", handlers.ScanBarcode) //Resolve a scanned value (incl. GS1 lot/expiry) to a SKU
 	app.Put("/barcodes/:id", handlers.UpdateBarcode)
 	app.Get("/barcodes", handlers.GetBarcodes)
 	app.Get("/barcodes/:id", handlers.GetBarcode)
@@ -47,9 +73,13 @@ func SetupRoutes(app *fiber.App) {
 	app.Post("/categories", handlers.CreateCategory)
 	app.Put("/categories/:id", handlers.UpdateCategory)
 	app.Get("/categories", handlers.GetCategories)
+	app.Get("/categories/tree", handlers.GetCategoryTree) //Nested hierarchy
 	app.Get("/categories/:id", handlers.GetCategory)
-	app.Delete("/categories/:id", handlers.DeleteCategory)
+	app.Delete("/categories/:id", handlers.DeleteCategory) //?policy=restrict|reparent|cascade for child categories and products
 	app.Get("/categories/:id/parent", handlers.GetCategoriesByParentID)
+	app.Get("/categories/:id/products", handlers.GetCategoryProducts) //?include_descendants=true
+	app.Get("/categories/:id/path", handlers.GetCategoryPath)         //Breadcrumbs from the top of the tree
+	app.Post("/categories/:id/move", handlers.MoveCategory)           //Re-parent the whole subtree
 
 	// Location (warehouses) routes
 	app.Post("/warehouses", handlers.CreateWarehouse)
@@ -58,13 +88,134 @@ func SetupRoutes(app *fiber.App) {
 	app.Get("/warehouses/:id", handlers.GetWarehouse)
 	app.Delete("/warehouses/:id", handlers.DeleteWarehouse)
 
+	// Bin routes - aisle/rack/shelf/bin locations inside a warehouse
+	app.Post("/warehouses/:id/bins", handlers.CreateBin)
+	app.Get("/warehouses/:id/bins", handlers.GetBins)
+	app.Post("/bins/move", handlers.MoveBinStock) //Bin-to-bin move within a warehouse
+	app.Get("/bins/:id/inventory", handlers.GetBinInventory)
+	app.Post("/bins/:id/putaway", handlers.PutawayToBin)
+	app.Post("/bins/:id/pick", handlers.PickFromBin)
+	app.Delete("/bins/:id", handlers.DeleteBin)
+
 	//Inventory routes - CRUD functions for database table storing quantity of items in inventory
-	app.Post("/inventory/:locationid/:skuid", handlers.UpdateInventory)         //Add/update inventory quantity
-	app.Get("/inventory", handlers.GetInventory)                                //List locations only
-	app.Get("/inventory/:locationid", handlers.GetInventory)                    //Get products stored at said location
-	app.Get("/inventory/:locationid/sku/:skuid", handlers.GetSpecificInventory) //Get quantity of specific sku at specific location
-	app.Get("/inventory/sku/:skuid", handlers.GetInventoryForSKU)               //Get quantity of specific sku at all locations
-	app.Delete("/inventory/:locationid", handlers.DeleteInventory)              //Delete inventory location (may not be needed)
+	app.Get("/inventory/alerts", handlers.GetStockAlerts)                              //Open low/over-stock alerts - registered before /inventory/:locationid
+	app.Post("/inventory/:locationid/:skuid", handlers.UpdateInventory)                //Add/update inventory quantity
+	app.Get("/inventory", handlers.GetInventory)                                       //List locations only
+	app.Get("/inventory/:locationid", handlers.GetInventory)                           //Get products stored at said location
+	app.Get("/inventory/:locationid/sku/:skuid", handlers.GetSpecificInventory)        //Get quantity of specific sku at specific location
+	app.Get("/inventory/:locationid/sku/:skuid/movements", handlers.GetStockMovements) //Get movement history of specific sku at specific location
+	app.Get("/inventory/sku/:skuid", handlers.GetInventoryForSKU)                      //Get quantity of specific sku at all locations
+	app.Delete("/inventory/:locationid", handlers.DeleteInventory)                     //Delete inventory location (may not be needed)
+
+	//Reorder rules - minimum, reorder point and maximum levels per sku and location
+	app.Post("/inventory/:locationid/sku/:skuid/reorder", handlers.UpdateReorderRule)
+	app.Get("/inventory/:locationid/sku/:skuid/reorder", handlers.GetReorderRule)
+	app.Delete("/inventory/:locationid/sku/:skuid/reorder", handlers.DeleteReorderRule)
+
+	//Lot routes - stock held per lot/batch with expiry dates
+	app.Post("/inventory/:locationid/sku/:skuid/lots", handlers.ReceiveLot)
+	app.Get("/inventory/:locationid/sku/:skuid/lots", handlers.GetLots) //FEFO order
+	app.Get("/lots/expiring", handlers.GetExpiringLots)                 //?days=N
+
+	//Transfer routes - moving stock between warehouses
+	app.Post("/transfers", handlers.CreateTransfer)
+	app.Get("/transfers", handlers.GetTransfers)
+	app.Get("/transfers/:id", handlers.GetTransfer)
+	app.Post("/transfers/:id/ship", handlers.ShipTransfer)       //Draft -> in transit, removes stock from source
+	app.Post("/transfers/:id/receive", handlers.ReceiveTransfer) //Partial or full receipt into destination
+	app.Delete("/transfers/:id", handlers.CancelTransfer)        //Cancel a draft transfer
+
+	//Reservation routes - stock promised to open orders, released automatically on expiry
+	app.Post("/reservations", handlers.CreateReservation)
+	app.Get("/reservations", handlers.GetReservations)
+	app.Get("/reservations/:id", handlers.GetReservation)
+	app.Post("/reservations/:id/fulfil", handlers.FulfilReservation) //Ship the reserved stock
+	app.Delete("/reservations/:id", handlers.ReleaseReservation)
+
+	//Stock count routes - cycle counts and full stocktakes, posted as count adjustments
+	app.Post("/counts", handlers.CreateCountSession) //Snapshots system quantities
+	app.Get("/counts", handlers.GetCountSessions)
+	app.Get("/counts/:id", handlers.GetCountSession) //Lines with counted quantity and variance
+	app.Post("/counts/:id/entries", handlers.SubmitCountEntry)
+	app.Delete("/counts/:id/entries/:entryid", handlers.DeleteCountEntry)
+	app.Post("/counts/:id/post", handlers.PostCountSession) //Post approved variances to inventory
+	app.Delete("/counts/:id", handlers.CancelCountSession)
+
+	//Supplier routes - suppliers and the codes and prices they sell skus at
+	app.Post("/suppliers", handlers.CreateSupplier)
+	app.Get("/suppliers", handlers.GetSuppliers)
+	app.Get("/suppliers/:id", handlers.GetSupplier)
+	app.Put("/suppliers/:id", handlers.UpdateSupplier)
+	app.Delete("/suppliers/:id", handlers.DeleteSupplier)
+	app.Post("/suppliers/:id/skus", handlers.UpdateSupplierSKU) //Insert/update supplier code and price for a sku
+	app.Get("/suppliers/:id/skus", handlers.GetSupplierSKUs)
+	app.Delete("/suppliers/:id/skus/:skuid", handlers.DeleteSupplierSKU)
+	app.Get("/skus/:id/suppliers", handlers.GetSKUSuppliers) //Every supplier of a sku with their price
+
+	//Purchase order routes - buying stock from suppliers into a warehouse
+	app.Post("/purchase-orders", handlers.CreatePurchaseOrder)
+	app.Get("/purchase-orders", handlers.GetPurchaseOrders) //?status=, ?supplier_id=, ?warehouse_id=
+	app.Get("/purchase-orders/:id", handlers.GetPurchaseOrder)
+	app.Put("/purchase-orders/:id", handlers.UpdatePurchaseOrder)           //Drafts only
+	app.Post("/purchase-orders/:id/send", handlers.SendPurchaseOrder)       //Draft -> sent
+	app.Post("/purchase-orders/:id/receive", handlers.ReceivePurchaseOrder) //Partial or full receipt at cost
+	app.Delete("/purchase-orders/:id", handlers.CancelPurchaseOrder)
+
+	//ASN routes - expected deliveries, received line by line or by scanning barcodes
+	app.Post("/asns", handlers.CreateASN) //Optionally against a purchase order
+	app.Get("/asns", handlers.GetASNs)    //?status=, ?warehouse_id=, ?purchase_order_id=
+	app.Get("/asns/:id", handlers.GetASN)
+	app.Post("/asns/:id/receive", handlers.ReceiveASN)
+	app.Post("/asns/:id/scan", handlers.ScanASN)   //Resolve a barcode and receive one pack of it
+	app.Post("/asns/:id/close", handlers.CloseASN) //Reports discrepancies - out of tolerance needs accept
+	app.Delete("/asns/:id", handlers.CancelASN)
+
+	//Customer routes
+	app.Post("/customers", handlers.CreateCustomer)
+	app.Get("/customers", handlers.GetCustomers)
+	app.Get("/customers/:id", handlers.GetCustomer)
+	app.Put("/customers/:id", handlers.UpdateCustomer)
+	app.Delete("/customers/:id", handlers.DeleteCustomer)
+
+	//Sales order routes - allocate, pick, pack and ship customer orders
+	app.Post("/sales-orders", handlers.CreateSalesOrder)
+	app.Get("/sales-orders", handlers.GetSalesOrders) //?status=, ?customer_id=
+	app.Get("/sales-orders/:id", handlers.GetSalesOrder)
+	app.Get("/sales-orders/:id/events", handlers.GetSalesOrderEvents)   //Audit trail of every state change
+	app.Post("/sales-orders/:id/allocate", handlers.AllocateSalesOrder) //Reserve stock - reports shortages
+	app.Post("/sales-orders/:id/pick", handlers.PickSalesOrder)         //Pick lists grouped by warehouse
+	app.Post("/sales-orders/:id/shipments", handlers.CreateShipment)    //Pack into a shipment
+	app.Get("/sales-orders/:id/shipments", handlers.GetSalesOrderShipments)
+	app.Delete("/sales-orders/:id", handlers.CancelSalesOrder) //Releases allocated stock
+	app.Get("/shipments/:id", handlers.GetShipment)
+	app.Post("/shipments/:id/dispatch", handlers.DispatchShipment) //Removes the stock from inventory
+
+	//Return routes - customer returns (RMA), received for inspection before anything is restocked
+	app.Post("/returns", handlers.CreateReturn) //Authorize a return
+	app.Get("/returns", handlers.GetReturns)    //?status=, ?customer_id=, ?order_reference=
+	app.Get("/returns/:id", handlers.GetReturn)
+	app.Post("/returns/:id/receive", handlers.ReceiveReturn)
+	app.Post("/returns/:id/inspect", handlers.InspectReturn) //restock, quarantine or scrap
+	app.Delete("/returns/:id", handlers.CancelReturn)
+	app.Get("/quarantine", handlers.GetQuarantineStock) //?warehouse_id=, ?sku_id=, ?released=true
+	app.Post("/quarantine/:id/release", handlers.ReleaseQuarantineStock)
+
+	//Backorder routes - demand stock can't cover is queued and filled oldest first as stock arrives
+	app.Post("/demand", handlers.RequestDemand)    //Reserves what it can, backorders the rest
+	app.Get("/backorders", handlers.GetBackorders) //?status=, ?sku_id=, ?location_id=
+	app.Delete("/backorders/:id", handlers.CancelBackorder)
+
+	//Replenishment routes
+	app.Get("/replenishment/suggestions", handlers.GetReplenishmentSuggestions) //Transfers between warehouses and network shortages, ?sku_id=, ?warehouse_id=
+
+	//Forecast routes - recomputed nightly from shipments
+	app.Get("/skus/:id/forecast", handlers.GetSKUForecast) //Daily demand with confidence intervals and suggested reorder levels, ?location_id=
+
+	//Report routes
+	app.Get("/reports/valuation", handlers.GetValuationReport)           //?method=fifo|average|standard, ?warehouse_id=
+	app.Get("/reports/backorders", handlers.GetBackorderReport)          //Outstanding per sku with age, ?location_id=
+	app.Get("/reports/classification", handlers.GetClassificationReport) //ABC/XYZ by consumption value and demand variability, ?days=, ?category_id=, ?warehouse_id=
+	app.Get("/reports/dead-stock", handlers.GetDeadStockReport)          //Stock not issued in ?days= (slow-moving) or twice that (dead), ?category_id=, ?warehouse_id=
 
 	//User details routes
 	app.Post("/users", handlers.CreateUser)
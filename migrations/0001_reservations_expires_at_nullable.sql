@@ -0,0 +1,3 @@
+-- Reservations without an expiry are held until they are fulfilled or released, e.g. stock
+-- reserved to fill a backorder
+alter table reservations alter column expires_at drop not null;
@@ -0,0 +1,11 @@
+-- SKU codes are unique within a company, or within a user's own skus for users without one.
+-- Any codes already duplicated must be renamed before the index can be created.
+alter table skus add column if not exists company_id uuid references companies (id);
+
+update skus
+set company_id = users.company_id
+from users
+where users.id = skus.user_id
+  and skus.company_id is null;
+
+create unique index if not exists skus_company_sku_key on skus (coalesce(company_id, user_id), sku);
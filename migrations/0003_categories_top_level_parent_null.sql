@@ -0,0 +1,5 @@
+-- Top level categories have a null parent_id. Categories saved with the zero UUID as their
+-- parent are moved over.
+update categories
+set parent_id = null
+where parent_id = '00000000-0000-0000-0000-000000000000';
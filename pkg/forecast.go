@@ -0,0 +1,108 @@
+package pkg
+
+import "math"
+
+// ForecastResult is a forecast for the days after a series, along with the one-step-ahead errors the
+// model made when replayed over the series - which say how far the forecast can be trusted
+type ForecastResult struct {
+	Forecast []float64 //One value per day of the horizon
+	MAE      float64   //Mean absolute one-step error
+	StdDev   float64   //Standard deviation of the one-step errors
+}
+
+// Fewest one-step errors a model's accuracy is judged on - with fewer, a model replayed over a
+// short series would look perfect and always be chosen, with no spread for an interval
+const minForecastErrors = 7
+
+// Summarizes the one-step errors of a model. When there are too few of them, the series' own spread
+// about its mean stands in.
+func forecastErrors(errs, series []float64) (mae, stdDev float64) {
+	if len(errs) < minForecastErrors {
+		average := mean(series)
+		errs = make([]float64, len(series))
+		for i, v := range series {
+			errs[i] = v - average
+		}
+	}
+	if len(errs) == 0 {
+		return 0, 0
+	}
+	sum, sumAbs := 0.0, 0.0
+	for _, e := range errs {
+		sum += e
+		sumAbs += math.Abs(e)
+	}
+	mean := sum / float64(len(errs))
+	variance := 0.0
+	for _, e := range errs {
+		variance += (e - mean) * (e - mean)
+	}
+	return sumAbs / float64(len(errs)), math.Sqrt(variance / float64(len(errs)))
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// MovingAverageForecast forecasts every day of the horizon as the mean of the last window days.
+// Series shorter than the window are averaged over what there is.
+func MovingAverageForecast(series []float64, window, horizon int) ForecastResult {
+	window = max(1, min(window, len(series)))
+
+	errs := []float64{}
+	for t := window; t < len(series); t++ {
+		errs = append(errs, series[t]-mean(series[t-window:t]))
+	}
+	result := ForecastResult{Forecast: make([]float64, horizon)}
+	result.MAE, result.StdDev = forecastErrors(errs, series)
+
+	next := mean(series[len(series)-window:])
+	for h := range result.Forecast {
+		result.Forecast[h] = next
+	}
+	return result
+}
+
+// SeasonalSmoothingForecast forecasts with additive Holt-Winters exponential smoothing: a level, a
+// trend and a repeating seasonal pattern of the given length (7 for a weekly pattern in daily data),
+// each updated by its smoothing factor as the series is replayed. It needs at least two full seasons
+// of history to start from - false is returned when there is less.
+func SeasonalSmoothingForecast(series []float64, season int, alpha, beta, gamma float64, horizon int) (ForecastResult, bool) {
+	if season < 1 || len(series) < 2*season {
+		return ForecastResult{}, false
+	}
+
+	//Start from the first season's average, the change to the second, and each day's offset from the average
+	level := mean(series[:season])
+	trend := (mean(series[season:2*season]) - level) / float64(season)
+	seasonals := make([]float64, season)
+	for i := range seasonals {
+		seasonals[i] = series[i] - level
+	}
+
+	errs := []float64{}
+	for t := season; t < len(series); t++ {
+		s := t % season
+		errs = append(errs, series[t]-(level+trend+seasonals[s]))
+
+		lastLevel := level
+		level = alpha*(series[t]-seasonals[s]) + (1-alpha)*(level+trend)
+		trend = beta*(level-lastLevel) + (1-beta)*trend
+		seasonals[s] = gamma*(series[t]-level) + (1-gamma)*seasonals[s]
+	}
+	result := ForecastResult{Forecast: make([]float64, horizon)}
+	result.MAE, result.StdDev = forecastErrors(errs, series)
+
+	//Demand can't go negative, however steep the trend
+	for h := range result.Forecast {
+		result.Forecast[h] = max(0, level+float64(h+1)*trend+seasonals[(len(series)+h)%season])
+	}
+	return result, true
+}
@@ -0,0 +1,132 @@
+package pkg
+
+import (
+	"math"
+	"testing"
+)
+
+// A weekly pattern of demand repeated for the given number of weeks
+func weeklySeries(weeks int) []float64 {
+	week := []float64{2, 4, 4, 5, 6, 10, 1}
+	series := []float64{}
+	for range weeks {
+		series = append(series, week...)
+	}
+	return series
+}
+
+func closeTo(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestMovingAverageForecast(t *testing.T) {
+	tests := []struct {
+		name       string
+		series     []float64
+		window     int
+		wantNext   float64
+		wantMAE    float64
+		wantStdDev float64
+	}{
+		{name: "single day", series: []float64{5}, window: 28, wantNext: 5},
+		{
+			//Two one-step errors are too few to judge by - the spread of the series is used
+			name:       "short series",
+			series:     []float64{1, 3, 5, 3},
+			window:     2,
+			wantNext:   4,
+			wantMAE:    1,
+			wantStdDev: math.Sqrt(2),
+		},
+		{
+			name:     "shorter than the window",
+			series:   []float64{2, 4, 6},
+			window:   28,
+			wantNext: 4,
+			//2, 0 and 2 away from the mean
+			wantMAE:    4.0 / 3,
+			wantStdDev: math.Sqrt(8.0 / 3),
+		},
+		{
+			name:       "constant",
+			series:     []float64{3, 3, 3, 3, 3, 3, 3, 3, 3, 3},
+			window:     2,
+			wantNext:   3,
+			wantMAE:    0,
+			wantStdDev: 0,
+		},
+		{
+			//Errors of +1 and -1 alternating, eight of them
+			name:       "enough errors",
+			series:     []float64{1, 2, 1, 2, 1, 2, 1, 2, 1},
+			window:     1,
+			wantNext:   1,
+			wantMAE:    1,
+			wantStdDev: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MovingAverageForecast(tt.series, tt.window, 3)
+			if len(got.Forecast) != 3 {
+				t.Fatalf("forecast has %d days, want 3", len(got.Forecast))
+			}
+			for h, v := range got.Forecast {
+				if !closeTo(v, tt.wantNext) {
+					t.Errorf("forecast day %d = %v, want %v", h, v, tt.wantNext)
+				}
+			}
+			if !closeTo(got.MAE, tt.wantMAE) || !closeTo(got.StdDev, tt.wantStdDev) {
+				t.Errorf("MAE, StdDev = %v, %v - want %v, %v", got.MAE, got.StdDev, tt.wantMAE, tt.wantStdDev)
+			}
+		})
+	}
+}
+
+func TestSeasonalSmoothingForecast(t *testing.T) {
+	tests := []struct {
+		name   string
+		series []float64
+		season int
+		wantOK bool
+	}{
+		{name: "under two seasons", series: weeklySeries(1), season: 7},
+		{name: "no season", series: weeklySeries(4), season: 0},
+		{name: "two seasons", series: weeklySeries(2), season: 7, wantOK: true},
+		{name: "many seasons", series: weeklySeries(12), season: 7, wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := SeasonalSmoothingForecast(tt.series, tt.season, 0.3, 0.05, 0.2, 14)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			//A pattern that repeats exactly is forecast exactly
+			for h, v := range got.Forecast {
+				want := tt.series[(len(tt.series)+h)%tt.season]
+				if !closeTo(v, want) {
+					t.Errorf("forecast day %d = %v, want %v", h, v, want)
+				}
+			}
+			if !closeTo(got.MAE, 0) {
+				t.Errorf("MAE = %v, want 0", got.MAE)
+			}
+		})
+	}
+}
+
+// The moving average must not win on a short history just because it made too few errors to count
+func TestShortHistoryHasSpread(t *testing.T) {
+	series := weeklySeries(2)
+	moving := MovingAverageForecast(series, 28, 7)
+	if moving.MAE == 0 || moving.StdDev == 0 {
+		t.Fatalf("moving average over %d days has MAE %v, StdDev %v - want the series' spread", len(series), moving.MAE, moving.StdDev)
+	}
+	seasonal, ok := SeasonalSmoothingForecast(series, 7, 0.3, 0.05, 0.2, 7)
+	if !ok || seasonal.MAE >= moving.MAE {
+		t.Errorf("seasonal MAE %v should beat moving average MAE %v on a repeating pattern", seasonal.MAE, moving.MAE)
+	}
+}
@@ -0,0 +1,17 @@
+package pkg
+
+import "math"
+
+const earthRadiusKm = 6371.0
+
+// HaversineDistance returns the great-circle distance in kilometres between two points given in degrees
+func HaversineDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	toRadians := func(degrees float64) float64 {
+		return degrees * math.Pi / 180
+	}
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
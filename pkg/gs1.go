@@ -0,0 +1,121 @@
+package pkg
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Group separator (FNC1) used to terminate variable length fields in raw GS1 barcodes
+const gs1GroupSeparator = "\x1d"
+
+// GS1Data holds the application identifiers we make use of from a scanned GS1 barcode
+type GS1Data struct {
+	GTIN         string     `json:"gtin,omitempty"`          //AI 01
+	ExpiryDate   *time.Time `json:"expiry_date,omitempty"`   //AI 17
+	LotNumber    string     `json:"lot_number,omitempty"`    //AI 10
+	SerialNumber string     `json:"serial_number,omitempty"` //AI 21
+}
+
+var ErrNotGS1 = errors.New("value is not a GS1 element string")
+
+// Fixed lengths of the AIs we read - anything not listed is variable length
+var gs1FixedLengths = map[string]int{
+	"01": 14,
+	"17": 6,
+}
+
+// Symbology identifiers scanners prefix GS1 barcodes with
+var gs1SymbologyPrefixes = []string{"]C1", "]d2", "]Q3", "]e0"}
+
+// ParseGS1 parses a GS1 element string, either in human readable form "(01)...(17)...(10)..."
+// or raw with FNC1 (ASCII 29) separators. Raw strings must carry a "]C1"/"]d2" style symbology
+// identifier or a leading FNC1, or else start with a GTIN (AI 01) - otherwise a plain barcode that
+// happens to start with 10 or 21 would be read as a lot or serial number.
+func ParseGS1(value string) (*GS1Data, error) {
+	fields := map[string]string{}
+
+	if strings.HasPrefix(value, "(") {
+		for _, part := range strings.Split(value[1:], "(") {
+			ai, data, ok := strings.Cut(part, ")")
+			if !ok || ai == "" {
+				return nil, ErrNotGS1
+			}
+			fields[ai] = data
+		}
+	} else {
+		marked := false
+		for _, prefix := range append(gs1SymbologyPrefixes, gs1GroupSeparator) {
+			if strings.HasPrefix(value, prefix) {
+				value = strings.TrimPrefix(value, prefix)
+				marked = true
+			}
+		}
+		if !marked && !strings.HasPrefix(value, "01") {
+			return nil, ErrNotGS1
+		}
+		for len(value) > 0 {
+			if len(value) < 2 {
+				return nil, ErrNotGS1
+			}
+			ai := value[:2]
+			value = value[2:]
+			if length, ok := gs1FixedLengths[ai]; ok {
+				if len(value) < length {
+					return nil, ErrNotGS1
+				}
+				fields[ai] = value[:length]
+				value = strings.TrimPrefix(value[length:], gs1GroupSeparator)
+				continue
+			}
+			if ai != "10" && ai != "21" {
+				//Unknown AI - we can't tell where it ends, so stop here
+				break
+			}
+			data, rest, _ := strings.Cut(value, gs1GroupSeparator)
+			fields[ai] = data
+			value = rest
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil, ErrNotGS1
+	}
+
+	result := &GS1Data{
+		GTIN:         fields["01"],
+		LotNumber:    fields["10"],
+		SerialNumber: fields["21"],
+	}
+	if expiry, ok := fields["17"]; ok {
+		date, err := parseGS1Date(expiry)
+		if err != nil {
+			return nil, err
+		}
+		result.ExpiryDate = &date
+	}
+	if result.GTIN == "" && result.LotNumber == "" && result.SerialNumber == "" && result.ExpiryDate == nil {
+		return nil, ErrNotGS1
+	}
+	return result, nil
+}
+
+// GS1 dates are YYMMDD - a day of 00 means the last day of the month
+func parseGS1Date(value string) (time.Time, error) {
+	if len(value) != 6 {
+		return time.Time{}, ErrNotGS1
+	}
+	day := value[4:]
+	date, err := time.Parse("060102", value[:4]+"01")
+	if err != nil {
+		return time.Time{}, ErrNotGS1
+	}
+	if day == "00" {
+		return date.AddDate(0, 1, -1), nil
+	}
+	date, err = time.Parse("060102", value)
+	if err != nil {
+		return time.Time{}, ErrNotGS1
+	}
+	return date, nil
+}
@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseGS1(t *testing.T) {
+	expiry := time.Date(2027, 3, 31, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		value   string
+		want    GS1Data
+		wantErr bool
+	}{
+		{name: "EAN-13", value: "5012345678900", wantErr: true},
+		{name: "UPC-A", value: "036000291452", wantErr: true},
+		{name: "plain code starting with lot AI", value: "1012345", wantErr: true},
+		{name: "plain code starting with serial AI", value: "21ABC-9", wantErr: true},
+		{name: "GTIN-14 without AI", value: "05012345678900", wantErr: true},
+		{name: "empty", value: "", wantErr: true},
+		{
+			name:  "bracketed",
+			value: "(01)05012345678900(17)270300(10)LOT42",
+			want:  GS1Data{GTIN: "05012345678900", ExpiryDate: &expiry, LotNumber: "LOT42"},
+		},
+		{
+			name:  "bracketed serial only",
+			value: "(21)SN001",
+			want:  GS1Data{SerialNumber: "SN001"},
+		},
+		{name: "bracketed unclosed", value: "(01", wantErr: true},
+		{
+			name:  "raw starting with GTIN",
+			value: "010501234567890017270300",
+			want:  GS1Data{GTIN: "05012345678900", ExpiryDate: &expiry},
+		},
+		{
+			name:  "raw with FNC1 separators",
+			value: "]C1010501234567890010LOT42\x1d21SN001",
+			want:  GS1Data{GTIN: "05012345678900", LotNumber: "LOT42", SerialNumber: "SN001"},
+		},
+		{
+			name:  "raw with symbology identifier and lot first",
+			value: "]d210LOT42\x1d17270300",
+			want:  GS1Data{LotNumber: "LOT42", ExpiryDate: &expiry},
+		},
+		{
+			name:  "raw with leading FNC1",
+			value: "\x1d21SN001",
+			want:  GS1Data{SerialNumber: "SN001"},
+		},
+		{name: "raw with short GTIN", value: "]C101123", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseGS1(tt.value)
+			if tt.wantErr {
+				if !errors.Is(err, ErrNotGS1) {
+					t.Fatalf("ParseGS1(%q) = %+v, %v - want ErrNotGS1", tt.value, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseGS1(%q) returned error %v", tt.value, err)
+			}
+			if got.GTIN != tt.want.GTIN || got.LotNumber != tt.want.LotNumber || got.SerialNumber != tt.want.SerialNumber {
+				t.Errorf("ParseGS1(%q) = %+v, want %+v", tt.value, *got, tt.want)
+			}
+			if (got.ExpiryDate == nil) != (tt.want.ExpiryDate == nil) || (got.ExpiryDate != nil && !got.ExpiryDate.Equal(*tt.want.ExpiryDate)) {
+				t.Errorf("ParseGS1(%q) expiry = %v, want %v", tt.value, got.ExpiryDate, tt.want.ExpiryDate)
+			}
+		})
+	}
+}
+
+func TestParseGS1Date(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"270315", time.Date(2027, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"270200", time.Date(2027, 2, 28, 0, 0, 0, 0, time.UTC)},
+		{"280200", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := parseGS1Date(tt.value)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseGS1Date(%q) = %v, %v - want %v", tt.value, got, err, tt.want)
+		}
+	}
+	for _, value := range []string{"2703", "271301", "2703AA"} {
+		if _, err := parseGS1Date(value); err == nil {
+			t.Errorf("parseGS1Date(%q) should fail", value)
+		}
+	}
+}
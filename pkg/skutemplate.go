@@ -0,0 +1,182 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const defaultSequenceWidth = 4
+
+// SKUTemplateValues are what a SKU code template is filled in from
+type SKUTemplateValues struct {
+	Category   string
+	Product    string
+	Attributes map[string]string //By attribute name - matched case-insensitively
+}
+
+// SKUCode is a rendered SKU code template - the text either side of its sequence number, if it has one
+type SKUCode struct {
+	Prefix        string
+	Suffix        string
+	SequenceWidth int //0 when the template has no {SEQ}
+}
+
+// Code returns the code with the given sequence number, zero padded to the template's width
+func (s SKUCode) Code(sequence int) string {
+	if s.SequenceWidth == 0 {
+		return s.Prefix
+	}
+	return fmt.Sprintf("%s%0*d%s", s.Prefix, s.SequenceWidth, sequence, s.Suffix)
+}
+
+// Sequence returns the sequence number of an existing code, if it was made from the same template and values
+func (s SKUCode) Sequence(code string) (int, bool) {
+	if s.SequenceWidth == 0 || len(code) <= len(s.Prefix)+len(s.Suffix) || !strings.HasPrefix(code, s.Prefix) || !strings.HasSuffix(code, s.Suffix) {
+		return 0, false
+	}
+	digits := code[len(s.Prefix) : len(code)-len(s.Suffix)]
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return 0, false
+		}
+	}
+	sequence, err := strconv.Atoi(digits)
+	return sequence, err == nil
+}
+
+type skuTemplatePart struct {
+	Literal string
+	Token   string //CATEGORY, PRODUCT, ATTR or SEQ - empty for literal text
+	Name    string //Attribute name of an ATTR token
+	Width   int    //Characters kept, or digits of a SEQ - 0 keeps everything
+}
+
+// Splits a template into literal text and tokens, e.g. {CATEGORY:3}-{ATTR:Size}-{SEQ:4}
+func parseSKUTemplate(template string) ([]skuTemplatePart, error) {
+	if strings.TrimSpace(template) == "" {
+		return nil, errors.New("template is empty")
+	}
+	parts := []skuTemplatePart{}
+	sequences := 0
+	for len(template) > 0 {
+		open := strings.IndexAny(template, "{}")
+		if open == -1 {
+			parts = append(parts, skuTemplatePart{Literal: template})
+			break
+		}
+		if template[open] == '}' {
+			return nil, errors.New("unexpected } in template")
+		}
+		if open > 0 {
+			parts = append(parts, skuTemplatePart{Literal: template[:open]})
+		}
+		end := strings.IndexByte(template[open:], '}')
+		if end == -1 {
+			return nil, errors.New("unclosed { in template")
+		}
+		body := template[open+1 : open+end]
+		template = template[open+end+1:]
+
+		fields := strings.Split(body, ":")
+		part := skuTemplatePart{Token: strings.ToUpper(strings.TrimSpace(fields[0]))}
+		args := fields[1:]
+		switch part.Token {
+		case "CATEGORY", "PRODUCT":
+		case "ATTR":
+			if len(args) == 0 || strings.TrimSpace(args[0]) == "" {
+				return nil, errors.New("{ATTR} needs an attribute name, e.g. {ATTR:Size}")
+			}
+			part.Name = strings.TrimSpace(args[0])
+			args = args[1:]
+		case "SEQ":
+			sequences++
+			part.Width = defaultSequenceWidth
+		default:
+			return nil, fmt.Errorf("unknown template token {%s}", body)
+		}
+		if len(args) > 1 {
+			return nil, fmt.Errorf("too many options in {%s}", body)
+		}
+		if len(args) == 1 {
+			width, err := strconv.Atoi(strings.TrimSpace(args[0]))
+			if err != nil || width < 1 || width > 20 {
+				return nil, fmt.Errorf("width in {%s} must be between 1 and 20", body)
+			}
+			part.Width = width
+		}
+		parts = append(parts, part)
+	}
+	if sequences > 1 {
+		return nil, errors.New("template can only have one {SEQ}")
+	}
+	return parts, nil
+}
+
+// ValidateSKUTemplate checks a template can be rendered
+func ValidateSKUTemplate(template string) error {
+	_, err := parseSKUTemplate(template)
+	return err
+}
+
+// Upper case letters and digits of a value, cut to width characters where width is set
+func skuCodeSegment(value string, width int) string {
+	segment := []rune{}
+	for _, r := range strings.ToUpper(value) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			segment = append(segment, r)
+		}
+	}
+	if width > 0 && len(segment) > width {
+		segment = segment[:width]
+	}
+	return string(segment)
+}
+
+// RenderSKUTemplate fills in a template's tokens from the values. Names are reduced to upper case
+// letters and digits before being cut to width. The sequence number is left to the caller, who knows
+// which codes already exist.
+func RenderSKUTemplate(template string, values SKUTemplateValues) (SKUCode, error) {
+	parts, err := parseSKUTemplate(template)
+	if err != nil {
+		return SKUCode{}, err
+	}
+	attributes := map[string]string{}
+	for name, value := range values.Attributes {
+		attributes[strings.ToLower(strings.TrimSpace(name))] = value
+	}
+
+	code := SKUCode{}
+	text := &code.Prefix
+	for _, part := range parts {
+		var segment string
+		switch part.Token {
+		case "":
+			*text += part.Literal
+			continue
+		case "SEQ":
+			code.SequenceWidth = part.Width
+			text = &code.Suffix
+			continue
+		case "CATEGORY":
+			segment = skuCodeSegment(values.Category, part.Width)
+			if segment == "" {
+				return SKUCode{}, errors.New("template uses {CATEGORY} but the product has no category")
+			}
+		case "PRODUCT":
+			segment = skuCodeSegment(values.Product, part.Width)
+			if segment == "" {
+				return SKUCode{}, errors.New("template uses {PRODUCT} but there is no product name")
+			}
+		case "ATTR":
+			segment = skuCodeSegment(attributes[strings.ToLower(part.Name)], part.Width)
+			if segment == "" {
+				return SKUCode{}, fmt.Errorf("template uses {ATTR:%s} but no value was given for it", part.Name)
+			}
+		}
+		*text += segment
+	}
+	return code, nil
+}